@@ -0,0 +1,385 @@
+// Package archivefs serves the contents of zip and tar archives as a
+// read-only filesys.FileSystem, without extracting them:
+//
+//	f, _ := os.Open("bundle.tar.gz")
+//	defer f.Close()
+//	fs, err := archivefs.NewTar(f)
+//	data, err := fs.ReadFile("/manifest.json")
+//
+// The archive is indexed once, when the FileSystem is created. Names are
+// relative to the root of the archive, whether they start with a slash or
+// not, and entries that would lead out of it are kept in it. Directories
+// that have no entry of their own are added, and every method that would
+// modify the file system fails with an error satisfying IsPermission.
+package archivefs
+
+import (
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/internal/links"
+)
+
+// ArchiveFileSystem is a read-only filesys.FileSystem of the entries
+// of an archive
+type ArchiveFileSystem struct {
+	entries map[string]*entry
+	// children are the sorted names in each directory
+	children map[string][]string
+}
+
+type entry struct {
+	fileInfo
+	// link is the target of a symbolic link
+	link string
+	// open returns a reader of the contents of a regular file
+	open func() io.ReadSeeker
+}
+
+func newArchive() *ArchiveFileSystem {
+	a := &ArchiveFileSystem{entries: map[string]*entry{}, children: map[string][]string{}}
+	a.entries["/"] = synthesizedDir("/")
+	return a
+}
+
+func synthesizedDir(name string) *entry {
+	return &entry{fileInfo: fileInfo{name: path.Base(name), mode: os.ModeDir | 0555}}
+}
+
+// clean returns the absolute name of an entry of the archive, which
+// can't lead out of the root
+func clean(name string) string {
+	return path.Join("/", strings.ReplaceAll(name, `\`, "/"))
+}
+
+// add adds an entry of the archive. Entries that occur more than once
+// replace the earlier ones, like they do when the archive is extracted.
+func (a *ArchiveFileSystem) add(name string, e *entry) {
+	if name != "/" {
+		a.entries[name] = e
+	}
+}
+
+// finish adds the missing directories, and the lists of their contents
+func (a *ArchiveFileSystem) finish() {
+	names := make([]string, 0, len(a.entries))
+	for name := range a.entries {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		for dir := path.Dir(name); ; dir = path.Dir(dir) {
+			if e, ok := a.entries[dir]; !ok || !e.IsDir() {
+				// Missing, or a file with entries in it
+				a.entries[dir] = synthesizedDir(dir)
+			}
+			if dir == "/" {
+				break
+			}
+		}
+	}
+	for name := range a.entries {
+		if name != "/" {
+			dir := path.Dir(name)
+			a.children[dir] = append(a.children[dir], path.Base(name))
+		}
+	}
+	for _, names := range a.children {
+		sort.Strings(names)
+	}
+}
+
+// lookup returns the entry of name, and its absolute name with links
+// resolved. The last element is only resolved if follow is set.
+func (a *ArchiveFileSystem) lookup(op, name string, follow bool) (*entry, string, error) {
+	if name == "" {
+		return nil, "", &os.PathError{op, name, os.ErrNotExist}
+	}
+	p, err := links.Resolver{FS: index{a}, Rooted: true}.Resolve(op, name, follow)
+	if err != nil {
+		return nil, "", err
+	}
+	if e, ok := a.entries[p]; ok {
+		return e, p, nil
+	}
+	for dir := path.Dir(p); dir != "/"; dir = path.Dir(dir) {
+		if e, ok := a.entries[dir]; ok {
+			// A dangling link is missing, a file isn't a directory
+			if !e.IsDir() && e.mode&os.ModeSymlink == 0 {
+				return nil, "", &os.PathError{op, name, syscall.ENOTDIR}
+			}
+			break
+		}
+	}
+	return nil, "", &os.PathError{op, name, os.ErrNotExist}
+}
+
+// index looks up the entries of names without links
+type index struct {
+	a *ArchiveFileSystem
+}
+
+func (i index) Lstat(name string) (os.FileInfo, error) {
+	e, ok := i.a.entries[name]
+	if !ok {
+		return nil, &os.PathError{"lstat", name, os.ErrNotExist}
+	}
+	return e.fileInfo, nil
+}
+
+func (i index) Readlink(name string) (string, error) {
+	e, ok := i.a.entries[name]
+	if !ok || e.mode&os.ModeSymlink == 0 {
+		return "", &os.PathError{"readlink", name, syscall.EINVAL}
+	}
+	return e.link, nil
+}
+
+func (a *ArchiveFileSystem) Open(name string) (filesys.File, error) {
+	e, p, err := a.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	f := &archiveFile{name: name, fi: e.fileInfo}
+	switch {
+	case e.IsDir():
+		for _, child := range a.children[p] {
+			f.infos = append(f.infos, a.entries[path.Join(p, child)].fileInfo)
+		}
+	case e.open != nil:
+		f.r = e.open()
+	default:
+		// Devices and pipes don't have contents in an archive
+		return nil, &os.PathError{"open", name, syscall.ENXIO}
+	}
+	return f, nil
+}
+
+func (a *ArchiveFileSystem) OpenFile(name string, flag int, perm os.FileMode) (filesys.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, &os.PathError{"open", name, os.ErrPermission}
+	}
+	return a.Open(name)
+}
+
+func (a *ArchiveFileSystem) Create(name string) (filesys.File, error) {
+	return nil, &os.PathError{"open", name, os.ErrPermission}
+}
+
+func (a *ArchiveFileSystem) Mkdir(name string, perm os.FileMode) error {
+	return &os.PathError{"mkdir", name, os.ErrPermission}
+}
+
+func (a *ArchiveFileSystem) MkdirAll(name string, perm os.FileMode) error {
+	return &os.PathError{"mkdir", name, os.ErrPermission}
+}
+
+func (a *ArchiveFileSystem) Remove(name string) error {
+	return &os.PathError{"remove", name, os.ErrPermission}
+}
+
+func (a *ArchiveFileSystem) RemoveAll(name string) error {
+	return &os.PathError{"remove", name, os.ErrPermission}
+}
+
+func (a *ArchiveFileSystem) Rename(oldPath, newPath string) error {
+	return &os.LinkError{"rename", oldPath, newPath, os.ErrPermission}
+}
+
+func (a *ArchiveFileSystem) Stat(name string) (os.FileInfo, error) {
+	e, _, err := a.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return e.fileInfo, nil
+}
+
+func (a *ArchiveFileSystem) Lstat(name string) (os.FileInfo, error) {
+	e, _, err := a.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return e.fileInfo, nil
+}
+
+func (a *ArchiveFileSystem) Symlink(oldname, newname string) error {
+	return &os.LinkError{"symlink", oldname, newname, os.ErrPermission}
+}
+
+func (a *ArchiveFileSystem) Readlink(name string) (string, error) {
+	e, _, err := a.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if e.mode&os.ModeSymlink == 0 {
+		return "", &os.PathError{"readlink", name, syscall.EINVAL}
+	}
+	return e.link, nil
+}
+
+func (a *ArchiveFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	return &os.PathError{"chtimes", name, os.ErrPermission}
+}
+
+func (a *ArchiveFileSystem) Chmod(name string, mode os.FileMode) error {
+	return &os.PathError{"chmod", name, os.ErrPermission}
+}
+
+func (a *ArchiveFileSystem) Chown(name string, uid, gid int) error {
+	return &os.PathError{"chown", name, os.ErrPermission}
+}
+
+func (a *ArchiveFileSystem) Lchown(name string, uid, gid int) error {
+	return &os.PathError{"lchown", name, os.ErrPermission}
+}
+
+func (a *ArchiveFileSystem) IsNotExist(err error) bool {
+	return os.IsNotExist(err)
+}
+
+func (a *ArchiveFileSystem) IsExist(err error) bool {
+	return os.IsExist(err)
+}
+
+func (a *ArchiveFileSystem) IsPermission(err error) bool {
+	return os.IsPermission(err)
+}
+
+func (a *ArchiveFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	e, p, err := a.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsDir() {
+		return nil, &os.PathError{"readdir", name, syscall.ENOTDIR}
+	}
+	infos := make([]os.FileInfo, 0, len(a.children[p]))
+	for _, child := range a.children[p] {
+		infos = append(infos, a.entries[path.Join(p, child)].fileInfo)
+	}
+	return infos, nil
+}
+
+func (a *ArchiveFileSystem) ReadFile(name string) ([]byte, error) {
+	f, err := a.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, _ := f.Stat()
+	if fi.IsDir() {
+		return nil, &os.PathError{"read", name, syscall.EISDIR}
+	}
+	return io.ReadAll(f)
+}
+
+func (a *ArchiveFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return &os.PathError{"open", name, os.ErrPermission}
+}
+
+// fileInfo is the FileInfo of an entry, from the header in the archive
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	sys     interface{}
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+
+// Sys returns the *zip.FileHeader or *tar.Header of the entry, or nil for
+// directories that were added
+func (fi fileInfo) Sys() interface{} { return fi.sys }
+
+// archiveFile is an open file or directory of the archive
+type archiveFile struct {
+	name   string
+	fi     fileInfo
+	r      io.ReadSeeker
+	infos  []os.FileInfo
+	pos    int
+	closed bool
+}
+
+func (f *archiveFile) Read(b []byte) (int, error) {
+	if f.closed {
+		return 0, &os.PathError{"read", f.name, os.ErrClosed}
+	}
+	if f.r == nil {
+		return 0, &os.PathError{"read", f.name, syscall.EISDIR}
+	}
+	return f.r.Read(b)
+}
+
+func (f *archiveFile) Write(b []byte) (int, error) {
+	return 0, &os.PathError{"write", f.name, os.ErrPermission}
+}
+
+func (f *archiveFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &os.PathError{"seek", f.name, os.ErrClosed}
+	}
+	if f.r == nil {
+		// Only going back to the start, to read the directory again
+		if offset != 0 || whence != io.SeekStart {
+			return 0, &os.PathError{"seek", f.name, syscall.EINVAL}
+		}
+		f.pos = 0
+		return 0, nil
+	}
+	pos, err := f.r.Seek(offset, whence)
+	if err != nil {
+		return 0, &os.PathError{"seek", f.name, err}
+	}
+	return pos, nil
+}
+
+func (f *archiveFile) Close() error {
+	if f.closed {
+		return &os.PathError{"close", f.name, os.ErrClosed}
+	}
+	f.closed = true
+	if c, ok := f.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (f *archiveFile) Stat() (os.FileInfo, error) {
+	if f.closed {
+		return nil, &os.PathError{"stat", f.name, os.ErrClosed}
+	}
+	return f.fi, nil
+}
+
+func (f *archiveFile) Readdir(n int) ([]os.FileInfo, error) {
+	if f.closed {
+		return nil, &os.PathError{"readdirent", f.name, os.ErrClosed}
+	}
+	if !f.fi.IsDir() {
+		return nil, &os.PathError{"readdirent", f.name, syscall.ENOTDIR}
+	}
+	rest := f.infos[f.pos:]
+	if n <= 0 {
+		f.pos = len(f.infos)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	f.pos += n
+	return rest[:n], nil
+}
@@ -0,0 +1,313 @@
+package archivefs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/poppels/filesys"
+)
+
+var (
+	_ filesys.FileSystem = (*ArchiveFileSystem)(nil)
+	_ filesys.File       = (*archiveFile)(nil)
+)
+
+var fixtureTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const large = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+func newZip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	add := func(fh *zip.FileHeader, data string) {
+		fh.Modified = fixtureTime
+		f, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(f, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := &zip.FileHeader{Name: "etc/"}
+	dir.SetMode(os.ModeDir | 0750)
+	add(dir, "")
+	conf := &zip.FileHeader{Name: "etc/app.conf", Method: zip.Store}
+	conf.SetMode(0640)
+	add(conf, "debug = false\n")
+	add(&zip.FileHeader{Name: "data/sub/large.txt", Method: zip.Deflate}, large)
+	link := &zip.FileHeader{Name: "data/link"}
+	link.SetMode(os.ModeSymlink | 0777)
+	add(link, "sub")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newTar(t *testing.T, compress bool) []byte {
+	var buf bytes.Buffer
+	var out io.Writer = &buf
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(&buf)
+		out = zw
+	}
+	w := tar.NewWriter(out)
+	add := func(hdr *tar.Header, data string) {
+		hdr.ModTime = fixtureTime
+		hdr.Size = int64(len(data))
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(&tar.Header{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0750}, "")
+	add(&tar.Header{Typeflag: tar.TypeReg, Name: "etc/app.conf", Mode: 0640}, "debug = false\n")
+	add(&tar.Header{Typeflag: tar.TypeReg, Name: "./data/sub/large.txt", Mode: 0644}, large)
+	add(&tar.Header{Typeflag: tar.TypeSymlink, Name: "data/link", Linkname: "sub", Mode: 0777}, "")
+	add(&tar.Header{Typeflag: tar.TypeLink, Name: "data/hard.txt", Linkname: "data/sub/large.txt"}, "")
+	add(&tar.Header{Typeflag: tar.TypeReg, Name: "../escape.txt", Mode: 0644}, "escape")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// archives returns the fixture as each kind of archive
+func archives(t *testing.T) map[string]*ArchiveFileSystem {
+	archives := map[string]*ArchiveFileSystem{}
+	data := newZip(t)
+	fs, err := NewZip(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archives["Zip"] = fs
+
+	// A reader without ReadAt, so the contents are kept in memory
+	if fs, err = NewTar(io.MultiReader(bytes.NewReader(newTar(t, false)))); err != nil {
+		t.Fatal(err)
+	}
+	archives["Tar"] = fs
+	if fs, err = NewTar(bytes.NewReader(newTar(t, true))); err != nil {
+		t.Fatal(err)
+	}
+	archives["TarGz"] = fs
+
+	name := filepath.Join(t.TempDir(), "fixture.tar")
+	if err := os.WriteFile(name, newTar(t, false), 0666); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	if fs, err = NewTar(f); err != nil {
+		t.Fatal(err)
+	}
+	archives["TarFile"] = fs
+	return archives
+}
+
+func TestRead(t *testing.T) {
+	for kind, fs := range archives(t) {
+		t.Run(kind, func(t *testing.T) {
+			if data, err := fs.ReadFile("/etc/app.conf"); err != nil || string(data) != "debug = false\n" {
+				t.Errorf("Expected the contents of the file, got %q, %v", data, err)
+			}
+			if data, err := fs.ReadFile("data/link/large.txt"); err != nil || string(data) != large {
+				t.Errorf("Expected the contents through the link, got %q, %v", data, err)
+			}
+			if target, err := fs.Readlink("/data/link"); err != nil || target != "sub" {
+				t.Errorf("Expected the target sub, got %q, %v", target, err)
+			}
+			if _, err := fs.ReadFile("/etc/missing"); !fs.IsNotExist(err) {
+				t.Errorf("Expected IsNotExist, got %v", err)
+			}
+			if _, err := fs.ReadFile("/etc/app.conf/x"); !errors.Is(err, syscall.ENOTDIR) {
+				t.Errorf("Expected ENOTDIR, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStat(t *testing.T) {
+	for kind, fs := range archives(t) {
+		t.Run(kind, func(t *testing.T) {
+			fi, err := fs.Stat("/etc/app.conf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Name() != "app.conf" || fi.Size() != 14 || fi.Mode() != 0640 || !fi.ModTime().Equal(fixtureTime) {
+				t.Errorf("Expected the metadata of the header, got %s %d %v %v", fi.Name(), fi.Size(), fi.Mode(), fi.ModTime())
+			}
+			if fi.Sys() == nil {
+				t.Error("Expected the header from Sys")
+			}
+			if fi, err := fs.Stat("/etc"); err != nil || fi.Mode() != os.ModeDir|0750 {
+				t.Errorf("Expected the mode of the directory entry, got %v, %v", fi, err)
+			}
+			if fi, err := fs.Lstat("/data/link"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+				t.Errorf("Expected a symbolic link, got %v, %v", fi, err)
+			}
+			if fi, err := fs.Stat("/data/link"); err != nil || !fi.IsDir() {
+				t.Errorf("Expected Stat to follow the link, got %v, %v", fi, err)
+			}
+		})
+	}
+}
+
+func TestSynthesizedDirs(t *testing.T) {
+	for kind, fs := range archives(t) {
+		t.Run(kind, func(t *testing.T) {
+			for _, name := range []string{"/", "/data", "/data/sub", "data/sub/"} {
+				fi, err := fs.Stat(name)
+				if err != nil || !fi.IsDir() || fi.Mode().Perm() == 0 {
+					t.Errorf("Expected %s to be a directory, got %v, %v", name, fi, err)
+				}
+			}
+			infos, err := fs.ReadDir("/data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, fi := range infos {
+				names = append(names, fi.Name())
+			}
+			expected := []string{"link", "sub"}
+			if kind != "Zip" {
+				expected = []string{"hard.txt", "link", "sub"}
+			}
+			if !reflect.DeepEqual(names, expected) {
+				t.Errorf("Expected %v, got %v", expected, names)
+			}
+		})
+	}
+}
+
+func TestTar(t *testing.T) {
+	fs := archives(t)["TarFile"]
+	if data, err := fs.ReadFile("/data/hard.txt"); err != nil || string(data) != large {
+		t.Errorf("Expected the contents of the hard link, got %q, %v", data, err)
+	}
+	// Kept in the root
+	if data, err := fs.ReadFile("/escape.txt"); err != nil || string(data) != "escape" {
+		t.Errorf("Expected the file in the root, got %q, %v", data, err)
+	}
+	if _, err := NewTar(bytes.NewReader([]byte("not a tar archive, but long enough to be read as a header"))); err == nil {
+		t.Error("Expected an error for an invalid archive")
+	}
+}
+
+func TestSeek(t *testing.T) {
+	for kind, fs := range archives(t) {
+		t.Run(kind, func(t *testing.T) {
+			f, err := fs.Open("/data/sub/large.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			b := make([]byte, 4)
+			if _, err := f.Seek(10, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.ReadFull(f, b); err != nil || string(b) != "abcd" {
+				t.Errorf("Expected abcd, got %q, %v", b, err)
+			}
+			// Back again
+			if pos, err := f.Seek(-6, io.SeekCurrent); err != nil || pos != 8 {
+				t.Fatalf("Expected offset 8, got %d, %v", pos, err)
+			}
+			if _, err := io.ReadFull(f, b); err != nil || string(b) != "89ab" {
+				t.Errorf("Expected 89ab, got %q, %v", b, err)
+			}
+			if _, err := f.Seek(-2, io.SeekEnd); err != nil {
+				t.Fatal(err)
+			}
+			if data, err := io.ReadAll(f); err != nil || string(data) != "yz" {
+				t.Errorf("Expected yz, got %q, %v", data, err)
+			}
+			if _, err := f.Seek(-1, io.SeekStart); err == nil {
+				t.Error("Expected an error seeking before the start")
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Read(b); !errors.Is(err, os.ErrClosed) {
+				t.Errorf("Expected ErrClosed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	fs := archives(t)["Zip"]
+	errs := map[string]error{}
+	_, errs["Create"] = fs.Create("/new.txt")
+	_, errs["OpenFile"] = fs.OpenFile("/etc/app.conf", os.O_RDWR, 0)
+	errs["WriteFile"] = fs.WriteFile("/etc/app.conf", nil, 0666)
+	errs["Mkdir"] = fs.Mkdir("/new", 0777)
+	errs["MkdirAll"] = fs.MkdirAll("/new/dir", 0777)
+	errs["Remove"] = fs.Remove("/etc/app.conf")
+	errs["RemoveAll"] = fs.RemoveAll("/etc")
+	errs["Rename"] = fs.Rename("/etc", "/moved")
+	errs["Symlink"] = fs.Symlink("/etc", "/link")
+	errs["Chtimes"] = fs.Chtimes("/etc", fixtureTime, fixtureTime)
+	errs["Chmod"] = fs.Chmod("/etc", 0777)
+	errs["Chown"] = fs.Chown("/etc", 0, 0)
+	errs["Lchown"] = fs.Lchown("/etc", 0, 0)
+	for op, err := range errs {
+		if !fs.IsPermission(err) {
+			t.Errorf("Expected a permission error from %s, got %v", op, err)
+		}
+	}
+
+	f, err := fs.Open("/etc/app.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("x")); !fs.IsPermission(err) {
+		t.Errorf("Expected a permission error from Write, got %v", err)
+	}
+}
+
+func TestOpenDir(t *testing.T) {
+	fs := archives(t)["Zip"]
+	f, err := fs.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	infos, err := f.Readdir(1)
+	if err != nil || len(infos) != 1 || infos[0].Name() != "data" {
+		t.Fatalf("Expected the first entry, got %v, %v", infos, err)
+	}
+	if infos, err = f.Readdir(-1); err != nil || len(infos) != 1 || infos[0].Name() != "etc" {
+		t.Fatalf("Expected the last entry, got %v, %v", infos, err)
+	}
+	if _, err := f.Readdir(1); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+	if _, err := f.Read(make([]byte, 1)); !errors.Is(err, syscall.EISDIR) {
+		t.Errorf("Expected EISDIR, got %v", err)
+	}
+}
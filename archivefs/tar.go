@@ -0,0 +1,112 @@
+package archivefs
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path"
+	"strings"
+)
+
+// NewTar returns a FileSystem of the tar archive read from r, which may
+// be compressed with gzip. The archive is read once, to index it. If r
+// is an io.ReaderAt, like an *os.File, and the archive isn't compressed,
+// the contents of files are read from r, from the start of it, when they
+// are read. Otherwise they are kept in memory.
+func NewTar(r io.Reader) (*ArchiveFileSystem, error) {
+	if ra, ok := r.(io.ReaderAt); ok {
+		magic := make([]byte, 2)
+		if n, _ := ra.ReadAt(magic, 0); n == len(magic) && !isGzip(magic) {
+			return readTar(io.NewSectionReader(ra, 0, 1<<63-1), ra)
+		}
+	}
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); isGzip(magic) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return readTar(zr, nil)
+	}
+	return readTar(br, nil)
+}
+
+func isGzip(magic []byte) bool {
+	return len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+// readTar indexes the archive read from r. If ra is set, r is a section of
+// it, and the offsets of the contents are kept instead of the contents.
+func readTar(r io.Reader, ra io.ReaderAt) (*ArchiveFileSystem, error) {
+	a := newArchive()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := clean(hdr.Name)
+		fi := hdr.FileInfo()
+		e := &entry{fileInfo: fileInfo{
+			name:    path.Base(name),
+			size:    hdr.Size,
+			mode:    fi.Mode(),
+			modTime: hdr.ModTime,
+			sys:     hdr,
+		}}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e.size = 0
+		case tar.TypeSymlink:
+			e.link = hdr.Linkname
+			e.size = int64(len(hdr.Linkname))
+		case tar.TypeLink:
+			// The same file as an earlier entry
+			target, ok := a.entries[clean(hdr.Linkname)]
+			if !ok || !target.mode.IsRegular() {
+				continue
+			}
+			e.size, e.mode, e.modTime, e.open = target.size, target.mode, target.modTime, target.open
+		case tar.TypeReg, tar.TypeGNUSparse:
+			if ra != nil && !isSparse(hdr) {
+				offset, err := r.(io.Seeker).Seek(0, io.SeekCurrent)
+				if err != nil {
+					return nil, err
+				}
+				size := hdr.Size
+				e.open = func() io.ReadSeeker { return io.NewSectionReader(ra, offset, size) }
+				break
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			e.open = func() io.ReadSeeker { return bytes.NewReader(data) }
+		case tar.TypeXGlobalHeader:
+			continue
+		}
+		a.add(name, e)
+	}
+	a.finish()
+	return a, nil
+}
+
+// isSparse returns whether the contents of the entry are stored as
+// fragments, which have to be read through tar.Reader
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package archivefs
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path"
+	"syscall"
+)
+
+// NewZip returns a FileSystem of the zip archive in r, which is size
+// bytes long. Stored entries are read from r directly, compressed ones
+// are decompressed as they are read.
+func NewZip(r io.ReaderAt, size int64) (*ArchiveFileSystem, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	a := newArchive()
+	for _, f := range zr.File {
+		fh := f.FileHeader
+		fi := fh.FileInfo()
+		name := clean(fh.Name)
+		e := &entry{fileInfo: fileInfo{
+			name:    path.Base(name),
+			size:    fi.Size(),
+			mode:    fi.Mode(),
+			modTime: fi.ModTime(),
+			sys:     &fh,
+		}}
+		switch {
+		case fi.IsDir():
+			e.size = 0
+		case fi.Mode()&os.ModeSymlink != 0:
+			// The target is the contents of the entry
+			target, err := readZip(f)
+			if err != nil {
+				return nil, err
+			}
+			e.link = string(target)
+		case fi.Mode().IsRegular():
+			e.open = zipOpener(r, f)
+		}
+		a.add(name, e)
+	}
+	a.finish()
+	return a, nil
+}
+
+func readZip(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func zipOpener(r io.ReaderAt, f *zip.File) func() io.ReadSeeker {
+	size := int64(f.UncompressedSize64)
+	if f.Method == zip.Store {
+		if offset, err := f.DataOffset(); err == nil {
+			return func() io.ReadSeeker { return io.NewSectionReader(r, offset, size) }
+		}
+	}
+	return func() io.ReadSeeker { return &zipReader{f: f, size: size} }
+}
+
+// zipReader reads a compressed entry. Seeking forward skips the data in
+// between, and seeking back decompresses the entry again from the start.
+type zipReader struct {
+	f    *zip.File
+	size int64
+	rc   io.ReadCloser
+	// cur is the offset of rc, and pos the offset to read next
+	cur, pos int64
+}
+
+func (z *zipReader) Read(b []byte) (int, error) {
+	if z.pos >= z.size {
+		return 0, io.EOF
+	}
+	if z.rc == nil || z.pos < z.cur {
+		if z.rc != nil {
+			z.rc.Close()
+		}
+		rc, err := z.f.Open()
+		if err != nil {
+			z.rc = nil
+			return 0, err
+		}
+		z.rc, z.cur = rc, 0
+	}
+	if z.pos > z.cur {
+		n, err := io.CopyN(io.Discard, z.rc, z.pos-z.cur)
+		z.cur += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := z.rc.Read(b)
+	z.cur += int64(n)
+	z.pos = z.cur
+	return n, err
+}
+
+func (z *zipReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += z.pos
+	case io.SeekEnd:
+		offset += z.size
+	default:
+		return 0, syscall.EINVAL
+	}
+	if offset < 0 {
+		return 0, syscall.EINVAL
+	}
+	z.pos = offset
+	return offset, nil
+}
+
+func (z *zipReader) Close() error {
+	if z.rc == nil {
+		return nil
+	}
+	err := z.rc.Close()
+	z.rc = nil
+	return err
+}
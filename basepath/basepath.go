@@ -0,0 +1,425 @@
+// Package basepath confines a filesys.FileSystem to one of its directories,
+// like chroot does for a process. The directory is the root of the confined
+// file system, so "/data/a.txt" and "data/a.txt" are both the file data/a.txt
+// of the directory. Names with ".." and links that lead out of the directory
+// are rejected with ErrEscape, and errors and the names of files don't
+// contain the path of the directory:
+//
+//	fs, err := basepath.New(osfilesys.NewOsWrapper(), "/var/lib/plugin")
+//	if err != nil {
+//		return err
+//	}
+//	defer fs.Close()
+//	// Fails with ErrEscape instead of reading /etc/passwd
+//	fs.ReadFile("../../../etc/passwd")
+//
+// On Linux, a directory of the os package is confined with os.Root, which
+// resolves names relative to an open descriptor of the directory, so also
+// links that are replaced while they are resolved can't lead out of it.
+// For other backends and platforms, links are resolved component by
+// component before the operation.
+package basepath
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/osfilesys"
+)
+
+// ErrEscape is returned for names and links that lead out of the directory
+var ErrEscape = errors.New("path escapes from the base directory")
+
+// BasePathFileSystem is a filesys.FileSystem confined to a directory
+// of another FileSystem
+type BasePathFileSystem struct {
+	inner filesys.FileSystem
+	base  string
+	root  *os.Root
+	// rootEscape is the error of os.Root for names that lead out of it
+	rootEscape error
+}
+
+// New returns the directory base of fs as a FileSystem of its own. Call
+// Close when it's no longer used, to release the open directory on Linux.
+func New(fs filesys.FileSystem, base string) (*BasePathFileSystem, error) {
+	fi, err := fs.Stat(base)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, &os.PathError{"basepath", base, syscall.ENOTDIR}
+	}
+
+	b := &BasePathFileSystem{base: path.Clean(base)}
+	if _, ok := fs.(osfilesys.OsFileSystem); ok && useOSRoot {
+		if b.root, err = os.OpenRoot(base); err != nil {
+			return nil, err
+		}
+		b.inner = rootFileSystem{b.root}
+		// The error isn't exported, but is the same for every escape
+		if _, err := b.root.Lstat(".."); err != nil {
+			b.rootEscape = err.(*os.PathError).Err
+		}
+	} else {
+		b.inner = &resolvingFileSystem{fs: fs, base: b.base}
+	}
+	return b, nil
+}
+
+// Close releases the directory that is kept open on Linux. Files that
+// are open stay usable.
+func (b *BasePathFileSystem) Close() error {
+	if b.root != nil {
+		return b.root.Close()
+	}
+	return nil
+}
+
+// rel returns name relative to the directory, or an error if it leads out
+// of it. Relative names are relative to the directory as well.
+func (b *BasePathFileSystem) rel(op, name string) (string, error) {
+	if name == "" {
+		return "", &os.PathError{op, name, syscall.ENOENT}
+	}
+	depth := 0
+	for _, part := range strings.Split(name, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if depth--; depth < 0 {
+				return "", &os.PathError{op, name, ErrEscape}
+			}
+		default:
+			depth++
+		}
+	}
+	if clean := path.Clean("/" + name); clean != "/" {
+		return clean[1:], nil
+	}
+	return ".", nil
+}
+
+// outside returns the name of p, a path of the backend or a name relative
+// to the directory, in the confined file system. Other paths are replaced
+// by name, the name the caller passed.
+func (b *BasePathFileSystem) outside(p, name string) string {
+	var inside string
+	if rel, ok := strings.CutPrefix(p, b.base); ok && (rel == "" || rel[0] == '/' || b.base == "/") {
+		inside = path.Join("/", rel)
+	} else if !path.IsAbs(p) && !strings.Contains(p, `\`) {
+		inside = path.Join("/", p)
+	} else {
+		return name
+	}
+	if rel, err := b.rel("", name); err == nil && path.Join("/", rel) == inside {
+		// The name the caller used for the same file
+		return name
+	}
+	return inside
+}
+
+// fixError replaces the paths in err with names of the confined file system
+func (b *BasePathFileSystem) fixError(err error, name string) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return &os.PathError{pe.Op, b.outside(pe.Path, name), b.escapeError(pe.Err)}
+	}
+	return err
+}
+
+func (b *BasePathFileSystem) fixLinkError(err error, oldname, newname string) error {
+	if le, ok := err.(*os.LinkError); ok {
+		return &os.LinkError{le.Op, oldname, newname, b.escapeError(le.Err)}
+	}
+	return b.fixError(err, newname)
+}
+
+// escapeError replaces the escape error of os.Root with ErrEscape
+func (b *BasePathFileSystem) escapeError(err error) error {
+	if b.rootEscape != nil && err == b.rootEscape {
+		return ErrEscape
+	}
+	return err
+}
+
+func (b *BasePathFileSystem) wrap(f filesys.File, err error, name string) (filesys.File, error) {
+	if err != nil {
+		return nil, b.fixError(err, name)
+	}
+	return &baseFile{file: f, name: name, fs: b}, nil
+}
+
+func (b *BasePathFileSystem) Open(name string) (filesys.File, error) {
+	rel, err := b.rel("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := b.inner.Open(rel)
+	return b.wrap(f, err, name)
+}
+
+func (b *BasePathFileSystem) OpenFile(name string, flag int, perm os.FileMode) (filesys.File, error) {
+	rel, err := b.rel("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := b.inner.OpenFile(rel, flag, perm)
+	return b.wrap(f, err, name)
+}
+
+func (b *BasePathFileSystem) Create(name string) (filesys.File, error) {
+	rel, err := b.rel("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := b.inner.Create(rel)
+	return b.wrap(f, err, name)
+}
+
+func (b *BasePathFileSystem) Mkdir(name string, perm os.FileMode) error {
+	rel, err := b.rel("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return b.fixError(b.inner.Mkdir(rel, perm), name)
+}
+
+func (b *BasePathFileSystem) MkdirAll(name string, perm os.FileMode) error {
+	rel, err := b.rel("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return b.fixError(b.inner.MkdirAll(rel, perm), name)
+}
+
+func (b *BasePathFileSystem) Remove(name string) error {
+	rel, err := b.rel("remove", name)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		// The directory itself is the root
+		return &os.PathError{"remove", name, syscall.EBUSY}
+	}
+	return b.fixError(b.inner.Remove(rel), name)
+}
+
+func (b *BasePathFileSystem) RemoveAll(name string) error {
+	rel, err := b.rel("remove", name)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return &os.PathError{"remove", name, syscall.EBUSY}
+	}
+	return b.fixError(b.inner.RemoveAll(rel), name)
+}
+
+func (b *BasePathFileSystem) Rename(oldPath, newPath string) error {
+	oldRel, err := b.rel("rename", oldPath)
+	if err != nil {
+		return err
+	}
+	newRel, err := b.rel("rename", newPath)
+	if err != nil {
+		return err
+	}
+	return b.fixLinkError(b.inner.Rename(oldRel, newRel), oldPath, newPath)
+}
+
+func (b *BasePathFileSystem) Stat(name string) (os.FileInfo, error) {
+	rel, err := b.rel("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := b.inner.Stat(rel)
+	return fi, b.fixError(err, name)
+}
+
+func (b *BasePathFileSystem) Lstat(name string) (os.FileInfo, error) {
+	rel, err := b.rel("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := b.inner.Lstat(rel)
+	return fi, b.fixError(err, name)
+}
+
+// Symlink creates a link. Absolute targets are names of the confined file
+// system, which would mean something else outside of it, so they are
+// stored relative to the link.
+func (b *BasePathFileSystem) Symlink(oldname, newname string) error {
+	rel, err := b.rel("symlink", newname)
+	if err != nil {
+		return err
+	}
+	target := oldname
+	if path.IsAbs(oldname) {
+		relTarget, err := b.rel("symlink", oldname)
+		if err != nil {
+			return err
+		}
+		target = relativePath(path.Dir(rel), relTarget)
+	}
+	return b.fixLinkError(b.inner.Symlink(target, rel), oldname, newname)
+}
+
+// relativePath returns the path from the directory from to to,
+// which are both clean paths relative to the same directory
+func relativePath(from, to string) string {
+	var fromParts, toParts []string
+	if from != "." {
+		fromParts = strings.Split(from, "/")
+	}
+	if to != "." {
+		toParts = strings.Split(to, "/")
+	}
+	i := 0
+	for i < len(fromParts) && i < len(toParts) && fromParts[i] == toParts[i] {
+		i++
+	}
+	var parts []string
+	for range fromParts[i:] {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, toParts[i:]...)
+	if len(parts) == 0 {
+		return "."
+	}
+	return strings.Join(parts, "/")
+}
+
+// Readlink returns the target of a link. Absolute targets were created
+// outside of the confined file system, and fail with ErrEscape like
+// following the link does, instead of revealing a path of the backend.
+func (b *BasePathFileSystem) Readlink(name string) (string, error) {
+	rel, err := b.rel("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	target, err := b.inner.Readlink(rel)
+	if err != nil {
+		return "", b.fixError(err, name)
+	}
+	if path.IsAbs(target) {
+		return "", &os.PathError{"readlink", name, ErrEscape}
+	}
+	return target, nil
+}
+
+func (b *BasePathFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	rel, err := b.rel("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return b.fixError(b.inner.Chtimes(rel, atime, mtime), name)
+}
+
+func (b *BasePathFileSystem) Chmod(name string, mode os.FileMode) error {
+	rel, err := b.rel("chmod", name)
+	if err != nil {
+		return err
+	}
+	return b.fixError(b.inner.Chmod(rel, mode), name)
+}
+
+func (b *BasePathFileSystem) Chown(name string, uid, gid int) error {
+	rel, err := b.rel("chown", name)
+	if err != nil {
+		return err
+	}
+	return b.fixError(b.inner.Chown(rel, uid, gid), name)
+}
+
+func (b *BasePathFileSystem) Lchown(name string, uid, gid int) error {
+	rel, err := b.rel("lchown", name)
+	if err != nil {
+		return err
+	}
+	return b.fixError(b.inner.Lchown(rel, uid, gid), name)
+}
+
+func (b *BasePathFileSystem) IsNotExist(err error) bool {
+	return b.inner.IsNotExist(err)
+}
+
+func (b *BasePathFileSystem) IsExist(err error) bool {
+	return b.inner.IsExist(err)
+}
+
+func (b *BasePathFileSystem) IsPermission(err error) bool {
+	return b.inner.IsPermission(err)
+}
+
+func (b *BasePathFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	rel, err := b.rel("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := b.inner.ReadDir(rel)
+	return infos, b.fixError(err, name)
+}
+
+func (b *BasePathFileSystem) ReadFile(name string) ([]byte, error) {
+	rel, err := b.rel("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := b.inner.ReadFile(rel)
+	return data, b.fixError(err, name)
+}
+
+func (b *BasePathFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	rel, err := b.rel("writefile", name)
+	if err != nil {
+		return err
+	}
+	return b.fixError(b.inner.WriteFile(rel, data, perm), name)
+}
+
+// baseFile is a file of the confined file system, with errors and
+// a name that don't contain the path of the directory
+type baseFile struct {
+	file filesys.File
+	name string
+	fs   *BasePathFileSystem
+}
+
+// Name returns the name the file was opened with, like os.File.Name
+func (f *baseFile) Name() string {
+	return f.name
+}
+
+func (f *baseFile) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	return n, f.fs.fixError(err, f.name)
+}
+
+func (f *baseFile) Write(p []byte) (int, error) {
+	n, err := f.file.Write(p)
+	return n, f.fs.fixError(err, f.name)
+}
+
+func (f *baseFile) Seek(offset int64, whence int) (int64, error) {
+	n, err := f.file.Seek(offset, whence)
+	return n, f.fs.fixError(err, f.name)
+}
+
+func (f *baseFile) Close() error {
+	return f.fs.fixError(f.file.Close(), f.name)
+}
+
+func (f *baseFile) Stat() (os.FileInfo, error) {
+	fi, err := f.file.Stat()
+	return fi, f.fs.fixError(err, f.name)
+}
+
+func (f *baseFile) Readdir(n int) ([]os.FileInfo, error) {
+	infos, err := f.file.Readdir(n)
+	return infos, f.fs.fixError(err, f.name)
+}
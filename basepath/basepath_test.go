@@ -0,0 +1,234 @@
+package basepath
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/filesystest"
+	"github.com/poppels/filesys/osfilesys"
+	"github.com/poppels/filesys/virtual"
+)
+
+var (
+	_ filesys.FileSystem = (*BasePathFileSystem)(nil)
+	_ filesys.File       = (*baseFile)(nil)
+)
+
+// backends returns a confined file system of every backend, with the
+// directory outside it containing a file secret.txt
+func backends(t *testing.T) map[string]*BasePathFileSystem {
+	vfs := virtual.NewVirtualFilesys()
+	if err := vfs.MkdirAll("/srv/base", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := vfs.WriteFile("/srv/secret.txt", []byte("secret"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "base"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	result := map[string]*BasePathFileSystem{}
+	for name, backend := range map[string]struct {
+		fs   filesys.FileSystem
+		base string
+	}{
+		"Virtual": {vfs, "/srv/base"},
+		"Os":      {osfilesys.NewOsWrapper(), filepath.Join(dir, "base")},
+	} {
+		fs, err := New(backend.fs, backend.base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { fs.Close() })
+		result[name] = fs
+	}
+	return result
+}
+
+func TestConformance(t *testing.T) {
+	filesystest.Run(t, func(t *testing.T) (filesys.FileSystem, string) {
+		return backends(t)["Virtual"], "/"
+	})
+}
+
+func TestEscape(t *testing.T) {
+	for name, fs := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := fs.MkdirAll("/a/b", 0777); err != nil {
+				t.Fatal(err)
+			}
+			links := map[string]string{
+				"/abs":        "/etc",
+				"/a/up":       "../../secret.txt",
+				"/a/b/upup":   "../../..",
+				"/a/b/inside": "../../a",
+				// Paths of the backend, outside and inside the directory
+				"/host":       path.Join(path.Dir(fs.base), "secret.txt"),
+				"/a/hostself": path.Join(fs.base, "a"),
+			}
+			for link, target := range links {
+				if err := fs.inner.Symlink(target, link[1:]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, name := range []string{"../secret.txt", "/../secret.txt", "a/../../secret.txt", "a/up", "a/b/upup/secret.txt"} {
+				if _, err := fs.ReadFile(name); !errors.Is(err, ErrEscape) {
+					t.Errorf("Expected ErrEscape reading %s, got %v", name, err)
+				}
+			}
+			if err := fs.WriteFile("a/b/upup/new.txt", nil, 0666); !errors.Is(err, ErrEscape) {
+				t.Errorf("Expected ErrEscape writing through a link, got %v", err)
+			}
+			if err := fs.Mkdir("../new", 0777); !errors.Is(err, ErrEscape) {
+				t.Errorf("Expected ErrEscape for Mkdir, got %v", err)
+			}
+
+			// ".." that stays in the directory, and links within it, work
+			if err := fs.WriteFile("/a/b/../c.txt", []byte("c"), 0666); err != nil {
+				t.Fatal(err)
+			}
+			if data, err := fs.ReadFile("a/b/inside/c.txt"); err != nil || string(data) != "c" {
+				t.Errorf("Expected c through the link, got %q, %v", data, err)
+			}
+			// Links themselves can be inspected and removed
+			if target, err := fs.Readlink("/a/up"); err != nil || target != "../../secret.txt" {
+				t.Errorf("Expected the target of the link, got %q, %v", target, err)
+			}
+			if err := fs.Remove("/a/b/upup"); err != nil {
+				t.Errorf("Expected to remove the link, got %v", err)
+			}
+
+			// Absolute targets are escapes, also when reading the link, and
+			// never show the path of the backend
+			for _, name := range []string{"/abs", "/host", "/a/hostself"} {
+				target, err := fs.Readlink(name)
+				if !errors.Is(err, ErrEscape) {
+					t.Errorf("Expected ErrEscape reading the link %s, got %q, %v", name, target, err)
+				}
+				if err != nil && strings.Contains(err.Error(), path.Dir(fs.base)) {
+					t.Errorf("Error contains the path of the backend: %v", err)
+				}
+				if _, err := fs.ReadFile(name); !errors.Is(err, ErrEscape) {
+					t.Errorf("Expected ErrEscape reading through %s, got %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorPaths(t *testing.T) {
+	for name, fs := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			base := fs.base
+			checkError := func(err error, expected string) {
+				t.Helper()
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+				if strings.Contains(err.Error(), base) {
+					t.Errorf("Error contains the directory: %v", err)
+				}
+				if pe, ok := err.(*os.PathError); !ok || pe.Path != expected {
+					t.Errorf("Expected a PathError for %s, got %#v", expected, err)
+				}
+			}
+
+			_, err := fs.Stat("/missing/file.txt")
+			checkError(err, "/missing/file.txt")
+			if !fs.IsNotExist(err) {
+				t.Errorf("Expected IsNotExist, got %v", err)
+			}
+			_, err = fs.Open("missing.txt")
+			checkError(err, "missing.txt")
+			checkError(fs.Remove("/"), "/")
+
+			if err := fs.Mkdir("/dir", 0777); err != nil {
+				t.Fatal(err)
+			}
+			checkError(fs.Mkdir("/dir", 0777), "/dir")
+			err = fs.Rename("/missing.txt", "/dir/new.txt")
+			if le, ok := err.(*os.LinkError); !ok || le.Old != "/missing.txt" || le.New != "/dir/new.txt" || strings.Contains(err.Error(), base) {
+				t.Errorf("Expected a LinkError with the names passed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFileName(t *testing.T) {
+	for name, fs := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			f, err := fs.Create("/a.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if named, ok := f.(interface{ Name() string }); !ok || named.Name() != "/a.txt" {
+				t.Errorf("Expected name /a.txt, got %v", f)
+			}
+			if _, err := f.Write([]byte("a")); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			f, err = fs.Open("/a.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			_, err = f.Write([]byte("b"))
+			if err == nil || strings.Contains(err.Error(), fs.base) {
+				t.Errorf("Expected an error without the directory, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSymlinkAbsolute(t *testing.T) {
+	for name, fs := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := fs.MkdirAll("/a/b", 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := fs.WriteFile("/a/c.txt", []byte("c"), 0666); err != nil {
+				t.Fatal(err)
+			}
+			if err := fs.Symlink("/a/c.txt", "/a/b/link"); err != nil {
+				t.Fatal(err)
+			}
+			// Stored relative, so the link also works outside
+			if target, err := fs.inner.Readlink("a/b/link"); err != nil || target != "../c.txt" {
+				t.Errorf("Expected target ../c.txt, got %q, %v", target, err)
+			}
+			if data, err := fs.ReadFile("/a/b/link"); err != nil || string(data) != "c" {
+				t.Errorf("Expected c through the link, got %q, %v", data, err)
+			}
+			if err := fs.Symlink("/../secret.txt", "/a/escape"); !errors.Is(err, ErrEscape) {
+				t.Errorf("Expected ErrEscape for a target outside, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewNotDir(t *testing.T) {
+	vfs := virtual.NewVirtualFilesys()
+	if err := vfs.WriteFile("/file", nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(vfs, "/file"); err == nil {
+		t.Error("Expected an error for a file as directory")
+	}
+	if _, err := New(vfs, "/missing"); !vfs.IsNotExist(err) {
+		t.Errorf("Expected IsNotExist, got %v", err)
+	}
+}
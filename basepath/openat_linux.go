@@ -0,0 +1,5 @@
+package basepath
+
+// useOSRoot confines the os package with os.Root, which resolves names
+// with openat and doesn't follow links that lead out of the directory
+const useOSRoot = true
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package basepath
+
+// useOSRoot is only set on Linux, elsewhere the os package is confined by
+// resolving links like for other backends
+const useOSRoot = false
@@ -0,0 +1,127 @@
+package basepath
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/poppels/filesys"
+)
+
+// rootFileSystem confines the os package to a directory with os.Root,
+// which resolves names relative to an open descriptor of the directory,
+// so links can't lead out of it even if they are replaced concurrently
+type rootFileSystem struct {
+	root *os.Root
+}
+
+func (r rootFileSystem) Open(name string) (filesys.File, error) {
+	f, err := r.root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (r rootFileSystem) OpenFile(name string, flag int, perm os.FileMode) (filesys.File, error) {
+	f, err := r.root.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (r rootFileSystem) Create(name string) (filesys.File, error) {
+	f, err := r.root.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (r rootFileSystem) Mkdir(name string, perm os.FileMode) error {
+	return r.root.Mkdir(name, perm)
+}
+
+func (r rootFileSystem) MkdirAll(name string, perm os.FileMode) error {
+	return r.root.MkdirAll(name, perm)
+}
+
+func (r rootFileSystem) Remove(name string) error {
+	return r.root.Remove(name)
+}
+
+func (r rootFileSystem) RemoveAll(name string) error {
+	return r.root.RemoveAll(name)
+}
+
+func (r rootFileSystem) Rename(oldPath, newPath string) error {
+	return r.root.Rename(oldPath, newPath)
+}
+
+func (r rootFileSystem) Stat(name string) (os.FileInfo, error) {
+	return r.root.Stat(name)
+}
+
+func (r rootFileSystem) Lstat(name string) (os.FileInfo, error) {
+	return r.root.Lstat(name)
+}
+
+func (r rootFileSystem) Symlink(oldname, newname string) error {
+	return r.root.Symlink(oldname, newname)
+}
+
+func (r rootFileSystem) Readlink(name string) (string, error) {
+	return r.root.Readlink(name)
+}
+
+func (r rootFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	return r.root.Chtimes(name, atime, mtime)
+}
+
+func (r rootFileSystem) Chmod(name string, mode os.FileMode) error {
+	return r.root.Chmod(name, mode)
+}
+
+func (r rootFileSystem) Chown(name string, uid, gid int) error {
+	return r.root.Chown(name, uid, gid)
+}
+
+func (r rootFileSystem) Lchown(name string, uid, gid int) error {
+	return r.root.Lchown(name, uid, gid)
+}
+
+func (rootFileSystem) IsNotExist(err error) bool {
+	return os.IsNotExist(err)
+}
+
+func (rootFileSystem) IsExist(err error) bool {
+	return os.IsExist(err)
+}
+
+func (rootFileSystem) IsPermission(err error) bool {
+	return os.IsPermission(err)
+}
+
+func (r rootFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	f, err := r.root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	// Sorted like ioutil.ReadDir
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (r rootFileSystem) ReadFile(name string) ([]byte, error) {
+	return r.root.ReadFile(name)
+}
+
+func (r rootFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return r.root.WriteFile(name, data, perm)
+}
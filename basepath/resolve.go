@@ -0,0 +1,216 @@
+package basepath
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/internal/links"
+)
+
+// resolvingFileSystem confines a backend to its base directory by
+// resolving the links in names itself, and works with any backend. Names
+// are relative to the base directory and don't contain "..", like the
+// names that BasePathFileSystem passes.
+type resolvingFileSystem struct {
+	fs   filesys.FileSystem
+	base string
+}
+
+// resolve returns the path in the backend of name, with all links in it
+// resolved, or an error if a link leads out of the base directory. The
+// last element is only resolved if follow is set.
+func (r *resolvingFileSystem) resolve(op, name string, follow bool) (string, error) {
+	resolved, err := links.Resolver{FS: hostFS{r}, Escape: ErrEscape}.Resolve(op, name, follow)
+	if err != nil {
+		return "", err
+	}
+	return r.host(resolved), nil
+}
+
+// hostFS looks up the names of the base directory in the backend
+type hostFS struct {
+	r *resolvingFileSystem
+}
+
+func (h hostFS) Lstat(name string) (os.FileInfo, error) {
+	return h.r.fs.Lstat(h.r.host(name))
+}
+
+func (h hostFS) Readlink(name string) (string, error) {
+	return h.r.fs.Readlink(h.r.host(name))
+}
+
+// host returns the path in the backend of a name without links
+func (r *resolvingFileSystem) host(name string) string {
+	return path.Join(r.base, name)
+}
+
+func (r *resolvingFileSystem) Open(name string) (filesys.File, error) {
+	real, err := r.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return r.fs.Open(real)
+}
+
+func (r *resolvingFileSystem) OpenFile(name string, flag int, perm os.FileMode) (filesys.File, error) {
+	real, err := r.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return r.fs.OpenFile(real, flag, perm)
+}
+
+func (r *resolvingFileSystem) Create(name string) (filesys.File, error) {
+	real, err := r.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return r.fs.Create(real)
+}
+
+func (r *resolvingFileSystem) Mkdir(name string, perm os.FileMode) error {
+	real, err := r.resolve("mkdir", name, false)
+	if err != nil {
+		return err
+	}
+	return r.fs.Mkdir(real, perm)
+}
+
+func (r *resolvingFileSystem) MkdirAll(name string, perm os.FileMode) error {
+	real, err := r.resolve("mkdir", name, true)
+	if err != nil {
+		return err
+	}
+	return r.fs.MkdirAll(real, perm)
+}
+
+func (r *resolvingFileSystem) Remove(name string) error {
+	real, err := r.resolve("remove", name, false)
+	if err != nil {
+		return err
+	}
+	return r.fs.Remove(real)
+}
+
+func (r *resolvingFileSystem) RemoveAll(name string) error {
+	real, err := r.resolve("remove", name, false)
+	if err != nil {
+		return err
+	}
+	return r.fs.RemoveAll(real)
+}
+
+func (r *resolvingFileSystem) Rename(oldPath, newPath string) error {
+	oldReal, err := r.resolve("rename", oldPath, false)
+	if err != nil {
+		return err
+	}
+	newReal, err := r.resolve("rename", newPath, false)
+	if err != nil {
+		return err
+	}
+	return r.fs.Rename(oldReal, newReal)
+}
+
+func (r *resolvingFileSystem) Stat(name string) (os.FileInfo, error) {
+	real, err := r.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return r.fs.Stat(real)
+}
+
+func (r *resolvingFileSystem) Lstat(name string) (os.FileInfo, error) {
+	real, err := r.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return r.fs.Lstat(real)
+}
+
+func (r *resolvingFileSystem) Symlink(oldname, newname string) error {
+	real, err := r.resolve("symlink", newname, false)
+	if err != nil {
+		return err
+	}
+	return r.fs.Symlink(oldname, real)
+}
+
+func (r *resolvingFileSystem) Readlink(name string) (string, error) {
+	real, err := r.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	return r.fs.Readlink(real)
+}
+
+func (r *resolvingFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	real, err := r.resolve("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	return r.fs.Chtimes(real, atime, mtime)
+}
+
+func (r *resolvingFileSystem) Chmod(name string, mode os.FileMode) error {
+	real, err := r.resolve("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	return r.fs.Chmod(real, mode)
+}
+
+func (r *resolvingFileSystem) Chown(name string, uid, gid int) error {
+	real, err := r.resolve("chown", name, true)
+	if err != nil {
+		return err
+	}
+	return r.fs.Chown(real, uid, gid)
+}
+
+func (r *resolvingFileSystem) Lchown(name string, uid, gid int) error {
+	real, err := r.resolve("lchown", name, false)
+	if err != nil {
+		return err
+	}
+	return r.fs.Lchown(real, uid, gid)
+}
+
+func (r *resolvingFileSystem) IsNotExist(err error) bool {
+	return r.fs.IsNotExist(err)
+}
+
+func (r *resolvingFileSystem) IsExist(err error) bool {
+	return r.fs.IsExist(err)
+}
+
+func (r *resolvingFileSystem) IsPermission(err error) bool {
+	return r.fs.IsPermission(err)
+}
+
+func (r *resolvingFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	real, err := r.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return r.fs.ReadDir(real)
+}
+
+func (r *resolvingFileSystem) ReadFile(name string) ([]byte, error) {
+	real, err := r.resolve("readfile", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return r.fs.ReadFile(real)
+}
+
+func (r *resolvingFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	real, err := r.resolve("writefile", name, true)
+	if err != nil {
+		return err
+	}
+	return r.fs.WriteFile(real, data, perm)
+}
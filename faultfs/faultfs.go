@@ -0,0 +1,457 @@
+// Package faultfs wraps a filesys.FileSystem and makes its operations fail
+// on demand, so error handling, retries and cleanup can be tested against
+// any backend. Failures are described by rules:
+//
+//	fs := faultfs.New(virtual.NewVirtualFilesys(), 1)
+//	// The second rename fails
+//	fs.Inject(faultfs.Rule{Op: "Rename", Nth: 2, Times: 1})
+//	// Writes to logs stop after 10 bytes because the disk is full
+//	fs.Inject(faultfs.Rule{Op: "Write", Path: "/logs/*", Limit: 10, Err: syscall.ENOSPC})
+//	// One in ten reads fails
+//	fs.Inject(faultfs.Rule{Op: "Read", Probability: 0.1})
+//
+// Given the same seed and the same sequence of calls, the same calls fail.
+package faultfs
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/poppels/filesys"
+)
+
+// Rule describes which calls fail and how
+type Rule struct {
+	// Op is the name of the FileSystem or File method, like "OpenFile",
+	// "Rename" or "Write". An empty Op matches every method.
+	Op string
+	// Path is a pattern for path.Match. For Rename and Symlink it may match
+	// either path, for File methods it matches the name the file was opened
+	// with. An empty Path matches every path.
+	Path string
+	// Nth is the first matching call that may fail, counting from 1.
+	// Zero is the same as 1.
+	Nth int
+	// Times is the maximum number of failures, zero means no limit
+	Times int
+	// Probability is the chance that a matching call fails. Zero means
+	// every matching call fails.
+	Probability float64
+	// Limit is the number of bytes that Read, Write, ReadFile and WriteFile
+	// still transfer in total before they fail, to simulate short reads and
+	// writes. The call that uses up the rest of it transfers what is left.
+	Limit int
+	// Err is the error that is injected, syscall.EIO if nil
+	Err error
+}
+
+type rule struct {
+	Rule
+	calls int
+	fired int
+	// used is the part of the Limit that was transferred
+	used int
+}
+
+// FaultFileSystem is a filesys.FileSystem that passes every call to the
+// wrapped file system, unless one of its rules makes it fail. A failing
+// call doesn't reach the wrapped file system, except for the bytes that
+// a rule with a Limit lets through.
+type FaultFileSystem struct {
+	fs    filesys.FileSystem
+	mu    sync.Mutex
+	rules []*rule
+	rand  *rand.Rand
+	count int
+}
+
+// New returns a FaultFileSystem wrapping fs, without any rules.
+// The seed is used for rules with a Probability.
+func New(fs filesys.FileSystem, seed int64) *FaultFileSystem {
+	return &FaultFileSystem{fs: fs, rand: rand.New(rand.NewSource(seed))}
+}
+
+// Inject adds a rule. When several rules match a call, the first one
+// that was added decides.
+func (f *FaultFileSystem) Inject(r Rule) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, &rule{Rule: r})
+}
+
+// Reset removes all rules
+func (f *FaultFileSystem) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = nil
+}
+
+// Faults returns the number of failures injected so far
+func (f *FaultFileSystem) Faults() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.count
+}
+
+// fault returns the rule that makes the call fail, if any.
+// Every matching rule counts the call.
+func (f *FaultFileSystem) fault(op string, names ...string) *rule {
+	r, _, _ := f.faultLimit(op, -1, names...)
+	return r
+}
+
+// faultLimit is fault for a call that transfers up to n bytes. Rules with
+// a Limit let the call through while some of it is left. It returns the
+// failing rule, or the rules the call uses the Limit of and the number of
+// bytes it may transfer, which are passed to consume afterwards.
+func (f *FaultFileSystem) faultLimit(op string, n int, names ...string) (*rule, []*rule, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var failing *rule
+	var limits []*rule
+	for _, r := range f.rules {
+		if !r.matches(op, names) {
+			continue
+		}
+		r.calls++
+		if failing != nil || r.calls < r.Nth || (r.Times > 0 && r.fired >= r.Times) {
+			continue
+		}
+		if r.Probability > 0 && f.rand.Float64() >= r.Probability {
+			continue
+		}
+		if n >= 0 && r.used < r.Limit {
+			limits = append(limits, r)
+			n = min(n, r.Limit-r.used)
+			continue
+		}
+		r.fired++
+		failing = r
+	}
+	if failing != nil {
+		f.count++
+	}
+	return failing, limits, n
+}
+
+// consume takes the n bytes a call transferred from the Limit of the
+// rules. Instead of the requested bytes, the call transferred what was
+// left of a Limit if it returns the rule, and it fails.
+func (f *FaultFileSystem) consume(limits []*rule, n, requested int) *rule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var failing *rule
+	for _, r := range limits {
+		r.used += n
+		if failing == nil && n < requested && r.used >= r.Limit {
+			r.fired++
+			failing = r
+		}
+	}
+	if failing != nil {
+		f.count++
+	}
+	return failing
+}
+
+func (r *rule) matches(op string, names []string) bool {
+	if r.Op != "" && r.Op != op {
+		return false
+	}
+	if r.Path == "" {
+		return true
+	}
+	for _, name := range names {
+		if ok, _ := path.Match(r.Path, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(r.Path, path.Clean(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) err() error {
+	if r.Err == nil {
+		return syscall.EIO
+	}
+	return r.Err
+}
+
+// pathError wraps the injected error like the os package would
+func (r *rule) pathError(op, name string) error {
+	return &os.PathError{osOp(op), name, r.err()}
+}
+
+func (r *rule) linkError(op, oldname, newname string) error {
+	return &os.LinkError{osOp(op), oldname, newname, r.err()}
+}
+
+// osOp converts a method name to the operation in errors from the os package
+func osOp(op string) string {
+	switch op {
+	case "Open", "OpenFile", "Create", "ReadFile", "WriteFile":
+		return "open"
+	case "MkdirAll":
+		return "mkdir"
+	case "RemoveAll":
+		return "remove"
+	}
+	return strings.ToLower(op)
+}
+
+func (f *FaultFileSystem) Open(name string) (filesys.File, error) {
+	if r := f.fault("Open", name); r != nil {
+		return nil, r.pathError("Open", name)
+	}
+	file, err := f.fs.Open(name)
+	return f.wrap(file, name, err)
+}
+
+func (f *FaultFileSystem) OpenFile(name string, flag int, perm os.FileMode) (filesys.File, error) {
+	if r := f.fault("OpenFile", name); r != nil {
+		return nil, r.pathError("OpenFile", name)
+	}
+	file, err := f.fs.OpenFile(name, flag, perm)
+	return f.wrap(file, name, err)
+}
+
+func (f *FaultFileSystem) Create(name string) (filesys.File, error) {
+	if r := f.fault("Create", name); r != nil {
+		return nil, r.pathError("Create", name)
+	}
+	file, err := f.fs.Create(name)
+	return f.wrap(file, name, err)
+}
+
+func (f *FaultFileSystem) wrap(file filesys.File, name string, err error) (filesys.File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{file: file, fs: f, name: name}, nil
+}
+
+func (f *FaultFileSystem) Mkdir(name string, perm os.FileMode) error {
+	if r := f.fault("Mkdir", name); r != nil {
+		return r.pathError("Mkdir", name)
+	}
+	return f.fs.Mkdir(name, perm)
+}
+
+func (f *FaultFileSystem) MkdirAll(name string, perm os.FileMode) error {
+	if r := f.fault("MkdirAll", name); r != nil {
+		return r.pathError("MkdirAll", name)
+	}
+	return f.fs.MkdirAll(name, perm)
+}
+
+func (f *FaultFileSystem) Remove(name string) error {
+	if r := f.fault("Remove", name); r != nil {
+		return r.pathError("Remove", name)
+	}
+	return f.fs.Remove(name)
+}
+
+func (f *FaultFileSystem) RemoveAll(name string) error {
+	if r := f.fault("RemoveAll", name); r != nil {
+		return r.pathError("RemoveAll", name)
+	}
+	return f.fs.RemoveAll(name)
+}
+
+func (f *FaultFileSystem) Rename(oldPath, newPath string) error {
+	if r := f.fault("Rename", oldPath, newPath); r != nil {
+		return r.linkError("Rename", oldPath, newPath)
+	}
+	return f.fs.Rename(oldPath, newPath)
+}
+
+func (f *FaultFileSystem) Stat(name string) (os.FileInfo, error) {
+	if r := f.fault("Stat", name); r != nil {
+		return nil, r.pathError("Stat", name)
+	}
+	return f.fs.Stat(name)
+}
+
+func (f *FaultFileSystem) Lstat(name string) (os.FileInfo, error) {
+	if r := f.fault("Lstat", name); r != nil {
+		return nil, r.pathError("Lstat", name)
+	}
+	return f.fs.Lstat(name)
+}
+
+func (f *FaultFileSystem) Symlink(oldname, newname string) error {
+	if r := f.fault("Symlink", oldname, newname); r != nil {
+		return r.linkError("Symlink", oldname, newname)
+	}
+	return f.fs.Symlink(oldname, newname)
+}
+
+func (f *FaultFileSystem) Readlink(name string) (string, error) {
+	if r := f.fault("Readlink", name); r != nil {
+		return "", r.pathError("Readlink", name)
+	}
+	return f.fs.Readlink(name)
+}
+
+func (f *FaultFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	if r := f.fault("Chtimes", name); r != nil {
+		return r.pathError("Chtimes", name)
+	}
+	return f.fs.Chtimes(name, atime, mtime)
+}
+
+func (f *FaultFileSystem) Chmod(name string, mode os.FileMode) error {
+	if r := f.fault("Chmod", name); r != nil {
+		return r.pathError("Chmod", name)
+	}
+	return f.fs.Chmod(name, mode)
+}
+
+func (f *FaultFileSystem) Chown(name string, uid, gid int) error {
+	if r := f.fault("Chown", name); r != nil {
+		return r.pathError("Chown", name)
+	}
+	return f.fs.Chown(name, uid, gid)
+}
+
+func (f *FaultFileSystem) Lchown(name string, uid, gid int) error {
+	if r := f.fault("Lchown", name); r != nil {
+		return r.pathError("Lchown", name)
+	}
+	return f.fs.Lchown(name, uid, gid)
+}
+
+func (f *FaultFileSystem) IsNotExist(err error) bool {
+	return f.fs.IsNotExist(err)
+}
+
+func (f *FaultFileSystem) IsExist(err error) bool {
+	return f.fs.IsExist(err)
+}
+
+func (f *FaultFileSystem) IsPermission(err error) bool {
+	return f.fs.IsPermission(err)
+}
+
+func (f *FaultFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	if r := f.fault("ReadDir", name); r != nil {
+		return nil, r.pathError("ReadDir", name)
+	}
+	return f.fs.ReadDir(name)
+}
+
+func (f *FaultFileSystem) ReadFile(name string) ([]byte, error) {
+	r, limits, n := f.faultLimit("ReadFile", math.MaxInt, name)
+	if r != nil {
+		return nil, r.pathError("ReadFile", name)
+	}
+	data, err := f.fs.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	size := len(data)
+	if size > n {
+		data = data[:n]
+	}
+	if r := f.consume(limits, len(data), size); r != nil {
+		return data, &os.PathError{"read", name, r.err()}
+	}
+	return data, nil
+}
+
+// Statfs fails with errors.ErrUnsupported if the wrapped file system
+// doesn't implement filesys.StatfsFileSystem
+func (f *FaultFileSystem) Statfs(name string) (filesys.DiskUsage, error) {
+	if r := f.fault("Statfs", name); r != nil {
+		return filesys.DiskUsage{}, r.pathError("Statfs", name)
+	}
+	sfs, ok := f.fs.(filesys.StatfsFileSystem)
+	if !ok {
+		return filesys.DiskUsage{}, &os.PathError{"statfs", name, errors.ErrUnsupported}
+	}
+	return sfs.Statfs(name)
+}
+
+func (f *FaultFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	r, limits, n := f.faultLimit("WriteFile", len(data), name)
+	if r != nil {
+		return r.pathError("WriteFile", name)
+	}
+	if err := f.fs.WriteFile(name, data[:n], perm); err != nil {
+		return err
+	}
+	if r := f.consume(limits, n, len(data)); r != nil {
+		return &os.PathError{"write", name, r.err()}
+	}
+	return nil
+}
+
+// faultFile wraps a file opened through a FaultFileSystem
+type faultFile struct {
+	file filesys.File
+	fs   *FaultFileSystem
+	name string
+}
+
+func (f *faultFile) Read(b []byte) (int, error) {
+	r, limits, n := f.fs.faultLimit("Read", len(b), f.name)
+	if r != nil {
+		return 0, r.pathError("Read", f.name)
+	}
+	n, err := f.file.Read(b[:n])
+	if r := f.fs.consume(limits, n, len(b)); r != nil && err == nil {
+		return n, r.pathError("Read", f.name)
+	}
+	return n, err
+}
+
+func (f *faultFile) Write(b []byte) (int, error) {
+	r, limits, n := f.fs.faultLimit("Write", len(b), f.name)
+	if r != nil {
+		return 0, r.pathError("Write", f.name)
+	}
+	n, err := f.file.Write(b[:n])
+	if r := f.fs.consume(limits, n, len(b)); r != nil && err == nil {
+		return n, r.pathError("Write", f.name)
+	}
+	return n, err
+}
+
+func (f *faultFile) Seek(offset int64, whence int) (int64, error) {
+	if r := f.fs.fault("Seek", f.name); r != nil {
+		return 0, r.pathError("Seek", f.name)
+	}
+	return f.file.Seek(offset, whence)
+}
+
+// Close always closes the wrapped file, even when it reports an error
+func (f *faultFile) Close() error {
+	err := f.file.Close()
+	if r := f.fs.fault("Close", f.name); r != nil {
+		return r.pathError("Close", f.name)
+	}
+	return err
+}
+
+func (f *faultFile) Stat() (os.FileInfo, error) {
+	if r := f.fs.fault("Stat", f.name); r != nil {
+		return nil, r.pathError("Stat", f.name)
+	}
+	return f.file.Stat()
+}
+
+func (f *faultFile) Readdir(n int) ([]os.FileInfo, error) {
+	if r := f.fs.fault("Readdir", f.name); r != nil {
+		return nil, r.pathError("Readdir", f.name)
+	}
+	return f.file.Readdir(n)
+}
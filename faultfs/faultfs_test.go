@@ -0,0 +1,185 @@
+package faultfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/filesystest"
+	"github.com/poppels/filesys/fsutil"
+	"github.com/poppels/filesys/virtual"
+)
+
+var (
+	_ filesys.FileSystem       = (*FaultFileSystem)(nil)
+	_ filesys.StatfsFileSystem = (*FaultFileSystem)(nil)
+	_ filesys.File             = (*faultFile)(nil)
+)
+
+func TestConformance(t *testing.T) {
+	// Without rules, the wrapper must behave exactly like the wrapped backend
+	filesystest.Run(t, func(t *testing.T) (filesys.FileSystem, string) {
+		return New(virtual.NewVirtualFilesys(), 1), "/"
+	})
+}
+
+func TestNth(t *testing.T) {
+	fs := New(virtual.NewVirtualFilesys(), 1)
+	fs.Inject(Rule{Op: "Mkdir", Nth: 2, Times: 1})
+
+	if err := fs.Mkdir("/a", 0777); err != nil {
+		t.Fatal(err)
+	}
+	err := fs.Mkdir("/b", 0777)
+	if !errors.Is(err, syscall.EIO) {
+		t.Fatalf("Expected EIO for the second call, got %v", err)
+	}
+	if pe, ok := err.(*os.PathError); !ok || pe.Op != "mkdir" || pe.Path != "/b" {
+		t.Fatalf("Expected a PathError like the one from os, got %#v", err)
+	}
+	if _, err := fs.Stat("/b"); !fs.IsNotExist(err) {
+		t.Fatal("The failing call must not reach the wrapped file system")
+	}
+	if err := fs.Mkdir("/c", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Faults() != 1 {
+		t.Fatalf("Expected 1 fault, got %d", fs.Faults())
+	}
+}
+
+func TestPath(t *testing.T) {
+	fs := New(virtual.NewVirtualFilesys(), 1)
+	fs.Inject(Rule{Path: "/locked/*", Err: os.ErrPermission})
+
+	if err := fs.MkdirAll("/locked", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/free.txt", []byte("Hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/locked/a.txt", []byte("Hello"), 0666); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	// Either path of a rename can match
+	if err := fs.Rename("/free.txt", "/locked/a.txt"); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+
+	fs.Reset()
+	if err := fs.Rename("/free.txt", "/locked/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShortWrite(t *testing.T) {
+	fs := New(virtual.NewVirtualFilesys(), 1)
+	fs.Inject(Rule{Op: "Write", Path: "/logs/*", Nth: 2, Limit: 3, Err: syscall.ENOSPC})
+
+	fsutil.PutFile(fs, "/logs/a.log", nil)
+	f, err := fs.OpenFile("/logs/a.log", os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if n, err := f.Write([]byte("Hello ")); n != 6 || err != nil {
+		t.Fatalf("Expected the first write to succeed, got %d, %v", n, err)
+	}
+	n, err := f.Write([]byte("world"))
+	if n != 3 || !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("Expected a short write of 3 bytes with ENOSPC, got %d, %v", n, err)
+	}
+	if err := fsutil.VerifyFileContent(fs, "/logs/a.log", []byte("Hello wor")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLimitAcrossCalls(t *testing.T) {
+	fs := New(virtual.NewVirtualFilesys(), 1)
+	fs.Inject(Rule{Op: "Write", Limit: 10, Err: syscall.ENOSPC})
+
+	f, err := fs.Create("/a.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i, expected := range []int{4, 4, 2, 0} {
+		n, err := f.Write([]byte("abcd"))
+		if n != expected {
+			t.Errorf("Expected write %d to write %d bytes, got %d", i+1, expected, n)
+		}
+		if failed := errors.Is(err, syscall.ENOSPC); failed != (i >= 2) {
+			t.Errorf("Expected write %d to fail: %t, got %v", i+1, i >= 2, err)
+		}
+	}
+	if err := fsutil.VerifyFileContent(fs, "/a.log", []byte("abcdabcdab")); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Faults() != 2 {
+		t.Errorf("Expected 2 faults, got %d", fs.Faults())
+	}
+
+	fs.Inject(Rule{Op: "WriteFile", Limit: 8})
+	if err := fs.WriteFile("/b.txt", []byte("Hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/b.txt", []byte("Hello"), 0666); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("Expected EIO once the limit is used up, got %v", err)
+	}
+	if err := fsutil.VerifyFileContent(fs, "/b.txt", []byte("Hel")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShortRead(t *testing.T) {
+	fs := New(virtual.NewVirtualFilesys(), 1)
+	fs.Inject(Rule{Op: "Read", Limit: 4})
+	fsutil.PutFile(fs, "/a.txt", []byte("Hello world"))
+
+	f, err := fs.Open("/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if string(data) != "Hell" || !errors.Is(err, syscall.EIO) {
+		t.Fatalf("Expected 'Hell' and EIO, got '%s', %v", data, err)
+	}
+
+	fs.Inject(Rule{Op: "ReadFile", Limit: 5})
+	data, err = fs.ReadFile("/a.txt")
+	if string(data) != "Hello" || !errors.Is(err, syscall.EIO) {
+		t.Fatalf("Expected 'Hello' and EIO, got '%s', %v", data, err)
+	}
+}
+
+func TestProbability(t *testing.T) {
+	failures := func(seed int64) []bool {
+		fs := New(virtual.NewVirtualFilesys(), seed)
+		fs.Inject(Rule{Op: "Stat", Probability: 0.5})
+		result := make([]bool, 100)
+		for i := range result {
+			_, err := fs.Stat("/")
+			result[i] = err != nil
+		}
+		return result
+	}
+
+	first := failures(42)
+	second := failures(42)
+	count := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Call %d differs between runs with the same seed", i)
+		}
+		if first[i] {
+			count++
+		}
+	}
+	if count < 25 || count > 75 {
+		t.Fatalf("Expected about half of the calls to fail, got %d", count)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 type FileSystem interface {
 	Open(string) (File, error)
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
 	Create(string) (File, error)
 	Mkdir(string, os.FileMode) error
 	MkdirAll(string, os.FileMode) error
@@ -15,7 +16,13 @@ type FileSystem interface {
 	RemoveAll(string) error
 	Rename(oldPath, newPath string) error
 	Stat(string) (os.FileInfo, error)
+	Lstat(string) (os.FileInfo, error)
+	Symlink(oldname, newname string) error
+	Readlink(string) (string, error)
 	Chtimes(path string, atime time.Time, mtime time.Time) error
+	Chmod(string, os.FileMode) error
+	Chown(name string, uid, gid int) error
+	Lchown(name string, uid, gid int) error
 	IsNotExist(error) bool
 	IsExist(error) bool
 	IsPermission(error) bool
@@ -57,6 +64,12 @@ func Open(path string) (File, error) {
 	return f, err
 }
 
+func OpenFile(path string, flag int, perm os.FileMode) (File, error) {
+	fs := getSingleton()
+	f, err := fs.OpenFile(path, flag, perm)
+	return f, err
+}
+
 func Create(path string) (File, error) {
 	fs := getSingleton()
 	f, err := fs.Create(path)
@@ -94,11 +107,43 @@ func Stat(path string) (os.FileInfo, error) {
 	return fi, err
 }
 
+func Lstat(path string) (os.FileInfo, error) {
+	fs := getSingleton()
+	fi, err := fs.Lstat(path)
+	return fi, err
+}
+
+func Symlink(oldname, newname string) error {
+	fs := getSingleton()
+	return fs.Symlink(oldname, newname)
+}
+
+func Readlink(path string) (string, error) {
+	fs := getSingleton()
+	target, err := fs.Readlink(path)
+	return target, err
+}
+
 func Chtimes(path string, atime time.Time, mtime time.Time) error {
 	fs := getSingleton()
 	return fs.Chtimes(path, atime, mtime)
 }
 
+func Chmod(path string, mode os.FileMode) error {
+	fs := getSingleton()
+	return fs.Chmod(path, mode)
+}
+
+func Chown(path string, uid, gid int) error {
+	fs := getSingleton()
+	return fs.Chown(path, uid, gid)
+}
+
+func Lchown(path string, uid, gid int) error {
+	fs := getSingleton()
+	return fs.Lchown(path, uid, gid)
+}
+
 func IsNotExist(err error) bool {
 	return os.IsNotExist(err)
 }
@@ -0,0 +1,657 @@
+// Package filesystest is a conformance test suite for implementations of
+// filesys.FileSystem. It specifies the behaviour every backend shares with
+// the os package, so a third party backend can certify itself by running
+//
+//	func TestConformance(t *testing.T) {
+//		filesystest.Run(t, func(t *testing.T) (filesys.FileSystem, string) {
+//			return mybackend.New(), "/"
+//		})
+//	}
+package filesystest
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/poppels/filesys"
+)
+
+// Factory returns a new, empty file system for each test, together with
+// the directory that the test may create its files in
+type Factory func(t *testing.T) (fs filesys.FileSystem, dir string)
+
+// Run runs every conformance test against file systems created by factory
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, fs filesys.FileSystem, dir string)
+	}{
+		{"WriteFile", testWriteFile},
+		{"Create", testCreate},
+		{"OpenFile", testOpenFile},
+		{"Seek", testSeek},
+		{"Mkdir", testMkdir},
+		{"MkdirAll", testMkdirAll},
+		{"Remove", testRemove},
+		{"RemoveAll", testRemoveAll},
+		{"Rename", testRename},
+		{"Stat", testStat},
+		{"Symlink", testSymlink},
+		{"Chtimes", testChtimes},
+		{"Chmod", testChmod},
+		{"Chown", testChown},
+		{"ReadDir", testReadDir},
+		{"Readdir", testReaddir},
+		{"Permission", testPermission},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			fs, dir := factory(t)
+			test.fn(t, fs, dir)
+		})
+	}
+}
+
+func testWriteFile(t *testing.T, fs filesys.FileSystem, dir string) {
+	name := path.Join(dir, "a.txt")
+	mustWriteFile(t, fs, name, "Hello world")
+	expectContent(t, fs, name, "Hello world")
+
+	// Existing files are truncated
+	mustWriteFile(t, fs, name, "Bye")
+	expectContent(t, fs, name, "Bye")
+
+	if err := fs.WriteFile(path.Join(dir, "missing/a.txt"), nil, 0666); !fs.IsNotExist(err) {
+		t.Errorf("WriteFile in missing directory: expected IsNotExist, got %v", err)
+	}
+	if _, err := fs.ReadFile(path.Join(dir, "missing.txt")); !fs.IsNotExist(err) {
+		t.Errorf("ReadFile of missing file: expected IsNotExist, got %v", err)
+	}
+	if _, err := fs.ReadFile(dir); err == nil {
+		t.Error("ReadFile of a directory: expected error")
+	}
+}
+
+func testCreate(t *testing.T, fs filesys.FileSystem, dir string) {
+	name := path.Join(dir, "a.txt")
+	mustWriteFile(t, fs, name, "Old content")
+
+	f, err := fs.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("New")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(data) != "New" {
+		t.Errorf("Expected to read back 'New', got '%s'", data)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expectContent(t, fs, name, "New")
+
+	if _, err := fs.Create(path.Join(dir, "missing/a.txt")); !fs.IsNotExist(err) {
+		t.Errorf("Create in missing directory: expected IsNotExist, got %v", err)
+	}
+}
+
+func testOpenFile(t *testing.T, fs filesys.FileSystem, dir string) {
+	name := path.Join(dir, "a.txt")
+	mustWriteFile(t, fs, name, "Hello")
+
+	if _, err := fs.Open(path.Join(dir, "missing.txt")); !fs.IsNotExist(err) {
+		t.Errorf("Open of missing file: expected IsNotExist, got %v", err)
+	}
+	if _, err := fs.OpenFile(path.Join(dir, "missing.txt"), os.O_WRONLY, 0666); !fs.IsNotExist(err) {
+		t.Errorf("OpenFile of missing file without O_CREATE: expected IsNotExist, got %v", err)
+	}
+	if _, err := fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666); !fs.IsExist(err) {
+		t.Errorf("OpenFile with O_EXCL of existing file: expected IsExist, got %v", err)
+	}
+
+	// Read only
+	f := mustOpenFile(t, fs, name, os.O_RDONLY)
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("Write to file opened with O_RDONLY: expected error")
+	}
+	f.Close()
+
+	// Write only, without truncating
+	f = mustOpenFile(t, fs, name, os.O_WRONLY)
+	if _, err := f.Read(make([]byte, 1)); err == nil {
+		t.Error("Read from file opened with O_WRONLY: expected error")
+	}
+	mustWrite(t, f, "J")
+	f.Close()
+	expectContent(t, fs, name, "Jello")
+
+	// Append writes at the end, even after seeking
+	f = mustOpenFile(t, fs, name, os.O_WRONLY|os.O_APPEND)
+	mustWrite(t, f, " world")
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, f, "!")
+	f.Close()
+	expectContent(t, fs, name, "Jello world!")
+
+	// O_CREATE alone keeps the content of existing files
+	f = mustOpenFile(t, fs, name, os.O_RDWR|os.O_CREATE)
+	f.Close()
+	expectContent(t, fs, name, "Jello world!")
+
+	f = mustOpenFile(t, fs, name, os.O_WRONLY|os.O_TRUNC)
+	f.Close()
+	expectContent(t, fs, name, "")
+
+	f = mustOpenFile(t, fs, path.Join(dir, "b.txt"), os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	mustWrite(t, f, "New")
+	f.Close()
+	expectContent(t, fs, path.Join(dir, "b.txt"), "New")
+
+	if _, err := fs.OpenFile(dir, os.O_RDWR, 0); err == nil {
+		t.Error("OpenFile of directory for writing: expected error")
+	}
+}
+
+func testSeek(t *testing.T, fs filesys.FileSystem, dir string) {
+	name := path.Join(dir, "a.txt")
+	f, err := fs.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	mustWrite(t, f, "Hello")
+
+	seeks := []struct {
+		offset   int64
+		whence   int
+		expected int64
+	}{
+		{1, io.SeekStart, 1},
+		{2, io.SeekCurrent, 3},
+		{-1, io.SeekEnd, 4},
+		{3, io.SeekEnd, 8},
+	}
+	for _, s := range seeks {
+		pos, err := f.Seek(s.offset, s.whence)
+		if err != nil {
+			t.Fatal(err)
+		} else if pos != s.expected {
+			t.Errorf("Seek(%d, %d): expected position %d, got %d", s.offset, s.whence, s.expected, pos)
+		}
+	}
+
+	// Writing after the end fills the gap with zeros
+	mustWrite(t, f, "!")
+	expectContent(t, fs, name, "Hello\x00\x00\x00!")
+
+	if _, err := f.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Seek to negative position: expected error")
+	}
+}
+
+func testMkdir(t *testing.T, fs filesys.FileSystem, dir string) {
+	name := path.Join(dir, "a")
+	if err := fs.Mkdir(name, 0777); err != nil {
+		t.Fatal(err)
+	}
+	expectDir(t, fs, name)
+
+	if err := fs.Mkdir(name, 0777); !fs.IsExist(err) {
+		t.Errorf("Mkdir of existing directory: expected IsExist, got %v", err)
+	}
+	mustWriteFile(t, fs, path.Join(name, "b.txt"), "Hello")
+	if err := fs.Mkdir(path.Join(name, "b.txt"), 0777); !fs.IsExist(err) {
+		t.Errorf("Mkdir of existing file: expected IsExist, got %v", err)
+	}
+	expectContent(t, fs, path.Join(name, "b.txt"), "Hello")
+	if err := fs.Mkdir(path.Join(dir, "missing/a"), 0777); !fs.IsNotExist(err) {
+		t.Errorf("Mkdir in missing directory: expected IsNotExist, got %v", err)
+	}
+}
+
+func testMkdirAll(t *testing.T, fs filesys.FileSystem, dir string) {
+	name := path.Join(dir, "a/b/c")
+	if err := fs.MkdirAll(name, 0777); err != nil {
+		t.Fatal(err)
+	}
+	expectDir(t, fs, path.Join(dir, "a/b"))
+	expectDir(t, fs, name)
+
+	// Existing directories are fine
+	mustWriteFile(t, fs, path.Join(name, "d.txt"), "Hello")
+	if err := fs.MkdirAll(path.Join(dir, "a/b"), 0777); err != nil {
+		t.Errorf("MkdirAll of existing directory: %v", err)
+	}
+	expectContent(t, fs, path.Join(name, "d.txt"), "Hello")
+
+	if err := fs.MkdirAll(path.Join(name, "d.txt"), 0777); err == nil {
+		t.Error("MkdirAll over existing file: expected error")
+	}
+	if err := fs.MkdirAll(path.Join(name, "d.txt/e"), 0777); err == nil {
+		t.Error("MkdirAll below existing file: expected error")
+	}
+}
+
+func testRemove(t *testing.T, fs filesys.FileSystem, dir string) {
+	mustWriteFile(t, fs, path.Join(dir, "a.txt"), "Hello")
+	mustMkdirAll(t, fs, path.Join(dir, "empty"))
+	mustMkdirAll(t, fs, path.Join(dir, "full"))
+	mustWriteFile(t, fs, path.Join(dir, "full/b.txt"), "Hello")
+
+	for _, name := range []string{"a.txt", "empty"} {
+		if err := fs.Remove(path.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+		expectMissing(t, fs, path.Join(dir, name))
+	}
+	if err := fs.Remove(path.Join(dir, "full")); err == nil {
+		t.Error("Remove of non-empty directory: expected error")
+	}
+	expectContent(t, fs, path.Join(dir, "full/b.txt"), "Hello")
+	if err := fs.Remove(path.Join(dir, "missing")); !fs.IsNotExist(err) {
+		t.Errorf("Remove of missing file: expected IsNotExist, got %v", err)
+	}
+}
+
+func testRemoveAll(t *testing.T, fs filesys.FileSystem, dir string) {
+	mustMkdirAll(t, fs, path.Join(dir, "a/b/c"))
+	mustWriteFile(t, fs, path.Join(dir, "a/b/d.txt"), "Hello")
+	mustWriteFile(t, fs, path.Join(dir, "e.txt"), "Hello")
+
+	if err := fs.RemoveAll(path.Join(dir, "a")); err != nil {
+		t.Fatal(err)
+	}
+	expectMissing(t, fs, path.Join(dir, "a"))
+	if err := fs.RemoveAll(path.Join(dir, "e.txt")); err != nil {
+		t.Fatal(err)
+	}
+	expectMissing(t, fs, path.Join(dir, "e.txt"))
+
+	// Removing something that doesn't exist is not an error
+	if err := fs.RemoveAll(path.Join(dir, "missing")); err != nil {
+		t.Errorf("RemoveAll of missing path: expected no error, got %v", err)
+	}
+}
+
+func testRename(t *testing.T, fs filesys.FileSystem, dir string) {
+	mustWriteFile(t, fs, path.Join(dir, "a.txt"), "A")
+	mustWriteFile(t, fs, path.Join(dir, "b.txt"), "B")
+	mustMkdirAll(t, fs, path.Join(dir, "d/e"))
+	mustWriteFile(t, fs, path.Join(dir, "d/e/f.txt"), "F")
+
+	if err := fs.Rename(path.Join(dir, "a.txt"), path.Join(dir, "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+	expectMissing(t, fs, path.Join(dir, "a.txt"))
+	expectContent(t, fs, path.Join(dir, "c.txt"), "A")
+
+	// Files are replaced
+	if err := fs.Rename(path.Join(dir, "c.txt"), path.Join(dir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	expectContent(t, fs, path.Join(dir, "b.txt"), "A")
+
+	// Directories are moved with their contents
+	if err := fs.Rename(path.Join(dir, "d"), path.Join(dir, "g")); err != nil {
+		t.Fatal(err)
+	}
+	expectMissing(t, fs, path.Join(dir, "d"))
+	expectContent(t, fs, path.Join(dir, "g/e/f.txt"), "F")
+
+	if err := fs.Rename(path.Join(dir, "missing"), path.Join(dir, "h")); !fs.IsNotExist(err) {
+		t.Errorf("Rename of missing file: expected IsNotExist, got %v", err)
+	}
+	if err := fs.Rename(path.Join(dir, "b.txt"), path.Join(dir, "missing/b.txt")); !fs.IsNotExist(err) {
+		t.Errorf("Rename into missing directory: expected IsNotExist, got %v", err)
+	}
+	if err := fs.Rename(path.Join(dir, "g"), path.Join(dir, "g/e/g")); err == nil {
+		t.Error("Rename of directory into itself: expected error")
+	}
+	if err := fs.Rename(path.Join(dir, "b.txt"), path.Join(dir, "g")); err == nil {
+		t.Error("Rename of file over non-empty directory: expected error")
+	}
+}
+
+func testStat(t *testing.T, fs filesys.FileSystem, dir string) {
+	mustWriteFile(t, fs, path.Join(dir, "a.txt"), "Hello")
+	mustMkdirAll(t, fs, path.Join(dir, "b"))
+
+	fi, err := fs.Stat(path.Join(dir, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Name() != "a.txt" || fi.Size() != 5 || fi.IsDir() || !fi.Mode().IsRegular() {
+		t.Errorf("Unexpected file info for a.txt: %s %d %s", fi.Name(), fi.Size(), fi.Mode())
+	}
+	fi, err = fs.Stat(path.Join(dir, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Name() != "b" || !fi.IsDir() || !fi.Mode().IsDir() {
+		t.Errorf("Unexpected file info for b: %s %s", fi.Name(), fi.Mode())
+	}
+	if _, err := fs.Stat(path.Join(dir, "missing")); !fs.IsNotExist(err) {
+		t.Errorf("Stat of missing file: expected IsNotExist, got %v", err)
+	}
+	if fi, err := fs.Stat(dir); err != nil || !fi.IsDir() {
+		t.Errorf("Stat of the test directory: %v", err)
+	}
+
+	f := mustOpenFile(t, fs, path.Join(dir, "a.txt"), os.O_RDONLY)
+	defer f.Close()
+	fi, err = f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	} else if fi.Name() != "a.txt" || fi.Size() != 5 {
+		t.Errorf("Unexpected file info from open file: %s %d", fi.Name(), fi.Size())
+	}
+}
+
+func testSymlink(t *testing.T, fs filesys.FileSystem, dir string) {
+	mustMkdirAll(t, fs, path.Join(dir, "a"))
+	mustWriteFile(t, fs, path.Join(dir, "a/b.txt"), "Hello")
+
+	if err := fs.Symlink("a/b.txt", path.Join(dir, "link")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	if err := fs.Symlink("a", path.Join(dir, "dirlink")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Symlink("missing", path.Join(dir, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	expectContent(t, fs, path.Join(dir, "link"), "Hello")
+	expectContent(t, fs, path.Join(dir, "dirlink/b.txt"), "Hello")
+
+	fi, err := fs.Lstat(path.Join(dir, "link"))
+	if err != nil {
+		t.Fatal(err)
+	} else if fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat of link: expected symlink mode, got %s", fi.Mode())
+	}
+	fi, err = fs.Stat(path.Join(dir, "link"))
+	if err != nil {
+		t.Fatal(err)
+	} else if !fi.Mode().IsRegular() {
+		t.Errorf("Stat of link: expected regular file, got %s", fi.Mode())
+	}
+	fi, err = fs.Lstat(path.Join(dir, "a/b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	} else if !fi.Mode().IsRegular() {
+		t.Errorf("Lstat of file: expected regular file, got %s", fi.Mode())
+	}
+
+	target, err := fs.Readlink(path.Join(dir, "link"))
+	if err != nil {
+		t.Fatal(err)
+	} else if target != "a/b.txt" {
+		t.Errorf("Readlink: expected 'a/b.txt', got '%s'", target)
+	}
+	if _, err := fs.Readlink(path.Join(dir, "a/b.txt")); err == nil {
+		t.Error("Readlink of regular file: expected error")
+	}
+	if _, err := fs.Readlink(path.Join(dir, "missing")); !fs.IsNotExist(err) {
+		t.Errorf("Readlink of missing file: expected IsNotExist, got %v", err)
+	}
+
+	if _, err := fs.Stat(path.Join(dir, "dangling")); !fs.IsNotExist(err) {
+		t.Errorf("Stat of dangling link: expected IsNotExist, got %v", err)
+	}
+	if _, err := fs.Lstat(path.Join(dir, "dangling")); err != nil {
+		t.Errorf("Lstat of dangling link: %v", err)
+	}
+	if err := fs.Symlink("a", path.Join(dir, "link")); !fs.IsExist(err) {
+		t.Errorf("Symlink over existing file: expected IsExist, got %v", err)
+	}
+
+	// Removing a link doesn't touch its target
+	if err := fs.Remove(path.Join(dir, "dirlink")); err != nil {
+		t.Fatal(err)
+	}
+	expectContent(t, fs, path.Join(dir, "a/b.txt"), "Hello")
+}
+
+func testChtimes(t *testing.T, fs filesys.FileSystem, dir string) {
+	name := path.Join(dir, "a.txt")
+	mustWriteFile(t, fs, name, "Hello")
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err := fs.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := fs.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	} else if !fi.ModTime().Equal(mtime) {
+		t.Errorf("Expected modification time %s, got %s", mtime, fi.ModTime())
+	}
+	if err := fs.Chtimes(path.Join(dir, "missing"), mtime, mtime); !fs.IsNotExist(err) {
+		t.Errorf("Chtimes of missing file: expected IsNotExist, got %v", err)
+	}
+}
+
+func testChmod(t *testing.T, fs filesys.FileSystem, dir string) {
+	name := path.Join(dir, "a.txt")
+	mustWriteFile(t, fs, name, "Hello")
+	for _, mode := range []os.FileMode{0600, 0644, 0755} {
+		if err := fs.Chmod(name, mode); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := fs.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		} else if fi.Mode().Perm() != mode {
+			t.Errorf("Expected mode %s, got %s", mode, fi.Mode().Perm())
+		}
+	}
+	if err := fs.Chmod(path.Join(dir, "missing"), 0644); !fs.IsNotExist(err) {
+		t.Errorf("Chmod of missing file: expected IsNotExist, got %v", err)
+	}
+}
+
+func testChown(t *testing.T, fs filesys.FileSystem, dir string) {
+	name := path.Join(dir, "a.txt")
+	mustWriteFile(t, fs, name, "Hello")
+
+	// Everyone is allowed to keep the current owner and group
+	if err := fs.Chown(name, -1, -1); err != nil {
+		t.Errorf("Chown without changes: %v", err)
+	}
+	if err := fs.Lchown(name, -1, -1); err != nil {
+		t.Errorf("Lchown without changes: %v", err)
+	}
+	if err := fs.Chown(path.Join(dir, "missing"), -1, -1); !fs.IsNotExist(err) {
+		t.Errorf("Chown of missing file: expected IsNotExist, got %v", err)
+	}
+}
+
+func testReadDir(t *testing.T, fs filesys.FileSystem, dir string) {
+	mustMkdirAll(t, fs, path.Join(dir, "a/c"))
+	mustWriteFile(t, fs, path.Join(dir, "a/b.txt"), "Hello")
+	mustWriteFile(t, fs, path.Join(dir, "a/Z.txt"), "Hello")
+
+	infos, err := fs.ReadDir(path.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNames(t, infos, "Z.txt", "b.txt", "c")
+	if len(infos) == 3 && (!infos[2].IsDir() || infos[1].Size() != 5) {
+		t.Error("Unexpected file info from ReadDir")
+	}
+
+	if _, err := fs.ReadDir(path.Join(dir, "missing")); !fs.IsNotExist(err) {
+		t.Errorf("ReadDir of missing directory: expected IsNotExist, got %v", err)
+	}
+	if _, err := fs.ReadDir(path.Join(dir, "a/b.txt")); err == nil {
+		t.Error("ReadDir of file: expected error")
+	}
+}
+
+func testReaddir(t *testing.T, fs filesys.FileSystem, dir string) {
+	mustMkdirAll(t, fs, path.Join(dir, "a/c"))
+	mustWriteFile(t, fs, path.Join(dir, "a/b.txt"), "Hello")
+	mustWriteFile(t, fs, path.Join(dir, "a/d.txt"), "Hello")
+
+	f := mustOpenFile(t, fs, path.Join(dir, "a"), os.O_RDONLY)
+	defer f.Close()
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortInfos(infos)
+	expectNames(t, infos, "b.txt", "c", "d.txt")
+
+	// Read in batches until io.EOF
+	f2 := mustOpenFile(t, fs, path.Join(dir, "a"), os.O_RDONLY)
+	defer f2.Close()
+	var all []os.FileInfo
+	for i := 0; i < 10; i++ {
+		infos, err := f2.Readdir(2)
+		if len(infos) > 2 {
+			t.Fatalf("Readdir(2) returned %d entries", len(infos))
+		}
+		all = append(all, infos...)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sortInfos(all)
+	expectNames(t, all, "b.txt", "c", "d.txt")
+
+	f3 := mustOpenFile(t, fs, path.Join(dir, "a/b.txt"), os.O_RDONLY)
+	defer f3.Close()
+	if _, err := f3.Readdir(-1); err == nil {
+		t.Error("Readdir of file: expected error")
+	}
+}
+
+func testPermission(t *testing.T, fs filesys.FileSystem, dir string) {
+	name := path.Join(dir, "a.txt")
+	mustWriteFile(t, fs, name, "Hello")
+	if err := fs.Chmod(name, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Chmod(name, 0644)
+	if _, err := fs.ReadFile(name); err == nil {
+		t.Skip("Backend does not enforce permissions, for example when running as root")
+	} else if !fs.IsPermission(err) {
+		t.Errorf("ReadFile without read permission: expected IsPermission, got %v", err)
+	}
+	if err := fs.WriteFile(name, []byte("Bye"), 0666); !fs.IsPermission(err) {
+		t.Errorf("WriteFile without write permission: expected IsPermission, got %v", err)
+	}
+	if _, err := fs.Open(name); !fs.IsPermission(err) {
+		t.Errorf("Open without read permission: expected IsPermission, got %v", err)
+	}
+
+	sub := path.Join(dir, "sub")
+	mustMkdirAll(t, fs, sub)
+	if err := fs.Chmod(sub, 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Chmod(sub, 0755)
+	if err := fs.WriteFile(path.Join(sub, "b.txt"), nil, 0666); !fs.IsPermission(err) {
+		t.Errorf("WriteFile in read only directory: expected IsPermission, got %v", err)
+	}
+	if err := fs.Mkdir(path.Join(sub, "c"), 0777); !fs.IsPermission(err) {
+		t.Errorf("Mkdir in read only directory: expected IsPermission, got %v", err)
+	}
+}
+
+func mustWriteFile(t *testing.T, fs filesys.FileSystem, name, content string) {
+	t.Helper()
+	if err := fs.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustMkdirAll(t *testing.T, fs filesys.FileSystem, name string) {
+	t.Helper()
+	if err := fs.MkdirAll(name, 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustOpenFile(t *testing.T, fs filesys.FileSystem, name string, flag int) filesys.File {
+	t.Helper()
+	f, err := fs.OpenFile(name, flag, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func mustWrite(t *testing.T, f filesys.File, content string) {
+	t.Helper()
+	if n, err := f.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	} else if n != len(content) {
+		t.Fatalf("Expected to write %d bytes, wrote %d", len(content), n)
+	}
+}
+
+func expectContent(t *testing.T, fs filesys.FileSystem, name, content string) {
+	t.Helper()
+	data, err := fs.ReadFile(name)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(data, []byte(content)) {
+		t.Errorf("Expected %s to contain %q, got %q", name, content, data)
+	}
+}
+
+func expectDir(t *testing.T, fs filesys.FileSystem, name string) {
+	t.Helper()
+	fi, err := fs.Stat(name)
+	if err != nil {
+		t.Error(err)
+	} else if !fi.IsDir() {
+		t.Errorf("Expected %s to be a directory", name)
+	}
+}
+
+func expectMissing(t *testing.T, fs filesys.FileSystem, name string) {
+	t.Helper()
+	if _, err := fs.Lstat(name); !fs.IsNotExist(err) {
+		t.Errorf("Expected %s to be missing, got %v", name, err)
+	}
+}
+
+func expectNames(t *testing.T, infos []os.FileInfo, names ...string) {
+	t.Helper()
+	if len(infos) != len(names) {
+		t.Errorf("Expected %d entries, got %d", len(names), len(infos))
+		return
+	}
+	for i, info := range infos {
+		if info.Name() != names[i] {
+			t.Errorf("Expected entry %d to be %s, got %s", i, names[i], info.Name())
+		}
+	}
+}
+
+// sortInfos sorts by name, since Readdir returns entries in directory order
+func sortInfos(infos []os.FileInfo) {
+	for i := 1; i < len(infos); i++ {
+		for j := i; j > 0 && infos[j].Name() < infos[j-1].Name(); j-- {
+			infos[j], infos[j-1] = infos[j-1], infos[j]
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package fsutil
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/internal/links"
+)
+
+// OverwritePolicy decides what happens when a file is copied to a name
+// that already exists
+type OverwritePolicy int
+
+const (
+	// FailIfExists returns an error that satisfies IsExist. It's the default.
+	FailIfExists OverwritePolicy = iota
+	// Overwrite replaces the existing file
+	Overwrite
+	// OverwriteOlder only replaces the existing file if the copied file
+	// has a newer modification time, and skips it otherwise
+	OverwriteOlder
+	// SkipExisting keeps the existing file
+	SkipExisting
+)
+
+// CopyOptions changes how Copy, CopyTree and Move copy files
+type CopyOptions struct {
+	// Overwrite decides what happens with files that already exist.
+	// Directories that already exist are always merged.
+	Overwrite OverwritePolicy
+	// Filter is called with the source path of every entry below the
+	// copied directory, and skips the entry, with its contents, if it
+	// returns false
+	Filter func(name string, fi os.FileInfo) bool
+	// Progress is called with the source path of a file when copying it
+	// starts and after every chunk of data, with the bytes copied so far
+	// and the size
+	Progress func(name string, copied, size int64)
+	// FollowSymlinks copies what links point to instead of the links
+	FollowSymlinks bool
+}
+
+// copyBufferSize is the size of the chunks that files are copied in
+const copyBufferSize = 32 * 1024
+
+// Copy copies the file srcName of src to dstName of dst, which can be
+// another backend. The contents are streamed, the mode and times are
+// preserved, and links are copied as links unless FollowSymlinks is set.
+// Directories can't be copied with Copy, see CopyTree. A file can't be
+// copied to itself.
+func Copy(dst filesys.FileSystem, dstName string, src filesys.FileSystem, srcName string, opts CopyOptions) error {
+	if _, err := checkOverlap(dst, dstName, src, srcName); err != nil {
+		return err
+	}
+	c := newCopier(dst, src, opts)
+	fi, err := src.Lstat(srcName)
+	if err != nil {
+		return err
+	}
+	return c.entry(dstName, srcName, fi, false)
+}
+
+// CopyTree copies the directory srcDir of src with all of its contents to
+// dstDir of dst, like Copy does for files. If dstDir exists, the contents
+// are merged into it. A link as srcDir is always followed. Within the same
+// FileSystem, dstDir can't be srcDir or below it, like with cp.
+func CopyTree(dst filesys.FileSystem, dstDir string, src filesys.FileSystem, srcDir string, opts CopyOptions) error {
+	real, err := checkOverlap(dst, dstDir, src, srcDir)
+	if err != nil {
+		return err
+	}
+	c := newCopier(dst, src, opts)
+	c.dstReal = real
+	fi, err := src.Stat(srcDir)
+	if err != nil {
+		return err
+	}
+	return c.entry(dstDir, srcDir, fi, true)
+}
+
+// Move moves the file or directory srcName of src to dstName of dst. Within
+// the same FileSystem it's renamed if possible, otherwise it's copied like
+// CopyTree does, and everything that was copied is removed from src. Files
+// that are skipped by the options, and their directories, stay in src.
+// Like with CopyTree, dstName can't be srcName or below it.
+func Move(dst filesys.FileSystem, dstName string, src filesys.FileSystem, srcName string, opts CopyOptions) error {
+	real, err := checkOverlap(dst, dstName, src, srcName)
+	if err != nil {
+		return err
+	}
+	fi, err := src.Lstat(srcName)
+	if err != nil {
+		return err
+	}
+	if sameFileSystem(dst, src) && opts.Filter == nil && !opts.FollowSymlinks {
+		_, err := dst.Lstat(dstName)
+		if dst.IsNotExist(err) || err == nil && opts.Overwrite == Overwrite && !fi.IsDir() {
+			err := src.Rename(srcName, dstName)
+			if !errors.Is(err, syscall.EXDEV) {
+				return err
+			}
+			// Different devices of the os package, or mounts of a mount table
+		}
+	}
+
+	c := newCopier(dst, src, opts)
+	c.dstReal = real
+	if err := c.entry(dstName, srcName, fi, true); err != nil {
+		return err
+	}
+	for _, name := range c.copied {
+		// Directories with skipped files aren't empty
+		if err := src.Remove(name); err != nil && !src.IsExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameFileSystem reports whether a and b are the same file system, also
+// for implementations that can't be compared with ==
+func sameFileSystem(a, b filesys.FileSystem) bool {
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+// checkOverlap returns EINVAL if dstName is srcName or below it within the
+// same FileSystem, also through links, since the copy would replace the
+// source or never end. Otherwise it returns the path of dstName without
+// links, or "" for another FileSystem.
+func checkOverlap(dst filesys.FileSystem, dstName string, src filesys.FileSystem, srcName string) (string, error) {
+	if !sameFileSystem(dst, src) {
+		return "", nil
+	}
+	d, s := realPath(dst, dstName), realPath(src, srcName)
+	if d == s || strings.HasPrefix(d, strings.TrimSuffix(s, "/")+"/") {
+		return "", &os.LinkError{"copy", srcName, dstName, syscall.EINVAL}
+	}
+	return d, nil
+}
+
+// realPath returns name with the links in it resolved, as far as it exists
+func realPath(fs filesys.FileSystem, name string) string {
+	real, err := links.Resolver{FS: fs}.Resolve("copy", name, true)
+	if err != nil {
+		// Too many links, which the copy will fail on
+		return path.Clean(name)
+	}
+	return real
+}
+
+type copier struct {
+	dst, src filesys.FileSystem
+	opts     CopyOptions
+	buf      []byte
+	// copied are the source paths that were copied, with the contents of
+	// directories before the directories, so Move can remove them
+	copied []string
+	// dstReal is the destination without links, within the same
+	// FileSystem, which is never copied into itself
+	dstReal string
+}
+
+func newCopier(dst, src filesys.FileSystem, opts CopyOptions) *copier {
+	return &copier{dst: dst, src: src, opts: opts, buf: make([]byte, copyBufferSize)}
+}
+
+func (c *copier) entry(dstName, srcName string, fi os.FileInfo, recursive bool) error {
+	if fi.Mode()&os.ModeSymlink != 0 && c.opts.FollowSymlinks {
+		var err error
+		if fi, err = c.src.Stat(srcName); err != nil {
+			return err
+		}
+	}
+	var err error
+	switch {
+	case fi.IsDir() && recursive:
+		err = c.dir(dstName, srcName, fi)
+	case fi.IsDir():
+		return &os.PathError{"copy", srcName, syscall.EISDIR}
+	case fi.Mode()&os.ModeSymlink != 0:
+		err = c.link(dstName, srcName, fi)
+	case fi.Mode().IsRegular():
+		err = c.file(dstName, srcName, fi)
+	default:
+		// Devices, sockets and pipes can't be copied
+		return &os.PathError{"copy", srcName, errors.ErrUnsupported}
+	}
+	if err == errSkipped {
+		return nil
+	}
+	if err == nil {
+		c.copied = append(c.copied, srcName)
+	}
+	return err
+}
+
+// errSkipped is returned for files that are skipped because they exist
+var errSkipped = errors.New("skipped")
+
+func (c *copier) dir(dstName, srcName string, fi os.FileInfo) error {
+	existing, err := c.dst.Lstat(dstName)
+	switch {
+	case c.dst.IsNotExist(err):
+		// Writable until the contents are copied
+		if err := c.dst.Mkdir(dstName, 0700); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case !existing.IsDir():
+		return &os.PathError{"copy", dstName, syscall.ENOTDIR}
+	}
+
+	infos, err := c.src.ReadDir(srcName)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		child := path.Join(srcName, info.Name())
+		if c.opts.Filter != nil && !c.opts.Filter(child, info) {
+			continue
+		}
+		descends := info.IsDir() || info.Mode()&os.ModeSymlink != 0 && c.opts.FollowSymlinks
+		if c.dstReal != "" && descends && realPath(c.src, child) == c.dstReal {
+			// A followed link to the destination, or the destination itself
+			continue
+		}
+		if err := c.entry(path.Join(dstName, info.Name()), child, info, true); err != nil {
+			return err
+		}
+	}
+	return c.attributes(dstName, fi)
+}
+
+func (c *copier) link(dstName, srcName string, fi os.FileInfo) error {
+	target, err := c.src.Readlink(srcName)
+	if err != nil {
+		return err
+	}
+	if err := c.replace(dstName, fi); err != nil {
+		return err
+	}
+	return c.dst.Symlink(target, dstName)
+}
+
+func (c *copier) file(dstName, srcName string, fi os.FileInfo) error {
+	if err := c.replace(dstName, fi); err != nil {
+		return err
+	}
+	in, err := c.src.Open(srcName)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// Writable until the contents are copied
+	out, err := c.dst.OpenFile(dstName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = out
+	if c.opts.Progress != nil {
+		c.opts.Progress(srcName, 0, fi.Size())
+		w = &progressWriter{w: out, name: srcName, size: fi.Size(), progress: c.opts.Progress}
+	}
+	if _, err := io.CopyBuffer(w, in, c.buf); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return c.attributes(dstName, fi)
+}
+
+// replace decides with the overwrite policy whether dstName can be
+// replaced by a copy of a file, and removes it if so
+func (c *copier) replace(dstName string, fi os.FileInfo) error {
+	existing, err := c.dst.Lstat(dstName)
+	if c.dst.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch c.opts.Overwrite {
+	case FailIfExists:
+		return &os.PathError{"copy", dstName, os.ErrExist}
+	case SkipExisting:
+		return errSkipped
+	case OverwriteOlder:
+		if !fi.ModTime().After(existing.ModTime()) {
+			return errSkipped
+		}
+	}
+	if existing.IsDir() {
+		return &os.PathError{"copy", dstName, syscall.EISDIR}
+	}
+	// Replacing the file, instead of writing to it, also works for
+	// read-only files and doesn't write through links
+	return c.dst.Remove(dstName)
+}
+
+// attributes sets the mode and times of a copy
+func (c *copier) attributes(name string, fi os.FileInfo) error {
+	if err := c.dst.Chmod(name, fi.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	atime := filesys.Times(fi).AccessTime
+	if atime.IsZero() {
+		atime = fi.ModTime()
+	}
+	return c.dst.Chtimes(name, atime, fi.ModTime())
+}
+
+type progressWriter struct {
+	w        io.Writer
+	name     string
+	copied   int64
+	size     int64
+	progress func(name string, copied, size int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.copied += int64(n)
+	p.progress(p.name, p.copied, p.size)
+	return n, err
+}
@@ -0,0 +1,205 @@
+package fsutil
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/poppels/filesys/osfilesys"
+	"github.com/poppels/filesys/virtual"
+)
+
+func copyFixture() *virtual.VirtualFileSystem {
+	mtime := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	fs := virtual.NewVirtualFilesysWithClock(virtual.FixedClock(mtime))
+	CreateStructure(fs, map[string][]byte{
+		"/src/a.txt":        []byte("Hello"),
+		"/src/b/c.txt":      []byte("Bye"),
+		"/src/b/d/e.bin":    bytes.Repeat([]byte{1, 2, 3}, 50000),
+		"/src/skip/x.tmp":   []byte("x"),
+		"/src/b/ignore.tmp": []byte("tmp")}, []string{"/src/empty"})
+	fs.Symlink("../a.txt", "/src/b/link")
+	fs.Chmod("/src/b/c.txt", 0600)
+	fs.Chmod("/src/b/d", 0500)
+	fs.Chtimes("/src/a.txt", mtime.Add(-time.Hour), mtime.Add(-time.Hour))
+	return fs
+}
+
+func TestCopyTree(t *testing.T) {
+	src := copyFixture()
+	dst := virtual.NewVirtualFilesys()
+	if err := CopyTree(dst, "/dst", src, "/src", CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	AssertEqualTrees(t, src, dst, "/src", "/dst", DiffOptions{})
+
+	// Across backends and back
+	dir := t.TempDir()
+	osfs := osfilesys.NewOsWrapper()
+	// The copy of a read-only directory must be writable to be cleaned up
+	t.Cleanup(func() { osfs.Chmod(dir+"/tree/b/d", 0700) })
+	if err := CopyTree(osfs, dir+"/tree", src, "/src", CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	back := virtual.NewVirtualFilesys()
+	if err := CopyTree(back, "/back", osfs, dir+"/tree", CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	AssertEqualTrees(t, src, back, "/src", "/back", DiffOptions{IgnoreModes: os.PathSeparator != '/'})
+}
+
+func TestCopyOptions(t *testing.T) {
+	src := copyFixture()
+	dst := virtual.NewVirtualFilesys()
+	PutFile(dst, "/dst/a.txt", []byte("Existing"))
+
+	err := CopyTree(dst, "/dst", src, "/src", CopyOptions{})
+	if !dst.IsExist(err) {
+		t.Fatalf("Expected an error for the existing file, got %v", err)
+	}
+
+	var progress []string
+	opts := CopyOptions{
+		Overwrite: SkipExisting,
+		Filter: func(name string, fi os.FileInfo) bool {
+			return !strings.HasSuffix(name, ".tmp") && fi.Name() != "skip"
+		},
+		Progress: func(name string, copied, size int64) {
+			if name == "/src/b/d/e.bin" {
+				progress = append(progress, strings.Repeat("#", int(copied*10/size)))
+			}
+		}}
+	if err := CopyTree(dst, "/dst", src, "/src", opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFileContent(dst, "/dst/a.txt", []byte("Existing")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/dst/skip", "/dst/b/ignore.tmp"} {
+		if _, err := dst.Lstat(name); !dst.IsNotExist(err) {
+			t.Fatalf("Expected %s to be filtered out, got %v", name, err)
+		}
+	}
+	// 150000 bytes are copied in 5 chunks
+	if len(progress) != 6 || progress[0] != "" || progress[5] != "##########" {
+		t.Fatalf("Unexpected progress %v", progress)
+	}
+
+	// The existing file is newer
+	opts = CopyOptions{Overwrite: OverwriteOlder}
+	if err := Copy(dst, "/dst/a.txt", src, "/src/a.txt", opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFileContent(dst, "/dst/a.txt", []byte("Existing")); err != nil {
+		t.Fatal(err)
+	}
+	opts.Overwrite = Overwrite
+	if err := Copy(dst, "/dst/a.txt", src, "/src/a.txt", opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFileContent(dst, "/dst/a.txt", []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.FollowSymlinks = true
+	if err := Copy(dst, "/dst/b/link", src, "/src/b/link", opts); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := dst.Lstat("/dst/b/link"); err != nil || !fi.Mode().IsRegular() {
+		t.Fatalf("Expected the link to be copied as a file, got %v", err)
+	}
+	if err := Copy(dst, "/dst/dir", src, "/src/b", opts); err == nil {
+		t.Fatal("Expected an error for copying a directory")
+	}
+}
+
+func TestMove(t *testing.T) {
+	fs := copyFixture()
+	if err := Move(fs, "/moved", fs, "/src/b", CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Lstat("/src/b"); !fs.IsNotExist(err) {
+		t.Fatalf("Expected the directory to be renamed, got %v", err)
+	}
+
+	dst := virtual.NewVirtualFilesys()
+	opts := CopyOptions{Filter: func(name string, fi os.FileInfo) bool { return !strings.HasSuffix(name, ".tmp") }}
+	if err := Move(dst, "/dst", fs, "/src", opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFileContent(dst, "/dst/a.txt", []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+	// Only the filtered file and its directories are left
+	names, _ := Glob(fs, "/src/**")
+	if strings.Join(names, " ") != "/src /src/skip /src/skip/x.tmp" {
+		t.Fatalf("Unexpected files left after moving: %v", names)
+	}
+}
+
+func TestCopyOverlap(t *testing.T) {
+	fs := copyFixture()
+	other := copyFixture()
+
+	for _, err := range []error{
+		Copy(fs, "/src/a.txt", fs, "/src/./a.txt", CopyOptions{Overwrite: Overwrite}),
+		CopyTree(fs, "/src", fs, "/src/", CopyOptions{}),
+		CopyTree(fs, "/src/b/copy", fs, "/src", CopyOptions{}),
+		CopyTree(fs, "/src/copy", fs, "/", CopyOptions{}),
+		Move(fs, "/src/b/moved", fs, "/src", CopyOptions{}),
+	} {
+		if !errors.Is(err, syscall.EINVAL) {
+			t.Errorf("Expected EINVAL, got %v", err)
+		}
+	}
+	if err := VerifyFileContent(fs, "/src/a.txt", []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+	AssertEqualTrees(t, other, fs, "/", "/", DiffOptions{})
+
+	// A sibling with the same prefix, and another FileSystem, are fine
+	if err := CopyTree(fs, "/src2", fs, "/src", CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CopyTree(fs, "/src/b/copy", other, "/src", CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyOverlapLinks(t *testing.T) {
+	fs := copyFixture()
+	if err := fs.Symlink("/src", "/linked"); err != nil {
+		t.Fatal(err)
+	}
+	other := copyFixture()
+	other.Symlink("/src", "/linked")
+
+	for _, err := range []error{
+		CopyTree(fs, "/linked/sub", fs, "/src", CopyOptions{}),
+		CopyTree(fs, "/src/sub", fs, "/linked", CopyOptions{}),
+		Move(fs, "/linked/sub", fs, "/src", CopyOptions{}),
+	} {
+		if !errors.Is(err, syscall.EINVAL) {
+			t.Errorf("Expected EINVAL, got %v", err)
+		}
+	}
+	AssertEqualTrees(t, other, fs, "/", "/", DiffOptions{})
+
+	// A followed link in the source to the destination isn't copied into it
+	if err := fs.Symlink("/out", "/src/out"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CopyTree(fs, "/out", fs, "/src", CopyOptions{FollowSymlinks: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Lstat("/out/out"); !fs.IsNotExist(err) {
+		t.Errorf("Expected the link to the destination to be skipped, got %v", err)
+	}
+	if err := VerifyFileContent(fs, "/out/a.txt", []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,245 @@
+package fsutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/poppels/filesys"
+)
+
+// ChangeKind is the kind of a difference between two trees
+type ChangeKind int
+
+const (
+	// Added entries only exist in the second tree
+	Added ChangeKind = iota
+	// Removed entries only exist in the first tree
+	Removed
+	// TypeChanged entries are of different types, like a file and a directory
+	TypeChanged
+	// ModeChanged entries have different permissions
+	ModeChanged
+	// ModTimeChanged entries have different modification times
+	ModTimeChanged
+	// ContentChanged files have different contents, or links different targets
+	ContentChanged
+)
+
+var changeKindNames = [...]string{"added", "removed", "type changed", "mode changed", "modification time changed", "content changed"}
+
+func (k ChangeKind) String() string {
+	if k < 0 || int(k) >= len(changeKindNames) {
+		return fmt.Sprintf("ChangeKind(%d)", int(k))
+	}
+	return changeKindNames[k]
+}
+
+// Change is a difference between two trees. Path is relative to the roots
+// of the trees. Detail shows the old and the new value, or for changed
+// contents a unified diff, of the lines of text files or of a hexdump of
+// binary files.
+type Change struct {
+	Path   string
+	Kind   ChangeKind
+	Detail string
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Detail == "":
+		return fmt.Sprintf("%s %s", c.Kind, c.Path)
+	case strings.Contains(c.Detail, "\n"):
+		return fmt.Sprintf("%s %s:\n%s", c.Kind, c.Path, c.Detail)
+	}
+	return fmt.Sprintf("%s %s: %s", c.Kind, c.Path, c.Detail)
+}
+
+// DiffOptions selects what Diff compares. The zero value compares everything.
+type DiffOptions struct {
+	// IgnoreModes skips comparing permissions
+	IgnoreModes bool
+	// IgnoreModTimes skips comparing modification times, which differ
+	// between trees unless they were copied with their times
+	IgnoreModTimes bool
+	// ModTimePrecision is the largest difference between modification
+	// times that are considered equal, for backends that round them
+	ModTimePrecision time.Duration
+}
+
+// Diff compares the tree below rootA of a with the tree below rootB of b,
+// and returns the differences in lexical order of their paths. Entries
+// that were added, removed or changed type are reported without their
+// contents. Symbolic links are compared by their targets, and their
+// modification times are ignored.
+func Diff(a, b filesys.FileSystem, rootA, rootB string, opts DiffOptions) ([]Change, error) {
+	d := &treeDiff{a: a, b: b, rootA: rootA, rootB: rootB, opts: opts}
+	if err := d.dir(""); err != nil {
+		return nil, err
+	}
+	return d.changes, nil
+}
+
+// AssertEqualTrees fails the test if the tree below rootB of b differs
+// from the tree below rootA of a, and lists all differences
+func AssertEqualTrees(t testing.TB, a, b filesys.FileSystem, rootA, rootB string, opts DiffOptions) {
+	t.Helper()
+	changes, err := Diff(a, b, rootA, rootB, opts)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%d differences between %s and %s", len(changes), rootA, rootB)
+	for _, c := range changes {
+		buf.WriteString("\n")
+		buf.WriteString(c.String())
+	}
+	t.Error(buf.String())
+}
+
+type treeDiff struct {
+	a, b         filesys.FileSystem
+	rootA, rootB string
+	opts         DiffOptions
+	changes      []Change
+}
+
+func (d *treeDiff) add(name string, kind ChangeKind, detail string) {
+	d.changes = append(d.changes, Change{name, kind, detail})
+}
+
+// dir compares the contents of the directory rel of both trees
+func (d *treeDiff) dir(rel string) error {
+	infosA, err := readSortedDir(d.a, path.Join(d.rootA, rel))
+	if err != nil {
+		return err
+	}
+	infosB, err := readSortedDir(d.b, path.Join(d.rootB, rel))
+	if err != nil {
+		return err
+	}
+
+	for len(infosA) > 0 || len(infosB) > 0 {
+		switch {
+		case len(infosB) == 0 || len(infosA) > 0 && infosA[0].Name() < infosB[0].Name():
+			d.add(path.Join(rel, infosA[0].Name()), Removed, "")
+			infosA = infosA[1:]
+		case len(infosA) == 0 || infosB[0].Name() < infosA[0].Name():
+			d.add(path.Join(rel, infosB[0].Name()), Added, "")
+			infosB = infosB[1:]
+		default:
+			if err := d.entry(path.Join(rel, infosA[0].Name()), infosA[0], infosB[0]); err != nil {
+				return err
+			}
+			infosA, infosB = infosA[1:], infosB[1:]
+		}
+	}
+	return nil
+}
+
+// entry compares an entry that exists in both trees
+func (d *treeDiff) entry(rel string, fiA, fiB os.FileInfo) error {
+	if fiA.Mode().Type() != fiB.Mode().Type() {
+		d.add(rel, TypeChanged, fmt.Sprintf("%s -> %s", typeName(fiA.Mode()), typeName(fiB.Mode())))
+		return nil
+	}
+	isLink := fiA.Mode()&os.ModeSymlink != 0
+
+	const permBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	if !d.opts.IgnoreModes && !isLink && fiA.Mode()&permBits != fiB.Mode()&permBits {
+		d.add(rel, ModeChanged, fmt.Sprintf("%v -> %v", fiA.Mode(), fiB.Mode()))
+	}
+	if !d.opts.IgnoreModTimes && !isLink {
+		delta := fiA.ModTime().Sub(fiB.ModTime())
+		if delta < 0 {
+			delta = -delta
+		}
+		if delta > d.opts.ModTimePrecision {
+			d.add(rel, ModTimeChanged, fmt.Sprintf("%v -> %v", fiA.ModTime(), fiB.ModTime()))
+		}
+	}
+
+	nameA, nameB := path.Join(d.rootA, rel), path.Join(d.rootB, rel)
+	switch {
+	case fiA.IsDir():
+		return d.dir(rel)
+	case isLink:
+		targetA, err := d.a.Readlink(nameA)
+		if err != nil {
+			return err
+		}
+		targetB, err := d.b.Readlink(nameB)
+		if err != nil {
+			return err
+		}
+		if targetA != targetB {
+			d.add(rel, ContentChanged, fmt.Sprintf("%s -> %s", targetA, targetB))
+		}
+	case fiA.Mode().IsRegular():
+		dataA, err := d.a.ReadFile(nameA)
+		if err != nil {
+			return err
+		}
+		dataB, err := d.b.ReadFile(nameB)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(dataA, dataB) {
+			d.add(rel, ContentChanged, contentDiff(nameA, nameB, dataA, dataB))
+		}
+	}
+	return nil
+}
+
+func readSortedDir(fs filesys.FileSystem, name string) ([]os.FileInfo, error) {
+	infos, err := fs.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func typeName(mode os.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return "file"
+	case mode.IsDir():
+		return "directory"
+	case mode&os.ModeSymlink != 0:
+		return "symbolic link"
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeDevice != 0:
+		return "device"
+	}
+	return mode.Type().String()
+}
+
+// contentDiff returns a unified diff of the lines of text files,
+// and of hexdumps of other files
+func contentDiff(nameA, nameB string, a, b []byte) string {
+	if isText(a) && isText(b) {
+		return unifiedDiff(nameA, nameB, a, b)
+	}
+	return unifiedDiff(nameA, nameB, []byte(hex.Dump(a)), []byte(hex.Dump(b)))
+}
+
+// isText reports whether data looks like text, without null bytes
+// or invalid UTF-8
+func isText(data []byte) bool {
+	return utf8.Valid(data) && bytes.IndexByte(data, 0) < 0
+}
@@ -0,0 +1,90 @@
+package fsutil
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/poppels/filesys/virtual"
+)
+
+func TestDiff(t *testing.T) {
+	mtime := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	// With a fixed clock, only times that are set explicitly differ
+	a := virtual.NewVirtualFilesysWithClock(virtual.FixedClock(mtime))
+	CreateStructure(a, map[string][]byte{
+		"/a/same.txt":    []byte("same\n"),
+		"/a/text.txt":    []byte("one\ntwo\nthree\n"),
+		"/a/data.bin":    {0, 1, 2, 3},
+		"/a/mode.txt":    []byte("mode"),
+		"/a/removed.txt": []byte("removed"),
+		"/a/kind":        []byte("file"),
+		"/a/dir/old/x":   []byte("x")}, nil)
+	a.Symlink("same.txt", "/a/link")
+	b := a.Clone()
+	b.Rename("/a", "/b")
+
+	b.WriteFile("/b/text.txt", []byte("one\n2\nthree\n"), 0644)
+	b.WriteFile("/b/data.bin", []byte{0, 1, 9, 3}, 0644)
+	b.Chmod("/b/mode.txt", 0600)
+	b.Remove("/b/removed.txt")
+	b.Remove("/b/kind")
+	b.Mkdir("/b/kind", 0755)
+	b.RemoveAll("/b/dir/old")
+	b.WriteFile("/b/dir/new", []byte("new"), 0644)
+	b.Remove("/b/link")
+	b.Symlink("text.txt", "/b/link")
+
+	changes, err := Diff(a, b, "/a", "/b", DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Change{
+		{"data.bin", ContentChanged, "--- /a/data.bin\n+++ /b/data.bin\n@@ -1 +1 @@\n" +
+			"-00000000  00 01 02 03                                       |....|\n" +
+			"+00000000  00 01 09 03                                       |....|\n"},
+		{"dir/new", Added, ""},
+		{"dir/old", Removed, ""},
+		{"kind", TypeChanged, "file -> directory"},
+		{"link", ContentChanged, "same.txt -> text.txt"},
+		{"mode.txt", ModeChanged, "-rw-r--r-- -> -rw-------"},
+		{"removed.txt", Removed, ""},
+		{"text.txt", ContentChanged, "--- /a/text.txt\n+++ /b/text.txt\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n"}}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %v", len(expected), changes)
+	}
+	for i, c := range changes {
+		if c != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], c)
+		}
+	}
+
+	b.Chtimes("/b/same.txt", mtime, mtime.Add(time.Millisecond))
+	changes, _ = Diff(a, b, "/a", "/b", DiffOptions{IgnoreModes: true})
+	expected = []Change{{"same.txt", ModTimeChanged, "2020-01-01 12:00:00 +0000 UTC -> 2020-01-01 12:00:00.001 +0000 UTC"}}
+	if len(changes) != 8 || changes[6] != expected[0] {
+		t.Fatalf("Expected %v, got %v", expected[0], changes)
+	}
+	changes, _ = Diff(a, b, "/a", "/b", DiffOptions{IgnoreModes: true, ModTimePrecision: time.Hour})
+	for _, c := range changes {
+		if c.Kind == ModTimeChanged {
+			t.Fatalf("Expected modification times to be equal within the precision, got %v", c)
+		}
+	}
+}
+
+func TestAssertEqualTrees(t *testing.T) {
+	fs := virtual.NewVirtualFilesys()
+	PutFile(fs, "/a/x.txt", []byte("Hello\n"))
+	PutFile(fs, "/b/x.txt", []byte("Bye\n"))
+
+	rt := &recordingT{TB: t}
+	AssertEqualTrees(rt, fs, fs, "/a", "/a", DiffOptions{})
+	if len(rt.errors) != 0 {
+		t.Fatalf("Unexpected errors %v", rt.errors)
+	}
+	AssertEqualTrees(rt, fs, fs, "/a", "/b", DiffOptions{IgnoreModTimes: true})
+	if len(rt.errors) != 1 || !strings.Contains(rt.errors[0], "content changed x.txt:\n--- /a/x.txt\n+++ /b/x.txt\n") {
+		t.Fatalf("Expected the differences to be reported, got %v", rt.errors)
+	}
+}
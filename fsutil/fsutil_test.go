@@ -1,6 +1,8 @@
 package fsutil
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/poppels/filesys/virtual"
@@ -21,3 +23,38 @@ func TestPutFile(t *testing.T) {
 		t.Fatal("Error expected when creating a file ending with /")
 	}
 }
+
+// recordingT records the errors of a test instead of failing it
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Error(args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprint(args...))
+}
+
+func TestAssertNoLeaks(t *testing.T) {
+	fs := virtual.NewVirtualFilesys()
+	PutFile(fs, "/a/b.txt", []byte("Hello"))
+	closed, _ := fs.Open("/a/b.txt")
+	closed.Close()
+
+	rt := &recordingT{TB: t}
+	AssertNoLeaks(rt, fs)
+	if len(rt.errors) != 0 {
+		t.Fatalf("Unexpected errors %v", rt.errors)
+	}
+
+	leaked, _ := fs.Open("/a/b.txt")
+	AssertNoLeaks(rt, fs)
+	if len(rt.errors) != 1 {
+		t.Fatalf("Expected a leak to be reported, got %v", rt.errors)
+	}
+	if !strings.Contains(rt.errors[0], "/a/b.txt was opened by") || !strings.Contains(rt.errors[0], "TestAssertNoLeaks") {
+		t.Fatalf("Expected the report to show the path and the caller, got %s", rt.errors[0])
+	}
+	leaked.Close()
+}
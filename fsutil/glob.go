@@ -0,0 +1,14 @@
+package fsutil
+
+import (
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/internal/glob"
+)
+
+// Glob returns the names of the files that match any of the patterns, in
+// lexical order, with the syntax of filesys.Match. Patterns that start with
+// "!" exclude the names they match. It uses the Glob method of fs if it
+// implements filesys.GlobFileSystem.
+func Glob(fs filesys.FileSystem, patterns ...string) ([]string, error) {
+	return glob.Glob(fs, patterns)
+}
@@ -0,0 +1,109 @@
+package fsutil
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/virtual"
+)
+
+func TestGlob(t *testing.T) {
+	fs := virtual.NewVirtualFilesys()
+	CreateStructure(fs, map[string][]byte{
+		"/src/main.go":       nil,
+		"/src/main_test.go":  nil,
+		"/src/asm.s":         nil,
+		"/src/lib/util.go":   nil,
+		"/src/lib/deep/x.go": nil,
+		"/src/lib/deep/x.c":  nil,
+		"/src/{literal}.go":  nil,
+		"/docs/README.md":    nil,
+		"/docs/[draft].md":   nil}, nil)
+	fs.Symlink("/src", "/src/lib/loop")
+
+	for _, test := range []struct {
+		patterns []string
+		expected []string
+	}{
+		{[]string{"/src/*.go"}, []string{"/src/main.go", "/src/main_test.go", "/src/{literal}.go"}},
+		{[]string{"/src/**/*.go"}, []string{"/src/lib/deep/x.go", "/src/lib/util.go", "/src/main.go", "/src/main_test.go", "/src/{literal}.go"}},
+		{[]string{"/src/**/*.{s,c}"}, []string{"/src/asm.s", "/src/lib/deep/x.c"}},
+		{[]string{"/src/**/*.go", "!**/*_test.go", "!/src/\\{*"}, []string{"/src/lib/deep/x.go", "/src/lib/util.go", "/src/main.go"}},
+		{[]string{"/{src,docs}/*.md", "/docs/\\[draft\\].md"}, []string{"/docs/README.md", "/docs/[draft].md"}},
+		{[]string{"/src/lib/loop/lib/util.go"}, []string{"/src/lib/loop/lib/util.go"}},
+		{[]string{"/src/lib/**"}, []string{"/src/lib", "/src/lib/deep", "/src/lib/deep/x.c", "/src/lib/deep/x.go", "/src/lib/loop", "/src/lib/util.go"}},
+		{[]string{"/missing/**/*.go", "/src/main.go/*"}, []string{}},
+		{[]string{"/src/*/", "/src/lib/*/"}, []string{"/src/lib", "/src/lib/deep", "/src/lib/loop"}},
+		{[]string{"/src/lib/*", "!/src/lib/*/"}, []string{"/src/lib/util.go"}},
+		{[]string{"/src/**/"}, []string{"/src", "/src/lib", "/src/lib/deep"}},
+	} {
+		names, err := Glob(fs, test.patterns...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("Expected %v for %v, got %v", test.expected, test.patterns, names)
+		}
+	}
+
+	// Relative patterns give relative names
+	src, _ := fs.ChangeDir("/src")
+	names, err := Glob(src, "lib/*.go")
+	if err != nil || !reflect.DeepEqual(names, []string{"lib/util.go"}) {
+		t.Fatalf("Expected lib/util.go, got %v, %v", names, err)
+	}
+
+	for _, pattern := range []string{"/src/[", "/src/{a,b", "/src/{a", "!["} {
+		if _, err := Glob(fs, pattern); err != path.ErrBadPattern {
+			t.Errorf("Expected ErrBadPattern for %s, got %v", pattern, err)
+		}
+	}
+}
+
+// vanishingFS removes a file after the directory containing it is read
+type vanishingFS struct {
+	filesys.FileSystem
+	vanish string
+}
+
+func (v vanishingFS) ReadDir(name string) ([]os.FileInfo, error) {
+	infos, err := v.FileSystem.ReadDir(name)
+	if name == path.Dir(v.vanish) {
+		v.FileSystem.RemoveAll(v.vanish)
+	}
+	return infos, err
+}
+
+func TestGlobVanished(t *testing.T) {
+	fs := virtual.NewVirtualFilesys()
+	CreateStructure(fs, map[string][]byte{"/a/x/1": nil, "/a/y/1": nil, "/a/z": nil}, nil)
+	names, err := Glob(vanishingFS{fs, "/a/x"}, "/a/*/1", "/a/z*")
+	if err != nil || !reflect.DeepEqual(names, []string{"/a/y/1", "/a/z"}) {
+		t.Fatalf("Expected the removed directory to be left out, got %v, %v", names, err)
+	}
+}
+
+// globFS finds files with its own Glob
+type globFS struct {
+	filesys.FileSystem
+	patterns []string
+}
+
+func (g *globFS) Glob(pattern string) ([]string, error) {
+	g.patterns = append(g.patterns, pattern)
+	return []string{"/b", "/a", "/c"}, nil
+}
+
+func TestGlobFileSystem(t *testing.T) {
+	g := &globFS{FileSystem: virtual.NewVirtualFilesys()}
+	names, err := Glob(g, "/x/**", "!/c", "/y")
+	if err != nil || !reflect.DeepEqual(names, []string{"/a", "/b"}) {
+		t.Fatalf("Expected the names of Glob without the excluded one, got %v, %v", names, err)
+	}
+	if !reflect.DeepEqual(g.patterns, []string{"/x/**", "/y"}) {
+		t.Fatalf("Expected Glob to be called for each pattern, got %v", g.patterns)
+	}
+}
@@ -0,0 +1,33 @@
+package fsutil
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/poppels/filesys"
+)
+
+// AssertNoLeaks fails the test if fs has open files, and lists where they
+// were opened. Call it at the end of a test, or defer it, when every file
+// should have been closed. The file system must keep track of its open
+// files by implementing filesys.HandleTrackingFileSystem, like the virtual
+// file system does.
+func AssertNoLeaks(t testing.TB, fs filesys.FileSystem) {
+	t.Helper()
+	tracker, ok := fs.(filesys.HandleTrackingFileSystem)
+	if !ok {
+		t.Fatalf("%T doesn't keep track of open files", fs)
+		return
+	}
+	handles := tracker.OpenHandles()
+	if len(handles) == 0 {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d open files were not closed", len(handles))
+	for _, h := range handles {
+		fmt.Fprintf(&b, "\n\n%s was opened by\n%s", h.Path, h.Stack)
+	}
+	t.Error(b.String())
+}
@@ -0,0 +1,266 @@
+package fsutil
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/poppels/filesys"
+)
+
+// WriteTar writes the tree below root to w as a tar archive, with names
+// relative to root. Directories, regular files and symbolic links are
+// stored with their modes and modification times, and with their owners
+// if the backend provides a *syscall.Stat_t, like the os package and the
+// virtual file system do on Unix. The archive doesn't contain root itself.
+func WriteTar(w io.Writer, fs filesys.FileSystem, root string) error {
+	tw := tar.NewWriter(w)
+	if err := writeTarDir(tw, fs, root, ""); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func writeTarDir(tw *tar.Writer, fs filesys.FileSystem, root, rel string) error {
+	infos, err := fs.ReadDir(path.Join(root, rel))
+	if err != nil {
+		return err
+	}
+	for _, fi := range infos {
+		name := path.Join(rel, fi.Name())
+		if err := writeTarEntry(tw, fs, path.Join(root, name), name, fi); err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if err := writeTarDir(tw, fs, root, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeTarEntry(tw *tar.Writer, fs filesys.FileSystem, full, name string, fi os.FileInfo) error {
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = fs.Readlink(full); err != nil {
+			return err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		// Devices, sockets and pipes can't be archived
+		return &os.PathError{"tar", full, err}
+	}
+	hdr.Name = name
+	if fi.IsDir() {
+		hdr.Name += "/"
+	}
+	// User names depend on the machine, the ids are enough
+	hdr.Uname, hdr.Gname = "", ""
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := fs.Open(full)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// ReadTar extracts the tar archive in r to the directory dir of fs, which
+// is created if needed. Modes and modification times are restored, and so
+// are owners, unless the user isn't allowed to change them. Hard links are
+// extracted as copies. Entries with names outside of dir are rejected with
+// tar.ErrInsecurePath.
+func ReadTar(r io.Reader, fs filesys.FileSystem, dir string) error {
+	if err := fs.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	// Directories get their modes and times after their contents are
+	// extracted, since those could be read-only or change the times
+	var dirs []*tar.Header
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name, ok := tarName(hdr.Name)
+		if !ok {
+			return &os.PathError{"untar", hdr.Name, tar.ErrInsecurePath}
+		}
+		if name == "" {
+			// The directory itself, like "./"
+			continue
+		}
+		target := path.Join(dir, name)
+		if err := checkNoLinks(fs, dir, path.Dir(name)); err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := checkNoLinks(fs, dir, name); err != nil {
+				return err
+			}
+			if err := fs.MkdirAll(target, 0777); err != nil {
+				return err
+			}
+			hdr.Name = name
+			dirs = append(dirs, hdr)
+		case tar.TypeReg:
+			if err := prepareTarget(fs, target); err != nil {
+				return err
+			}
+			if err := extractFile(fs, target, tr); err != nil {
+				return err
+			}
+			if err := setTarAttributes(fs, target, hdr); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			linked, ok := tarName(hdr.Linkname)
+			if !ok {
+				return &os.PathError{"untar", hdr.Linkname, tar.ErrInsecurePath}
+			}
+			if err := checkNoLinks(fs, dir, linked); err != nil {
+				return err
+			}
+			if err := prepareTarget(fs, target); err != nil {
+				return err
+			}
+			f, err := fs.Open(path.Join(dir, linked))
+			if err != nil {
+				return err
+			}
+			err = extractFile(fs, target, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			if err := setTarAttributes(fs, target, hdr); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := prepareTarget(fs, target); err != nil {
+				return err
+			}
+			if err := fs.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+			if err := fs.Lchown(target, hdr.Uid, hdr.Gid); err != nil && !fs.IsPermission(err) {
+				return err
+			}
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := checkNoLinks(fs, dir, dirs[i].Name); err != nil {
+			return err
+		}
+		if err := setTarAttributes(fs, path.Join(dir, dirs[i].Name), dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tarName cleans the name of an archive entry, and reports
+// whether it stays inside of the directory it's extracted to
+func tarName(name string) (string, bool) {
+	if path.IsAbs(name) {
+		return "", false
+	}
+	name = path.Clean(name)
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	if name == "." {
+		name = ""
+	}
+	return name, true
+}
+
+// checkNoLinks returns an error if one of the elements of rel below dir
+// is a symbolic link, so an archive can't write outside of dir through
+// a link it created before
+func checkNoLinks(fs filesys.FileSystem, dir, rel string) error {
+	current := dir
+	for _, part := range strings.Split(rel, "/") {
+		if part == "." {
+			continue
+		}
+		current = path.Join(current, part)
+		fi, err := fs.Lstat(current)
+		if fs.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return &os.PathError{"untar", current, tar.ErrInsecurePath}
+		}
+	}
+	return nil
+}
+
+// prepareTarget creates the directory of name, and removes what name
+// refers to unless it's a directory. A symbolic link is replaced instead
+// of followed, and so is a file that occurs in the archive again.
+func prepareTarget(fs filesys.FileSystem, name string) error {
+	if err := fs.MkdirAll(path.Dir(name), 0777); err != nil {
+		return err
+	}
+	fi, err := fs.Lstat(name)
+	if fs.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return nil
+	}
+	return fs.Remove(name)
+}
+
+func extractFile(fs filesys.FileSystem, name string, r io.Reader) error {
+	f, err := fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func setTarAttributes(fs filesys.FileSystem, name string, hdr *tar.Header) error {
+	if err := fs.Chown(name, hdr.Uid, hdr.Gid); err != nil && !fs.IsPermission(err) {
+		return err
+	}
+	if err := fs.Chmod(name, hdr.FileInfo().Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	atime := hdr.AccessTime
+	if atime.IsZero() {
+		atime = hdr.ModTime
+	}
+	return fs.Chtimes(name, atime, hdr.ModTime)
+}
@@ -0,0 +1,178 @@
+package fsutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/poppels/filesys/osfilesys"
+	"github.com/poppels/filesys/virtual"
+)
+
+func TestTarRoundTrip(t *testing.T) {
+	mtime := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	src := virtual.NewVirtualFilesys()
+	CreateStructure(src, map[string][]byte{
+		"/srv/a.txt":     []byte("Hello"),
+		"/srv/b/c.txt":   []byte("Bye"),
+		"/srv/b/d/e.bin": {0, 1, 2}}, []string{"/srv/empty"})
+	src.Symlink("../a.txt", "/srv/b/link")
+	src.Chmod("/srv/b/c.txt", 0600)
+	src.Chmod("/srv/b/d", 0500)
+	src.Chtimes("/srv/a.txt", mtime, mtime)
+	src.AsUser(0, 0).Chown("/srv/b/c.txt", 2000, 3000)
+
+	// Root can read all files
+	var buf bytes.Buffer
+	if err := WriteTar(&buf, src.AsUser(0, 0), "/srv"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Extract as root, so the owners can be restored
+	dst := virtual.NewVirtualFilesys().AsUser(0, 0)
+	if err := ReadTar(bytes.NewReader(buf.Bytes()), dst, "/restored"); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"a.txt": "Hello", "b/c.txt": "Bye", "b/d/e.bin": "\x00\x01\x02"} {
+		if err := VerifyFileContent(dst, "/restored/"+name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if target, err := dst.Readlink("/restored/b/link"); err != nil || target != "../a.txt" {
+		t.Fatalf("Expected link to ../a.txt, got '%s', %v", target, err)
+	}
+	if fi, err := dst.Stat("/restored/empty"); err != nil || !fi.IsDir() {
+		t.Fatalf("Expected empty directory, got %v", err)
+	}
+	for name, mode := range map[string]os.FileMode{"b/c.txt": 0600, "b/d": os.ModeDir | 0500, "a.txt": 0644} {
+		if fi, err := dst.Stat("/restored/" + name); err != nil || fi.Mode() != mode {
+			t.Fatalf("Expected mode %v for %s, got %v, %v", mode, name, fi.Mode(), err)
+		}
+	}
+	if fi, _ := dst.Stat("/restored/a.txt"); !fi.ModTime().Equal(mtime) {
+		t.Fatalf("Expected modification time %v, got %v", mtime, fi.ModTime())
+	}
+
+	// Ownership is only stored where the backend provides a Stat_t
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		return
+	}
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name == "b/c.txt" {
+			if hdr.Uid != 2000 || hdr.Gid != 3000 {
+				t.Fatalf("Expected owner 2000:3000, got %d:%d", hdr.Uid, hdr.Gid)
+			}
+			break
+		}
+	}
+	// Only the owner can read the restored file
+	if err := VerifyFileContent(dst.AsUser(2000, 3000), "/restored/b/c.txt", []byte("Bye")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTarFromOS(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "a", "b"), 0755)
+	os.WriteFile(filepath.Join(dir, "a", "b", "c.txt"), []byte("Hello"), 0644)
+
+	var buf bytes.Buffer
+	if err := WriteTar(&buf, osfilesys.NewOsWrapper(), dir); err != nil {
+		t.Fatal(err)
+	}
+	fs := virtual.NewVirtualFilesys()
+	if err := ReadTar(&buf, fs, "/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFileContent(fs, "/a/b/c.txt", []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTarInsecurePaths(t *testing.T) {
+	archive := func(headers ...*tar.Header) *bytes.Buffer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range headers {
+			hdr.Mode = 0644
+			tw.WriteHeader(hdr)
+		}
+		tw.Close()
+		return &buf
+	}
+
+	tests := [][]*tar.Header{
+		{{Name: "../evil.txt", Typeflag: tar.TypeReg}},
+		{{Name: "/evil.txt", Typeflag: tar.TypeReg}},
+		{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/"}, {Name: "link/evil.txt", Typeflag: tar.TypeReg}},
+	}
+	for i, headers := range tests {
+		fs := virtual.NewVirtualFilesys()
+		err := ReadTar(archive(headers...), fs, "/dst")
+		if !errors.Is(err, tar.ErrInsecurePath) {
+			t.Fatalf("Test %d: expected tar.ErrInsecurePath, got %v", i, err)
+		}
+		if _, err := fs.Stat("/evil.txt"); !fs.IsNotExist(err) {
+			t.Fatalf("Test %d: file written outside of the directory", i)
+		}
+	}
+}
+
+func TestTarLeafLinks(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: "/secret.txt", Mode: 0777})
+	tw.WriteHeader(&tar.Header{Name: "evil", Typeflag: tar.TypeReg, Mode: 0600, Size: 4})
+	tw.Write([]byte("evil"))
+	tw.Close()
+
+	fs := virtual.NewVirtualFilesys()
+	PutFile(fs, "/secret.txt", []byte("secret"))
+	if err := ReadTar(&buf, fs, "/dst"); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFileContent(fs, "/secret.txt", []byte("secret")); err != nil {
+		t.Fatalf("File written through the link: %v", err)
+	}
+	if fi, err := fs.Lstat("/dst/evil"); err != nil || !fi.Mode().IsRegular() {
+		t.Fatalf("Expected the link to be replaced by a file, got %v, %v", fi, err)
+	}
+	if err := VerifyFileContent(fs, "/dst/evil", []byte("evil")); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := func(headers ...*tar.Header) *bytes.Buffer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range headers {
+			tw.WriteHeader(hdr)
+		}
+		tw.Close()
+		return &buf
+	}
+	tests := [][]*tar.Header{
+		// A hard link to a file outside, through a link
+		{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/secret.txt"}, {Name: "copy", Typeflag: tar.TypeLink, Linkname: "link"}},
+		// A directory that is a link to one outside
+		{{Name: "dir", Typeflag: tar.TypeSymlink, Linkname: "/"}, {Name: "dir/", Typeflag: tar.TypeDir, Mode: 0777}},
+	}
+	for i, headers := range tests {
+		err := ReadTar(archive(headers...), fs, "/dst")
+		if !errors.Is(err, tar.ErrInsecurePath) {
+			t.Errorf("Test %d: expected tar.ErrInsecurePath, got %v", i, err)
+		}
+	}
+	if fi, err := fs.Stat("/"); err != nil || fi.Mode().Perm() == 0777 {
+		t.Errorf("Expected the mode of the root to be unchanged, got %v, %v", fi, err)
+	}
+}
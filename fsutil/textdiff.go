@@ -0,0 +1,165 @@
+package fsutil
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines around each change
+	diffContext = 3
+	// maxDiffCells limits the size of the table of the longest common
+	// subsequence. Larger changes are shown as replacing all lines.
+	maxDiffCells = 1 << 22
+)
+
+// diffLine is a line of a diff, with the kind of change: ' ', '-' or '+'
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// unifiedDiff returns a unified diff between the lines of a and b,
+// or an empty string if they are equal
+func unifiedDiff(nameA, nameB string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", nameA, nameB)
+	// Line numbers of the start of lines[i] in a and b
+	lineA, lineB := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			lineA++
+			lineB++
+			i++
+			continue
+		}
+
+		// A hunk starts with context before the change, and ends when
+		// there are more unchanged lines than the context on both sides
+		start := max(i-diffContext, 0)
+		end := i
+		for unchanged := 0; end < len(lines) && unchanged <= 2*diffContext; end++ {
+			if lines[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		for end > i && lines[end-1].kind == ' ' {
+			end--
+		}
+		end = min(end+diffContext, len(lines))
+
+		startA, startB := lineA-(i-start), lineB-(i-start)
+		var countA, countB int
+		for _, l := range lines[start:end] {
+			if l.kind != '+' {
+				countA++
+			}
+			if l.kind != '-' {
+				countB++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(startA, countA), hunkRange(startB, countB))
+		for _, l := range lines[start:end] {
+			buf.WriteByte(l.kind)
+			buf.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		lineA += countA - (i - start)
+		lineB += countB - (i - start)
+		i = end
+	}
+	return buf.String()
+}
+
+// hunkRange formats the start and length of a hunk. An empty range
+// starts at the line before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits data into lines that keep their newlines
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the lines of a and b as unchanged, removed from a or
+// added in b, based on their longest common subsequence
+func diffLines(a, b []string) []diffLine {
+	var lines []diffLine
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		lines = append(lines, diffLine{' ', a[prefix]})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	if len(midA)*len(midB) > maxDiffCells {
+		for _, l := range midA {
+			lines = append(lines, diffLine{'-', l})
+		}
+		for _, l := range midB {
+			lines = append(lines, diffLine{'+', l})
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence
+		// of midA[i:] and midB[j:]
+		n, m := len(midA), len(midB)
+		lcs := make([][]int32, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n || j < m {
+			switch {
+			case i < n && j < m && midA[i] == midB[j]:
+				lines = append(lines, diffLine{' ', midA[i]})
+				i++
+				j++
+			case j == m || i < n && lcs[i+1][j] >= lcs[i][j+1]:
+				lines = append(lines, diffLine{'-', midA[i]})
+				i++
+			default:
+				lines = append(lines, diffLine{'+', midB[j]})
+				j++
+			}
+		}
+	}
+
+	for _, l := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	return lines
+}
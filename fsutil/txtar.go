@@ -0,0 +1,249 @@
+package fsutil
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/poppels/filesys"
+)
+
+// Txtar is an archive in the txtar format of golang.org/x/tools/txtar,
+// a comment followed by files that each start with a "-- name --" line:
+//
+//	Optional comment
+//	-- a.txt --
+//	Hello
+//	-- b/c.txt --
+//	Bye
+//	-- empty/ --
+//
+// A name ending in a slash is a directory, for trees with empty directories.
+// Like in the original format, the contents of every file end with a
+// newline, so a file without a final newline doesn't survive a round trip.
+type Txtar struct {
+	Comment []byte
+	Files   []TxtarFile
+}
+
+// TxtarFile is a file in a Txtar archive
+type TxtarFile struct {
+	Name string
+	Data []byte
+}
+
+var (
+	txtarNewlineMarker = []byte("\n-- ")
+	txtarMarker        = []byte("-- ")
+	txtarMarkerEnd     = []byte(" --")
+)
+
+// ParseTxtar parses an archive. Every input is valid, text without
+// any file markers is an archive with only a comment.
+func ParseTxtar(data []byte) *Txtar {
+	a := &Txtar{}
+	var name string
+	a.Comment, name, data = findTxtarMarker(data)
+	for name != "" {
+		f := TxtarFile{Name: name}
+		f.Data, name, data = findTxtarMarker(data)
+		a.Files = append(a.Files, f)
+	}
+	return a
+}
+
+// findTxtarMarker returns the text before the next file marker, the name
+// in the marker, and the text after it
+func findTxtarMarker(data []byte) (before []byte, name string, after []byte) {
+	var i int
+	for {
+		if name, after = isTxtarMarker(data[i:]); name != "" {
+			return data[:i], name, after
+		}
+		j := bytes.Index(data[i:], txtarNewlineMarker)
+		if j < 0 {
+			return fixNewline(data), "", nil
+		}
+		i += j + 1
+	}
+}
+
+func isTxtarMarker(data []byte) (name string, after []byte) {
+	if !bytes.HasPrefix(data, txtarMarker) {
+		return "", nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data, after = data[:i], data[i+1:]
+	}
+	if !(bytes.HasSuffix(data, txtarMarkerEnd) && len(data) >= len(txtarMarker)+len(txtarMarkerEnd)) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data[len(txtarMarker) : len(data)-len(txtarMarkerEnd)])), after
+}
+
+func fixNewline(data []byte) []byte {
+	if len(data) == 0 || data[len(data)-1] == '\n' {
+		return data
+	}
+	return append(data[:len(data):len(data)], '\n')
+}
+
+// Format returns the archive in the txtar format
+func (a *Txtar) Format() []byte {
+	var buf bytes.Buffer
+	buf.Write(fixNewline(a.Comment))
+	for _, f := range a.Files {
+		fmt.Fprintf(&buf, "-- %s --\n", f.Name)
+		buf.Write(fixNewline(f.Data))
+	}
+	return buf.Bytes()
+}
+
+// Sub returns the files below the directory dir of the archive, with
+// names relative to dir. It lets a single archive hold several trees,
+// like the input and the expected output of a test.
+func (a *Txtar) Sub(dir string) *Txtar {
+	prefix := strings.Trim(dir, "/") + "/"
+	sub := &Txtar{}
+	for _, f := range a.Files {
+		if strings.HasPrefix(f.Name, prefix) && len(f.Name) > len(prefix) {
+			sub.Files = append(sub.Files, TxtarFile{Name: f.Name[len(prefix):], Data: f.Data})
+		}
+	}
+	return sub
+}
+
+// PutTxtar creates the files and directories of the archive below dir,
+// including any missing parent directories
+func PutTxtar(fs filesys.FileSystem, dir string, a *Txtar) error {
+	for _, f := range a.Files {
+		name := path.Join(dir, f.Name)
+		if strings.HasSuffix(f.Name, "/") {
+			if err := fs.MkdirAll(name, 0777); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := PutFile(fs, name, f.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadTxtar returns the tree below dir as an archive, with the files in
+// lexical order. Empty directories are included, symbolic links and
+// other special files are left out.
+func ReadTxtar(fs filesys.FileSystem, dir string) (*Txtar, error) {
+	a := &Txtar{}
+	if err := readTxtarDir(fs, dir, "", a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func readTxtarDir(fs filesys.FileSystem, dir, rel string, a *Txtar) error {
+	infos, err := fs.ReadDir(path.Join(dir, rel))
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 && rel != "" {
+		a.Files = append(a.Files, TxtarFile{Name: rel + "/"})
+	}
+	for _, fi := range infos {
+		name := path.Join(rel, fi.Name())
+		switch {
+		case fi.IsDir():
+			if err := readTxtarDir(fs, dir, name, a); err != nil {
+				return err
+			}
+		case fi.Mode().IsRegular():
+			data, err := fs.ReadFile(path.Join(dir, name))
+			if err != nil {
+				return err
+			}
+			a.Files = append(a.Files, TxtarFile{Name: name, Data: data})
+		}
+	}
+	return nil
+}
+
+// DiffTxtar compares the tree below dir with the expected archive. It
+// returns a readable description of the differences, with a unified diff
+// for every file with other contents, or an empty string if they match.
+// Since files in an archive always end with a newline, a missing final
+// newline isn't a difference.
+func DiffTxtar(fs filesys.FileSystem, dir string, expected *Txtar) (string, error) {
+	actual, err := ReadTxtar(fs, dir)
+	if err != nil {
+		return "", err
+	}
+	want := txtarMap(expected)
+	got := txtarMap(actual)
+	var names []string
+	for name := range want {
+		names = append(names, name)
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		wantData, inWant := want[name]
+		gotData, inGot := got[name]
+		switch {
+		case !inGot:
+			fmt.Fprintf(&b, "missing %s\n", name)
+		case !inWant:
+			fmt.Fprintf(&b, "unexpected %s\n", name)
+		default:
+			b.WriteString(unifiedDiff("expected/"+name, "actual/"+name, wantData, gotData))
+		}
+	}
+	return b.String(), nil
+}
+
+// txtarMap returns the files of an archive by name, with the contents
+// normalized the way Format would write them
+func txtarMap(a *Txtar) map[string][]byte {
+	files := make(map[string][]byte, len(a.Files))
+	for _, f := range a.Files {
+		name := path.Clean(f.Name)
+		if strings.HasSuffix(f.Name, "/") {
+			name += "/"
+		}
+		files[name] = fixNewline(f.Data)
+	}
+	return files
+}
+
+// AssertTxtar fails the test if the tree below dir doesn't match
+// the expected archive, and shows the differences
+func AssertTxtar(t testing.TB, fs filesys.FileSystem, dir string, expected *Txtar) {
+	t.Helper()
+	diff, err := DiffTxtar(fs, dir, expected)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if diff != "" {
+		t.Error(dir + " doesn't match the expected files:\n" + diff)
+	}
+}
+
+// LoadTxtar reads and parses an archive, like a fixture in testdata
+func LoadTxtar(name string) (*Txtar, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTxtar(data), nil
+}
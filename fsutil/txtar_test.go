@@ -0,0 +1,108 @@
+package fsutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/poppels/filesys/virtual"
+)
+
+func TestParseTxtar(t *testing.T) {
+	data := "comment\n-- a.txt --\nHello\n-- b/c.txt --\nnot -- a marker --\n-- d/ --\n-- e.txt --\nno newline"
+	a := ParseTxtar([]byte(data))
+	if string(a.Comment) != "comment\n" {
+		t.Fatalf("Unexpected comment %q", a.Comment)
+	}
+	expected := []TxtarFile{
+		{"a.txt", []byte("Hello\n")},
+		{"b/c.txt", []byte("not -- a marker --\n")},
+		{"d/", nil},
+		{"e.txt", []byte("no newline\n")}}
+	if len(a.Files) != len(expected) {
+		t.Fatalf("Expected %d files, got %d", len(expected), len(a.Files))
+	}
+	for i, f := range a.Files {
+		if f.Name != expected[i].Name || string(f.Data) != string(expected[i].Data) {
+			t.Fatalf("Expected %s with %q, got %s with %q", expected[i].Name, expected[i].Data, f.Name, f.Data)
+		}
+	}
+	if formatted := string(a.Format()); formatted != data+"\n" {
+		t.Fatalf("Unexpected formatted archive %q", formatted)
+	}
+}
+
+func TestTxtarFixture(t *testing.T) {
+	archive, err := LoadTxtar("testdata/rename.txtar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := virtual.NewVirtualFilesys()
+	if err := PutTxtar(fs, "/work", archive.Sub("input")); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFileContent(fs, "/work/notes/draft.txt", []byte("Line one\nLine two\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	fs.Rename("/work/notes/draft.txt", "/work/notes/final.txt")
+	fs.RemoveAll("/work/tmp")
+	AssertTxtar(t, fs, "/work", archive.Sub("output"))
+
+	read, err := ReadTxtar(fs, "/work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "-- keep/ --\n-- notes/final.txt --\nLine one\nLine two\n"
+	if formatted := string(read.Format()); formatted != expected {
+		t.Fatalf("Expected archive %q, got %q", expected, formatted)
+	}
+}
+
+func TestDiffTxtar(t *testing.T) {
+	fs := virtual.NewVirtualFilesys()
+	PutTxtar(fs, "/work", ParseTxtar([]byte("-- same.txt --\nsame\n-- changed.txt --\n1\n2\n3\n4\n5\n6\n7\n8\n9\n-- extra.txt --\n")))
+	expected := ParseTxtar([]byte("-- same.txt --\nsame\n-- changed.txt --\n1\n2\n3\n4\nfive\n6\n7\n8\n9\n-- missing/ --\n"))
+
+	diff, err := DiffTxtar(fs, "/work", expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `--- expected/changed.txt
++++ actual/changed.txt
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-five
++5
+ 6
+ 7
+ 8
+unexpected extra.txt
+missing missing/
+`
+	if diff != want {
+		t.Fatalf("Expected diff\n%s\ngot\n%s", want, diff)
+	}
+
+	rt := &recordingT{TB: t}
+	AssertTxtar(rt, fs, "/work", expected)
+	if len(rt.errors) != 1 || !strings.Contains(rt.errors[0], "-five\n+5") {
+		t.Fatalf("Expected the differences to be reported, got %v", rt.errors)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	for _, test := range []struct {
+		a, b, diff string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"", "a\n", "--- a\n+++ b\n@@ -0,0 +1 @@\n+a\n"},
+		{"a\nb", "a\nc", "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n", "--- a\n+++ b\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -7,4 +8,3 @@\n 7\n 8\n 9\n-10\n"},
+	} {
+		if diff := unifiedDiff("a", "b", []byte(test.a), []byte(test.b)); diff != test.diff {
+			t.Errorf("Diff of %q and %q: expected\n%s\ngot\n%s", test.a, test.b, test.diff, diff)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package fsutil
+
+import (
+	stdfs "io/fs"
+	"path/filepath"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/internal/walk"
+)
+
+// Walk walks the tree below root in lexical order, like filepath.Walk.
+// Return filesys.SkipDir or filesys.SkipAll from fn to skip a directory
+// or the rest of the tree.
+func Walk(fs filesys.FileSystem, root string, fn filepath.WalkFunc) error {
+	return walk.Walk(fs, root, false, walk.Func(fn))
+}
+
+// WalkDir walks the tree below root in lexical order, like filepath.WalkDir
+func WalkDir(fs filesys.FileSystem, root string, fn stdfs.WalkDirFunc) error {
+	return walk.WalkDir(fs, root, false, 1, fn)
+}
+
+// WalkDirWith is like WalkDir, with options to follow links
+// and walk concurrently
+func WalkDirWith(fs filesys.FileSystem, root string, opts filesys.WalkOptions, fn stdfs.WalkDirFunc) error {
+	return walk.WalkDir(fs, root, opts.FollowSymlinks, opts.Workers, fn)
+}
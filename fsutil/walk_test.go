@@ -0,0 +1,197 @@
+package fsutil
+
+import (
+	"errors"
+	stdfs "io/fs"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/virtual"
+)
+
+func walkFixture() *virtual.VirtualFileSystem {
+	fs := virtual.NewVirtualFilesys()
+	CreateStructure(fs, map[string][]byte{
+		"/root/b/x.txt":   []byte("x"),
+		"/root/b/y.txt":   []byte("y"),
+		"/root/a.txt":     []byte("a"),
+		"/root/c/d/e.txt": []byte("e")}, []string{"/root/empty"})
+	return fs
+}
+
+func TestWalk(t *testing.T) {
+	fs := walkFixture()
+	var names []string
+	err := Walk(fs, "/root", func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		if name == "/root/c" {
+			return filesys.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"/root", "/root/a.txt", "/root/b", "/root/b/x.txt", "/root/b/y.txt", "/root/c", "/root/empty"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected %v, got %v", expected, names)
+	}
+
+	if err := Walk(fs, "/missing", func(name string, fi os.FileInfo, err error) error { return err }); !fs.IsNotExist(err) {
+		t.Fatalf("Expected a missing root to be reported, got %v", err)
+	}
+}
+
+func TestWalkDir(t *testing.T) {
+	fs := walkFixture()
+	var names []string
+	err := WalkDir(fs, "/root", func(name string, d stdfs.DirEntry, err error) error {
+		names = append(names, name)
+		switch {
+		case name == "/root/b/x.txt":
+			// Skips the rest of the directory
+			return filesys.SkipDir
+		case name == "/root/c/d":
+			return filesys.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"/root", "/root/a.txt", "/root/b", "/root/b/x.txt", "/root/c", "/root/c/d"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected %v, got %v", expected, names)
+	}
+
+	// Unreadable directories are reported a second time with the error
+	fs.Chmod("/root/b", 0)
+	var failed []string
+	err = WalkDir(fs, "/root", func(name string, d stdfs.DirEntry, err error) error {
+		if err != nil {
+			failed = append(failed, name)
+		}
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(failed, []string{"/root/b"}) {
+		t.Fatalf("Expected /root/b to fail, got %v, %v", failed, err)
+	}
+}
+
+func TestWalkDirFollowSymlinks(t *testing.T) {
+	fs := walkFixture()
+	fs.Symlink("../c", "/root/b/linked")
+	fs.Symlink("/root", "/root/c/d/cycle")
+	fs.Symlink("a.txt", "/root/file")
+	fs.Symlink("missing", "/root/dangling")
+
+	types := map[string]string{}
+	err := WalkDirWith(fs, "/root", filesys.WalkOptions{FollowSymlinks: true}, func(name string, d stdfs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		types[name] = typeName(d.Type())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, typ := range map[string]string{
+		"/root/b/linked":         "directory",
+		"/root/b/linked/d/e.txt": "file",
+		"/root/b/linked/d/cycle": "symbolic link",
+		"/root/c/d/cycle":        "symbolic link",
+		"/root/file":             "file",
+		"/root/dangling":         "symbolic link",
+		"/root/c/d/cycle/a.txt":  ""} {
+		if types[name] != typ {
+			t.Errorf("Expected %s to be a %q, got %q", name, typ, types[name])
+		}
+	}
+}
+
+func TestWalkDirMutualLinks(t *testing.T) {
+	fs := virtual.NewVirtualFilesys()
+	CreateStructure(fs, map[string][]byte{
+		"/r/a/x.txt": []byte("x"),
+		"/r/b/y.txt": []byte("y")}, nil)
+	fs.Symlink("/r/b", "/r/a/lb")
+	fs.Symlink("/r/a", "/r/b/la")
+
+	for _, workers := range []int{1, 4} {
+		var mu sync.Mutex
+		var names []string
+		options := filesys.WalkOptions{FollowSymlinks: true, Workers: workers}
+		err := WalkDirWith(fs, "/r", options, func(name string, d stdfs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			names = append(names, name)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(names)
+		expected := []string{
+			"/r", "/r/a", "/r/a/lb", "/r/a/lb/la", "/r/a/lb/y.txt", "/r/a/x.txt",
+			"/r/b", "/r/b/la", "/r/b/la/lb", "/r/b/la/x.txt", "/r/b/y.txt"}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("Workers %d: expected %v, got %v", workers, expected, names)
+		}
+	}
+}
+
+func TestWalkDirWorkers(t *testing.T) {
+	fs := virtual.NewVirtualFilesys()
+	var expected []string
+	for _, dir := range []string{"a", "b", "c", "d", "e", "f"} {
+		for _, file := range []string{"1", "2", "3"} {
+			name := "/root/" + dir + "/sub/" + file
+			PutFile(fs, name, nil)
+			expected = append(expected, name)
+		}
+	}
+
+	var mu sync.Mutex
+	var files []string
+	err := WalkDirWith(fs, "/root", filesys.WalkOptions{Workers: 4}, func(name string, d stdfs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			mu.Lock()
+			files = append(files, name)
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	if !reflect.DeepEqual(files, expected) {
+		t.Fatalf("Expected %v, got %v", expected, files)
+	}
+
+	errStop := errors.New("stop")
+	err = WalkDirWith(fs, "/root", filesys.WalkOptions{Workers: 4}, func(name string, d stdfs.DirEntry, err error) error {
+		if strings.HasSuffix(name, "/c/sub/2") {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatalf("Expected the error of the function, got %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package filesys
+
+import (
+	"github.com/poppels/filesys/internal/glob"
+)
+
+// GlobFileSystem is implemented by file systems that can find the files
+// matching a pattern faster than by reading directories. Glob is called
+// with a single pattern in the syntax of Match, without a leading "!".
+type GlobFileSystem interface {
+	FileSystem
+	Glob(pattern string) ([]string, error)
+}
+
+// Glob returns the names of the files in the global FileSystem that match
+// any of the patterns, in lexical order. Patterns that start with "!"
+// exclude the names they match, and patterns that end with a slash only
+// match directories. Entries that are removed while Glob reads
+// their directory are left out, other errors are returned, like
+// path.ErrBadPattern for malformed patterns. The Glob method of the
+// FileSystem is used if it implements GlobFileSystem.
+func Glob(patterns ...string) ([]string, error) {
+	return glob.Glob(getSingleton(), patterns)
+}
+
+// Match reports whether name matches the pattern, which has the syntax of
+// path.Match, extended with "**" for any number of directories and braces
+// for alternatives, like "src/**/*.{go,s}". Absolute names only match
+// absolute patterns or patterns that start with "**". A pattern that ends
+// with a slash only matches names that end with one, like directories.
+func Match(pattern, name string) (bool, error) {
+	return glob.Match(pattern, name)
+}
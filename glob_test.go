@@ -0,0 +1,28 @@
+package filesys
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	for _, test := range []struct {
+		pattern, name string
+		matches       bool
+	}{
+		{"/src/**/*.go", "/src/a/b/c.go", true},
+		{"**/*.go", "/c.go", true},
+		{"src/*.{go,s}", "src/a.s", true},
+		{"src/*.go", "/src/a.go", false},
+		{"a}b", "a}b", true},
+		{"\\{a}", "{a}", true},
+		{"{a}}", "a}", true},
+		{"/w/*/", "/w/x/", true},
+		{"/w/*/", "/w/x", false},
+		{"/w/*", "/w/x/", true},
+	} {
+		matches, err := Match(test.pattern, test.name)
+		if err != nil {
+			t.Errorf("Match(%q, %q): %v", test.pattern, test.name, err)
+		} else if matches != test.matches {
+			t.Errorf("Expected Match(%q, %q) to be %t", test.pattern, test.name, test.matches)
+		}
+	}
+}
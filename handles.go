@@ -0,0 +1,14 @@
+package filesys
+
+// OpenHandle describes a file that is open
+type OpenHandle struct {
+	Path  string // Absolute path the file was opened with
+	Stack string // Stack trace of the code that opened the file
+}
+
+// HandleTrackingFileSystem is implemented by file systems that keep
+// track of their open files, so tests can find files that are never closed
+type HandleTrackingFileSystem interface {
+	FileSystem
+	OpenHandles() []OpenHandle
+}
@@ -0,0 +1,33 @@
+// Package assert has the checks shared by the tests of several packages
+package assert
+
+import (
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/poppels/filesys"
+)
+
+// Names checks that dir contains the expected names, and that the listing
+// agrees with Lstat about their types
+func Names(t *testing.T, fs filesys.FileSystem, dir string, expected ...string) {
+	t.Helper()
+	infos, err := fs.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+		lfi, err := fs.Lstat(path.Join(dir, fi.Name()))
+		if err != nil {
+			t.Errorf("Expected %s to exist, got %v", fi.Name(), err)
+		} else if fi.Mode().Type() != lfi.Mode().Type() {
+			t.Errorf("Expected %s to be listed as %v, got %v", fi.Name(), lfi.Mode().Type(), fi.Mode().Type())
+		}
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %s to contain %v, got %v", dir, expected, names)
+	}
+}
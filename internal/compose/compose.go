@@ -0,0 +1,86 @@
+// Package compose has the parts shared by the file systems that are made
+// of other file systems, like the mount points and the layers of overlay.
+package compose
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// FixError replaces the path in errors of the file systems with the name
+// that was passed, which may have another prefix or contain links
+func FixError(err error, name string) error {
+	if pe, ok := err.(*os.PathError); ok && pe.Path != name {
+		return &os.PathError{pe.Op, name, pe.Err}
+	}
+	return err
+}
+
+// FixLinkError replaces the paths in errors of operations on two names,
+// which are LinkErrors like the ones of the os package
+func FixLinkError(err error, oldname, newname string) error {
+	switch e := err.(type) {
+	case *os.LinkError:
+		return &os.LinkError{e.Op, oldname, newname, e.Err}
+	case *os.PathError:
+		return &os.LinkError{e.Op, oldname, newname, e.Err}
+	}
+	return err
+}
+
+// DirFile is an open directory whose contents are put together from
+// several file systems
+type DirFile struct {
+	name  string
+	fi    os.FileInfo
+	infos []os.FileInfo
+	pos   int
+}
+
+// NewDirFile returns the directory name with the file info fi, which
+// contains infos
+func NewDirFile(name string, fi os.FileInfo, infos []os.FileInfo) *DirFile {
+	return &DirFile{name: name, fi: fi, infos: infos}
+}
+
+func (f *DirFile) Read(b []byte) (int, error) {
+	return 0, &os.PathError{"read", f.name, syscall.EISDIR}
+}
+
+func (f *DirFile) Write(b []byte) (int, error) {
+	return 0, &os.PathError{"write", f.name, syscall.EBADF}
+}
+
+// Seek only supports going back to the start, to read the directory again
+func (f *DirFile) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekStart {
+		return 0, &os.PathError{"seek", f.name, syscall.EINVAL}
+	}
+	f.pos = 0
+	return 0, nil
+}
+
+func (f *DirFile) Close() error {
+	return nil
+}
+
+func (f *DirFile) Stat() (os.FileInfo, error) {
+	return f.fi, nil
+}
+
+func (f *DirFile) Readdir(n int) ([]os.FileInfo, error) {
+	rest := f.infos[f.pos:]
+	if n <= 0 {
+		f.pos = len(f.infos)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	f.pos += n
+	return rest[:n], nil
+}
@@ -0,0 +1,366 @@
+// Package glob implements the pattern matching of filesys.Glob, which is
+// shared by the filesys, fsutil and iofs packages. Patterns use the syntax
+// of path.Match, with "**" for any number of directories and braces for
+// alternatives, like "src/**/*.{go,s}". A pattern that ends with a slash
+// only matches directories.
+package glob
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// FS is the part of filesys.FileSystem needed to find files
+type FS interface {
+	Stat(string) (os.FileInfo, error)
+	Lstat(string) (os.FileInfo, error)
+	ReadDir(string) ([]os.FileInfo, error)
+	IsNotExist(error) bool
+}
+
+// globber is implemented by file systems that find files themselves
+type globber interface {
+	Glob(pattern string) ([]string, error)
+}
+
+// Glob returns the names of the files matching any of the patterns that
+// don't start with "!", and none of the patterns that do, in lexical order
+func Glob(fsys FS, patterns []string) ([]string, error) {
+	var exclude []string
+	found := map[string]bool{}
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			if _, err := Match(pattern[1:], ""); err != nil {
+				return nil, err
+			}
+			exclude = append(exclude, pattern[1:])
+			continue
+		}
+		var names []string
+		var err error
+		if g, ok := fsys.(globber); ok {
+			names, err = g.Glob(pattern)
+		} else {
+			names, err = glob(fsys, pattern)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			found[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(found))
+outer:
+	for name := range found {
+		for _, pattern := range exclude {
+			candidate := name
+			if strings.HasSuffix(pattern, "/") {
+				if fi, err := fsys.Stat(name); err == nil && fi.IsDir() {
+					candidate = strings.TrimSuffix(name, "/") + "/"
+				}
+			}
+			if ok, _ := Match(pattern, candidate); ok {
+				continue outer
+			}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Match reports whether name matches the pattern. Absolute names only
+// match absolute patterns, or patterns that start with "**". A pattern
+// that ends with a slash only matches names that end with one.
+func Match(pattern, name string) (bool, error) {
+	alternatives, err := expand(pattern)
+	if err != nil {
+		return false, err
+	}
+	var names []string
+	if path.IsAbs(name) {
+		// The root is a segment that only "**" and "/" match
+		names = append(names, "/")
+	}
+	for _, s := range strings.Split(name, "/") {
+		if s != "" {
+			names = append(names, s)
+		}
+	}
+
+	var matched bool
+	for _, alt := range alternatives {
+		segments, err := split(alt)
+		if err != nil {
+			return false, err
+		}
+		if path.IsAbs(alt) {
+			segments = append([]string{"/"}, segments...)
+		}
+		if strings.HasSuffix(alt, "/") && !strings.HasSuffix(name, "/") {
+			continue
+		}
+		if !matched && matchSegments(segments, names) {
+			matched = true
+		}
+	}
+	return matched, nil
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// glob finds the files matching a single pattern
+func glob(fsys FS, pattern string) ([]string, error) {
+	alternatives, err := expand(pattern)
+	if err != nil {
+		return nil, err
+	}
+	g := &finder{fs: fsys}
+	for _, alt := range alternatives {
+		segments, err := split(alt)
+		if err != nil {
+			return nil, err
+		}
+		start := "."
+		if path.IsAbs(alt) {
+			start = "/"
+		}
+		g.dirsOnly = strings.HasSuffix(alt, "/")
+		if err := g.find(start, segments); err != nil {
+			return nil, err
+		}
+	}
+	return g.names, nil
+}
+
+// split returns the segments of a pattern without empty ones and repeated
+// "**", and checks that they are valid
+func split(pattern string) ([]string, error) {
+	var segments []string
+	for _, s := range strings.Split(pattern, "/") {
+		if s == "" || s == "**" && len(segments) > 0 && segments[len(segments)-1] == "**" {
+			continue
+		}
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, err
+		}
+		segments = append(segments, s)
+	}
+	return segments, nil
+}
+
+type finder struct {
+	fs    FS
+	names []string
+	// dirsOnly is set for patterns that end with a slash
+	dirsOnly bool
+}
+
+// find adds the files below dir that match the segments
+func (g *finder) find(dir string, segments []string) error {
+	if len(segments) == 0 {
+		if g.dirsOnly {
+			fi, err := g.fs.Stat(dir)
+			if g.fs.IsNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if !fi.IsDir() {
+				return nil
+			}
+		}
+		g.names = append(g.names, dir)
+		return nil
+	}
+	segment := segments[0]
+
+	if segment == "**" {
+		if err := g.find(dir, segments[1:]); err != nil {
+			return err
+		}
+		infos, err := g.readDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, fi := range infos {
+			// Links aren't followed, so cycles can't be walked forever
+			if fi.IsDir() {
+				if err := g.find(join(dir, fi.Name()), segments); err != nil {
+					return err
+				}
+			} else if len(segments) == 1 && !g.dirsOnly {
+				// A final "**" also matches the files
+				g.names = append(g.names, join(dir, fi.Name()))
+			}
+		}
+		return nil
+	}
+
+	if !strings.ContainsAny(segment, `*?[\`) {
+		return g.entry(join(dir, segment), segments[1:])
+	}
+	infos, err := g.readDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range infos {
+		if ok, _ := path.Match(segment, fi.Name()); ok {
+			if err := g.entry(join(dir, fi.Name()), segments[1:]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// entry adds name if it exists and is the last segment, or continues
+// with the segments below name if it's a directory
+func (g *finder) entry(name string, segments []string) error {
+	var err error
+	if len(segments) == 0 {
+		_, err = g.fs.Lstat(name)
+	} else {
+		var fi os.FileInfo
+		if fi, err = g.fs.Stat(name); err == nil && !fi.IsDir() {
+			return nil
+		}
+	}
+	if g.fs.IsNotExist(err) {
+		// Doesn't exist, or has been removed since the directory was read
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return g.find(name, segments)
+}
+
+func (g *finder) readDir(dir string) ([]os.FileInfo, error) {
+	infos, err := g.fs.ReadDir(dir)
+	if g.fs.IsNotExist(err) {
+		return nil, nil
+	}
+	return infos, err
+}
+
+func join(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+	return path.Join(dir, name)
+}
+
+// expand returns the alternatives of the braces in a pattern.
+// "{a,b{c,d}}" expands to "a", "bc" and "bd".
+func expand(pattern string) ([]string, error) {
+	start, depth := -1, 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			i = classEnd(pattern, i)
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				// Literal, like in path.Match
+				continue
+			}
+			if depth--; depth > 0 {
+				continue
+			}
+			var expanded []string
+			for _, alt := range splitAlternatives(pattern[start+1 : i]) {
+				more, err := expand(pattern[:start] + alt + pattern[i+1:])
+				if err != nil {
+					return nil, err
+				}
+				expanded = append(expanded, more...)
+			}
+			return expanded, nil
+		}
+	}
+	if depth != 0 {
+		return nil, path.ErrBadPattern
+	}
+	return []string{pattern}, nil
+}
+
+// splitAlternatives splits the contents of braces at their top level commas
+func splitAlternatives(s string) []string {
+	var alternatives []string
+	start, depth := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			i = classEnd(s, i)
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alternatives = append(alternatives, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(alternatives, s[start:])
+}
+
+// classEnd returns the index of the end of the character class
+// that starts at i, so braces and commas in it are literal
+func classEnd(s string, i int) int {
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case ']':
+			return j
+		}
+	}
+	return len(s)
+}
+
+// Escape quotes the special characters of s, so it only matches itself
+func Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(`*?[]{}\!`, s[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
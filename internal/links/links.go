@@ -0,0 +1,91 @@
+// Package links resolves the symbolic links in paths element by element,
+// for the packages that need to know where a name leads before passing it
+// on, like the walk of a tree or a file system confined to a directory.
+// It can't use filesys.FileSystem, since filesys imports the walk package,
+// so it declares the methods it needs.
+package links
+
+import (
+	"os"
+	"path"
+	"strings"
+	"syscall"
+)
+
+// Max is the number of links followed to resolve a path,
+// like the limit of Linux
+const Max = 40
+
+// FS is the part of filesys.FileSystem needed to resolve links
+type FS interface {
+	Lstat(string) (os.FileInfo, error)
+	Readlink(string) (string, error)
+}
+
+// Resolver resolves the links in the names of FS
+type Resolver struct {
+	FS FS
+	// Rooted resolves relative names from the root, like absolute ones,
+	// instead of from the current directory
+	Rooted bool
+	// Escape is returned, if set, for relative names that lead out of the
+	// current directory, with ".." or a link to an absolute path
+	Escape error
+}
+
+// Resolve returns name with all links in it resolved, like
+// filepath.EvalSymlinks, and errors for the operation op. The last
+// element is only resolved if follow is set. Elements that can't be
+// Lstat'ed are taken as they are, since they can't be links, and the
+// error is left to the operation on the path that is returned.
+func (r Resolver) Resolve(op, name string, follow bool) (string, error) {
+	resolved := "."
+	if r.Rooted || path.IsAbs(name) {
+		resolved = "/"
+	}
+	todo := strings.Split(name, "/")
+	links := 0
+	for len(todo) > 0 {
+		part := todo[0]
+		todo = todo[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			// resolved has no links, so ".." only removes its last element
+			if resolved == "." && r.Escape != nil {
+				return "", &os.PathError{op, name, r.Escape}
+			}
+			resolved = path.Join(resolved, part)
+			continue
+		}
+
+		next := path.Join(resolved, part)
+		if len(todo) == 0 && !follow {
+			return next, nil
+		}
+		fi, err := r.FS.Lstat(next)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > Max {
+			return "", &os.PathError{op, name, syscall.ELOOP}
+		}
+		target, err := r.FS.Readlink(next)
+		if err != nil {
+			if pe, ok := err.(*os.PathError); ok {
+				return "", &os.PathError{pe.Op, name, pe.Err}
+			}
+			return "", err
+		}
+		if path.IsAbs(target) {
+			if r.Escape != nil {
+				return "", &os.PathError{op, name, r.Escape}
+			}
+			resolved = "/"
+		}
+		todo = append(strings.Split(target, "/"), todo...)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,215 @@
+// Package walk implements the traversal of directory trees that is shared
+// by the filesys and fsutil packages. It can't use filesys.FileSystem,
+// since filesys imports it, so it declares the methods it needs.
+package walk
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/poppels/filesys/internal/links"
+)
+
+// FS is the part of filesys.FileSystem needed to walk a tree
+type FS interface {
+	Stat(string) (os.FileInfo, error)
+	Lstat(string) (os.FileInfo, error)
+	Readlink(string) (string, error)
+	ReadDir(string) ([]os.FileInfo, error)
+}
+
+// Func is called for every file and directory, like filepath.WalkFunc
+type Func func(name string, fi os.FileInfo, err error) error
+
+type walker struct {
+	fs FS
+	fn Func
+	// readFirst reads directories before calling fn for them, and calls
+	// it once with the error, like filepath.Walk. Otherwise fn is called
+	// a second time for errors, like filepath.WalkDir.
+	readFirst bool
+	follow    bool
+
+	// sem bounds the number of goroutines walking directories concurrently
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	stopped atomic.Bool
+	mu      sync.Mutex
+	err     error
+}
+
+// Walk walks the tree below root with the semantics of filepath.Walk
+func Walk(fsys FS, root string, follow bool, fn Func) error {
+	return (&walker{fs: fsys, fn: fn, readFirst: true, follow: follow}).walk(root)
+}
+
+// WalkDir walks the tree below root with the semantics of filepath.WalkDir.
+// With more than one worker, directories are walked concurrently.
+func WalkDir(fsys FS, root string, follow bool, workers int, fn fs.WalkDirFunc) error {
+	w := &walker{fs: fsys, follow: follow}
+	w.fn = func(name string, fi os.FileInfo, err error) error {
+		if fi == nil {
+			return fn(name, nil, err)
+		}
+		return fn(name, fs.FileInfoToDirEntry(fi), err)
+	}
+	if workers > 1 {
+		w.sem = make(chan struct{}, workers-1)
+	}
+	return w.walk(root)
+}
+
+// stack is the list of the paths without links of the directories that
+// are being walked, from the innermost one to the root of the walk
+type stack struct {
+	real   string
+	parent *stack
+}
+
+func (s *stack) contains(real string) bool {
+	for ; s != nil; s = s.parent {
+		if s.real == real {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *walker) walk(root string) error {
+	fi, err := w.fs.Lstat(root)
+	var dirs *stack
+	if err == nil && w.follow {
+		if fi.Mode()&os.ModeSymlink != 0 {
+			fi, _ = w.followLink(root, nil, fi)
+		}
+		real, err := w.realPath(root)
+		if err != nil {
+			// Too many links
+			real = path.Clean(root)
+		}
+		dirs = &stack{real: real}
+	}
+	if err != nil {
+		err = w.fn(root, nil, err)
+	} else {
+		err = w.dir(root, dirs, fi)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		err = nil
+	}
+	if err != nil {
+		w.stop(err)
+	}
+	w.wg.Wait()
+	return w.err
+}
+
+// stop ends the walk, and records the first error
+func (w *walker) stop(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil && err != fs.SkipAll {
+		w.err = err
+	}
+	w.stopped.Store(true)
+}
+
+// dir calls fn for name, and walks its contents if it's a directory.
+// If links are followed, dirs starts with the path of name without links.
+func (w *walker) dir(name string, dirs *stack, fi os.FileInfo) error {
+	if w.stopped.Load() {
+		return fs.SkipAll
+	}
+	var infos []os.FileInfo
+	var readErr error
+	if w.readFirst && fi.IsDir() {
+		infos, readErr = w.fs.ReadDir(name)
+	}
+	err := w.fn(name, fi, readErr)
+	if err != nil || !fi.IsDir() || readErr != nil {
+		if err == fs.SkipDir && fi.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	if !w.readFirst {
+		if infos, readErr = w.fs.ReadDir(name); readErr != nil {
+			if err := w.fn(name, fi, readErr); err != nil {
+				if err == fs.SkipDir {
+					err = nil
+				}
+				return err
+			}
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	for _, info := range infos {
+		child := path.Join(name, info.Name())
+		var childDirs *stack
+		if w.follow {
+			childReal := path.Join(dirs.real, info.Name())
+			if info.Mode()&os.ModeSymlink != 0 {
+				info, childReal = w.followLink(child, dirs, info)
+			}
+			childDirs = &stack{real: childReal, parent: dirs}
+		}
+
+		if w.sem != nil && info.IsDir() {
+			select {
+			case w.sem <- struct{}{}:
+				w.wg.Add(1)
+				go func(info os.FileInfo) {
+					defer w.wg.Done()
+					defer func() { <-w.sem }()
+					if err := w.dir(child, childDirs, info); err != nil {
+						w.stop(err)
+					}
+				}(info)
+				continue
+			default:
+				// All workers are busy
+			}
+		}
+		if err := w.dir(child, childDirs, info); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// followLink returns the file info of the file or directory the link name
+// points to, and for directories their path without links. Links that
+// can't be resolved, and links to directories that contain them or are
+// being walked already, are returned as they are, so they aren't walked
+// into.
+func (w *walker) followLink(name string, dirs *stack, link os.FileInfo) (os.FileInfo, string) {
+	fi, err := w.fs.Stat(name)
+	if err != nil {
+		return link, ""
+	}
+	if !fi.IsDir() {
+		return fi, ""
+	}
+	real, err := w.realPath(name)
+	if err != nil {
+		return link, ""
+	}
+	if dirs != nil && (real == "/" || strings.HasPrefix(dirs.real, real+"/") || dirs.contains(real)) {
+		return link, ""
+	}
+	return fi, real
+}
+
+// realPath resolves all links in name, like filepath.EvalSymlinks
+func (w *walker) realPath(name string) (string, error) {
+	return links.Resolver{FS: w.fs}.Resolve("walk", name, true)
+}
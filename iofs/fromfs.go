@@ -0,0 +1,268 @@
+package iofs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/poppels/filesys"
+)
+
+// ReadOnlyFileSystem is a filesys.FileSystem backed by an fs.FS. Paths are
+// relative to the root of the fs.FS, whether they start with a slash or not.
+// Every method that would modify the file system fails with an error
+// satisfying IsPermission, as does writing to its files.
+type ReadOnlyFileSystem struct {
+	fsys fs.FS
+}
+
+// FromFS returns a read-only filesys.FileSystem for fsys
+func FromFS(fsys fs.FS) *ReadOnlyFileSystem {
+	return &ReadOnlyFileSystem{fsys: fsys}
+}
+
+func (r *ReadOnlyFileSystem) Open(name string) (filesys.File, error) {
+	fsName, err := toFSName("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := r.fsys.Open(fsName)
+	if err != nil {
+		return nil, restoreName(err, name)
+	}
+	return &readOnlyFile{file: f, name: name}, nil
+}
+
+func (r *ReadOnlyFileSystem) OpenFile(name string, flag int, perm os.FileMode) (filesys.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, &os.PathError{"open", name, os.ErrPermission}
+	}
+	return r.Open(name)
+}
+
+func (r *ReadOnlyFileSystem) Create(name string) (filesys.File, error) {
+	return nil, &os.PathError{"open", name, os.ErrPermission}
+}
+
+func (r *ReadOnlyFileSystem) Mkdir(name string, perm os.FileMode) error {
+	return &os.PathError{"mkdir", name, os.ErrPermission}
+}
+
+func (r *ReadOnlyFileSystem) MkdirAll(name string, perm os.FileMode) error {
+	return &os.PathError{"mkdir", name, os.ErrPermission}
+}
+
+func (r *ReadOnlyFileSystem) Remove(name string) error {
+	return &os.PathError{"remove", name, os.ErrPermission}
+}
+
+func (r *ReadOnlyFileSystem) RemoveAll(name string) error {
+	return &os.PathError{"remove", name, os.ErrPermission}
+}
+
+func (r *ReadOnlyFileSystem) Rename(oldPath, newPath string) error {
+	return &os.LinkError{"rename", oldPath, newPath, os.ErrPermission}
+}
+
+func (r *ReadOnlyFileSystem) Stat(name string) (os.FileInfo, error) {
+	fsName, err := toFSName("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := fs.Stat(r.fsys, fsName)
+	if err != nil {
+		return nil, restoreName(err, name)
+	}
+	return fi, nil
+}
+
+func (r *ReadOnlyFileSystem) Lstat(name string) (os.FileInfo, error) {
+	fsName, err := toFSName("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := fs.Lstat(r.fsys, fsName)
+	if err != nil {
+		return nil, restoreName(err, name)
+	}
+	return fi, nil
+}
+
+func (r *ReadOnlyFileSystem) Symlink(oldname, newname string) error {
+	return &os.LinkError{"symlink", oldname, newname, os.ErrPermission}
+}
+
+func (r *ReadOnlyFileSystem) Readlink(name string) (string, error) {
+	fsName, err := toFSName("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := r.fsys.(fs.ReadLinkFS); !ok {
+		// Without ReadLinkFS there are no symbolic links, only regular files
+		if _, err := fs.Stat(r.fsys, fsName); err != nil {
+			return "", restoreName(err, name)
+		}
+		return "", &os.PathError{"readlink", name, syscall.EINVAL}
+	}
+	target, err := fs.ReadLink(r.fsys, fsName)
+	if err != nil {
+		return "", restoreName(err, name)
+	}
+	return target, nil
+}
+
+func (r *ReadOnlyFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	return &os.PathError{"chtimes", name, os.ErrPermission}
+}
+
+func (r *ReadOnlyFileSystem) Chmod(name string, mode os.FileMode) error {
+	return &os.PathError{"chmod", name, os.ErrPermission}
+}
+
+func (r *ReadOnlyFileSystem) Chown(name string, uid, gid int) error {
+	return &os.PathError{"chown", name, os.ErrPermission}
+}
+
+func (r *ReadOnlyFileSystem) Lchown(name string, uid, gid int) error {
+	return &os.PathError{"lchown", name, os.ErrPermission}
+}
+
+func (r *ReadOnlyFileSystem) IsNotExist(err error) bool {
+	return os.IsNotExist(err)
+}
+
+func (r *ReadOnlyFileSystem) IsExist(err error) bool {
+	return os.IsExist(err)
+}
+
+func (r *ReadOnlyFileSystem) IsPermission(err error) bool {
+	return os.IsPermission(err)
+}
+
+func (r *ReadOnlyFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	fsName, err := toFSName("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(r.fsys, fsName)
+	if err != nil {
+		return nil, restoreName(err, name)
+	}
+	infos, err := entryInfos(entries)
+	if err != nil {
+		return nil, restoreName(err, name)
+	}
+	return infos, nil
+}
+
+func (r *ReadOnlyFileSystem) ReadFile(name string) ([]byte, error) {
+	fsName, err := toFSName("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fs.ReadFile(r.fsys, fsName)
+	if err != nil {
+		return nil, restoreName(err, name)
+	}
+	return data, nil
+}
+
+func (r *ReadOnlyFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return &os.PathError{"writefile", name, os.ErrPermission}
+}
+
+// toFSName converts a FileSystem path to an fs.FS name,
+// where the root of the fs.FS is both "/" and "."
+func toFSName(op, name string) (string, error) {
+	fsName := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if fsName == "" {
+		fsName = "."
+	}
+	if name == "" || !fs.ValidPath(fsName) {
+		return "", &os.PathError{op, name, fs.ErrInvalid}
+	}
+	return fsName, nil
+}
+
+// restoreName replaces the fs.FS name in an error with the original path
+func restoreName(err error, name string) error {
+	if pe, ok := err.(*fs.PathError); ok {
+		return &os.PathError{pe.Op, name, pe.Err}
+	}
+	return err
+}
+
+func entryInfos(entries []fs.DirEntry) ([]os.FileInfo, error) {
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// readOnlyFile adapts an fs.File to a filesys.File
+type readOnlyFile struct {
+	file fs.File
+	name string
+}
+
+func (f *readOnlyFile) Read(b []byte) (int, error) {
+	n, err := f.file.Read(b)
+	if err != nil && err != io.EOF {
+		err = restoreName(err, f.name)
+	}
+	return n, err
+}
+
+func (f *readOnlyFile) Write(b []byte) (int, error) {
+	return 0, &os.PathError{"write", f.name, os.ErrPermission}
+}
+
+func (f *readOnlyFile) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := f.file.(io.Seeker)
+	if !ok {
+		return 0, &os.PathError{"seek", f.name, errors.ErrUnsupported}
+	}
+	pos, err := seeker.Seek(offset, whence)
+	if err != nil {
+		return 0, restoreName(err, f.name)
+	}
+	return pos, nil
+}
+
+func (f *readOnlyFile) Close() error {
+	return restoreName(f.file.Close(), f.name)
+}
+
+func (f *readOnlyFile) Stat() (os.FileInfo, error) {
+	fi, err := f.file.Stat()
+	if err != nil {
+		return nil, restoreName(err, f.name)
+	}
+	return fi, nil
+}
+
+func (f *readOnlyFile) Readdir(n int) ([]os.FileInfo, error) {
+	dir, ok := f.file.(fs.ReadDirFile)
+	if !ok {
+		return nil, &os.PathError{"readdir", f.name, syscall.ENOTDIR}
+	}
+	entries, err := dir.ReadDir(n)
+	infos, infoErr := entryInfos(entries)
+	if infoErr != nil {
+		return nil, restoreName(infoErr, f.name)
+	}
+	if err != nil && err != io.EOF {
+		err = restoreName(err, f.name)
+	}
+	return infos, err
+}
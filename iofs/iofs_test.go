@@ -0,0 +1,181 @@
+package iofs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/fsutil"
+	"github.com/poppels/filesys/virtual"
+)
+
+var (
+	_ fs.ReadDirFS       = (*FS)(nil)
+	_ fs.ReadFileFS      = (*FS)(nil)
+	_ fs.StatFS          = (*FS)(nil)
+	_ fs.SubFS           = (*FS)(nil)
+	_ fs.GlobFS          = (*FS)(nil)
+	_ fs.ReadLinkFS      = (*FS)(nil)
+	_ filesys.FileSystem = (*ReadOnlyFileSystem)(nil)
+	_ fs.ReadDirFile     = (*dirFile)(nil)
+	_ filesys.File       = (*readOnlyFile)(nil)
+)
+
+func TestToFS(t *testing.T) {
+	files := map[string][]byte{
+		"/srv/index.html":       []byte("<html></html>"),
+		"/srv/css/style.css":    []byte("body {}"),
+		"/srv/js/app.js":        []byte("alert()"),
+		"/srv/js/vendor/lib.js": []byte("lib()"),
+		"/other.txt":            []byte("Outside")}
+	fsys := virtual.NewVirtualFilesys()
+	if err := fsutil.CreateStructure(fsys, files, []string{"/srv/empty"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Symlink("js/app.js", "/srv/link.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := fstest.TestFS(ToFS(fsys, "/srv"),
+		"index.html", "css/style.css", "js/app.js", "js/vendor/lib.js", "empty", "link.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The root of the virtual file system works too
+	if err := fstest.TestFS(ToFS(fsys, "/"), "other.txt", "srv/index.html"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// globFS finds files with fsutil.Glob, like a backend with its own Glob
+type globFS struct {
+	filesys.FileSystem
+}
+
+func (g globFS) Glob(pattern string) ([]string, error) {
+	return fsutil.Glob(g.FileSystem, pattern)
+}
+
+func TestToFSGlobFileSystem(t *testing.T) {
+	fsys := virtual.NewVirtualFilesys()
+	files := map[string][]byte{
+		"/s{r}c/a.txt":     nil,
+		"/s{r}c/b/{c}.txt": nil,
+		"/s{r}c/b/**":      nil,
+		"/s{r}c/!d":        nil}
+	if err := fsutil.CreateStructure(fsys, files, nil); err != nil {
+		t.Fatal(err)
+	}
+	// fstest checks that Glob matches the names like path.Match
+	if err := fstest.TestFS(ToFS(globFS{fsys}, "/s{r}c"), "a.txt", "b/{c}.txt", "b/**", "!d"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestToFSErrors(t *testing.T) {
+	fsys := virtual.NewVirtualFilesys()
+	fsutil.PutFile(fsys, "/srv/a.txt", []byte("Hello"))
+	iofs := ToFS(fsys, "/srv")
+
+	if _, err := iofs.Open("../a.txt"); err == nil {
+		t.Fatal("Expected error for invalid path")
+	}
+	_, err := iofs.Open("missing.txt")
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected fs.ErrNotExist, got %v", err)
+	}
+	if pe, ok := err.(*fs.PathError); !ok || pe.Path != "missing.txt" {
+		t.Fatalf("Expected error for the fs.FS path, got %v", err)
+	}
+}
+
+func TestFromFS(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"a/b/c.txt": &fstest.MapFile{Data: []byte("Hello"), Mode: 0644, ModTime: time.Now()},
+		"a/d.txt":   &fstest.MapFile{Data: []byte("Bye"), Mode: 0644, ModTime: time.Now()},
+	}
+	fsys := FromFS(mapfs)
+
+	if err := fsutil.VerifyFileContent(fsys, "/a/b/c.txt", []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsutil.VerifyFileContent(fsys, "a/d.txt", []byte("Bye")); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := fsys.ReadDir("/a")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(infos) != 2 || infos[0].Name() != "b" || infos[1].Name() != "d.txt" {
+		t.Fatalf("Unexpected directory listing %v", infos)
+	}
+	if fi, err := fsys.Stat("/"); err != nil || !fi.IsDir() {
+		t.Fatalf("Expected root directory, got %v, %v", fi, err)
+	}
+	_, err = fsys.Stat("/a/missing.txt")
+	if !fsys.IsNotExist(err) {
+		t.Fatalf("Expected os.ErrNotExist, got %v", err)
+	}
+	if pe, ok := err.(*os.PathError); !ok || pe.Path != "/a/missing.txt" {
+		t.Fatalf("Expected error for the original path, got %v", err)
+	}
+
+	f, err := fsys.Open("/a/b/c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("Bye")); !fsys.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if _, err := f.Seek(1, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(rest) != "ello" {
+		t.Fatalf("Expected 'ello', got '%s'", rest)
+	}
+
+	dir, err := fsys.Open("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+	if infos, err := dir.Readdir(-1); err != nil || len(infos) != 2 {
+		t.Fatalf("Expected 2 entries, got %d, %v", len(infos), err)
+	}
+}
+
+func TestFromFSIsReadOnly(t *testing.T) {
+	fsys := FromFS(fstest.MapFS{"a.txt": &fstest.MapFile{Data: []byte("Hello")}})
+	errs := map[string]error{
+		"Create":    second(fsys.Create("/a.txt")),
+		"OpenFile":  second(fsys.OpenFile("/a.txt", os.O_RDWR, 0)),
+		"Mkdir":     fsys.Mkdir("/b", 0777),
+		"MkdirAll":  fsys.MkdirAll("/b/c", 0777),
+		"Remove":    fsys.Remove("/a.txt"),
+		"RemoveAll": fsys.RemoveAll("/"),
+		"Rename":    fsys.Rename("/a.txt", "/b.txt"),
+		"Symlink":   fsys.Symlink("/a.txt", "/b.txt"),
+		"Chtimes":   fsys.Chtimes("/a.txt", time.Now(), time.Now()),
+		"Chmod":     fsys.Chmod("/a.txt", 0777),
+		"Chown":     fsys.Chown("/a.txt", 0, 0),
+		"Lchown":    fsys.Lchown("/a.txt", 0, 0),
+		"WriteFile": fsys.WriteFile("/a.txt", []byte("Bye"), 0666),
+	}
+	for op, err := range errs {
+		if !fsys.IsPermission(err) {
+			t.Errorf("Expected permission error from %s, got %v", op, err)
+		}
+	}
+}
+
+func second(_ filesys.File, err error) error {
+	return err
+}
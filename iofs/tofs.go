@@ -0,0 +1,219 @@
+// Package iofs adapts between filesys.FileSystem and the io/fs interfaces
+// of the standard library, so a FileSystem can be used with APIs like
+// template.ParseFS, http.FS and fs.WalkDir, and an fs.FS like embed.FS
+// can be used wherever a FileSystem is expected.
+package iofs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/internal/glob"
+)
+
+// FS is an fs.FS backed by a directory of a filesys.FileSystem.
+// It implements fs.ReadDirFS, fs.ReadFileFS, fs.StatFS, fs.SubFS,
+// fs.GlobFS and fs.ReadLinkFS.
+type FS struct {
+	fsys filesys.FileSystem
+	dir  string
+}
+
+// ToFS returns an fs.FS for the tree rooted at dir in fsys, much like
+// os.DirFS does for the real file system
+func ToFS(fsys filesys.FileSystem, dir string) *FS {
+	return &FS{fsys: fsys, dir: dir}
+}
+
+func (f *FS) Open(name string) (fs.File, error) {
+	full, err := f.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := f.fsys.Open(full)
+	if err != nil {
+		return nil, renameError(err, name)
+	}
+	return &dirFile{File: file, name: name}, nil
+}
+
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	full, err := f.join("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.fsys.Stat(full)
+	if err != nil {
+		return nil, renameError(err, name)
+	}
+	return fi, nil
+}
+
+func (f *FS) Lstat(name string) (fs.FileInfo, error) {
+	full, err := f.join("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.fsys.Lstat(full)
+	if err != nil {
+		return nil, renameError(err, name)
+	}
+	return fi, nil
+}
+
+func (f *FS) ReadLink(name string) (string, error) {
+	full, err := f.join("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	target, err := f.fsys.Readlink(full)
+	if err != nil {
+		return "", renameError(err, name)
+	}
+	return target, nil
+}
+
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	full, err := f.join("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := f.fsys.ReadFile(full)
+	if err != nil {
+		return nil, renameError(err, name)
+	}
+	return data, nil
+}
+
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	full, err := f.join("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := f.fsys.ReadDir(full)
+	if err != nil {
+		return nil, renameError(err, name)
+	}
+	return dirEntries(infos), nil
+}
+
+func (f *FS) Sub(dir string) (fs.FS, error) {
+	full, err := f.join("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	return &FS{fsys: f.fsys, dir: full}, nil
+}
+
+func (f *FS) Glob(pattern string) ([]string, error) {
+	g, ok := f.fsys.(filesys.GlobFileSystem)
+	if !ok {
+		// Hide this method from fs.Glob, so it falls back to using ReadDir
+		return fs.Glob(readDirFS{f}, pattern)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	names, err := g.Glob(path.Join(glob.Escape(f.dir), extendedPattern(pattern)))
+	if err != nil {
+		return nil, err
+	}
+	// The names start with the directory of f
+	dir := path.Clean(f.dir)
+	for i, name := range names {
+		if dir != "." {
+			name = strings.TrimPrefix(strings.TrimPrefix(name, dir), "/")
+		}
+		if name == "" {
+			name = "."
+		}
+		names[i] = name
+	}
+	return names, nil
+}
+
+// extendedPattern converts a pattern of path.Match to the syntax of
+// filesys.Match that matches the same names
+func extendedPattern(pattern string) string {
+	var b strings.Builder
+	for i, segment := range strings.Split(pattern, "/") {
+		if i > 0 {
+			b.WriteByte('/')
+		}
+		if segment == "**" {
+			// Doesn't match a separator in path.Match
+			segment = "*"
+		}
+		for j := 0; j < len(segment); j++ {
+			switch c := segment[j]; {
+			case c == '\\' && j+1 < len(segment):
+				b.WriteByte(c)
+				j++
+				b.WriteByte(segment[j])
+			case c == '{' || c == '}' || c == '!' && i == 0 && j == 0:
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			default:
+				b.WriteByte(c)
+			}
+		}
+	}
+	return b.String()
+}
+
+type readDirFS struct {
+	fs.ReadDirFS
+}
+
+// join validates an fs.FS path and returns the corresponding path in fsys
+func (f *FS) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{op, name, fs.ErrInvalid}
+	}
+	return path.Join(f.dir, name), nil
+}
+
+// renameError replaces the backend path in an error with the fs.FS name
+func renameError(err error, name string) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return &fs.PathError{pe.Op, name, pe.Err}
+	}
+	return err
+}
+
+func dirEntries(infos []os.FileInfo) []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	return entries
+}
+
+// dirFile adds the fs.ReadDirFile method to a filesys.File
+type dirFile struct {
+	filesys.File
+	name string
+}
+
+func (f *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	infos, err := f.File.Readdir(n)
+	if err == io.EOF && len(infos) > 0 {
+		err = nil
+	}
+	if err != nil {
+		err = renameError(err, f.name)
+	}
+	return dirEntries(infos), err
+}
+
+func (f *dirFile) Stat() (fs.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, renameError(err, f.name)
+	}
+	return fi, nil
+}
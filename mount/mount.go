@@ -0,0 +1,498 @@
+// Package mount combines several filesys.FileSystems into one namespace,
+// like the mount table of an operating system:
+//
+//	fs := mount.New()
+//	fs.Mount("/config", iofs.FromFS(configFS))
+//	data, _ := basepath.New(osfilesys.NewOsWrapper(), "/srv/data")
+//	fs.Mount("/data", data)
+//	fs.Mount("/tmp", virtual.NewVirtualFilesys())
+//
+// Every call goes to the file system that is mounted at the longest
+// directory that contains the name, which gets the name relative to that
+// directory, as an absolute name. Directories that contain mount points,
+// but aren't in a mounted file system themselves, are read-only
+// directories. Links are resolved by the file system they are in.
+package mount
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/internal/compose"
+)
+
+// MountFileSystem is a filesys.FileSystem that passes every call to the
+// FileSystem mounted at the directory of the name
+type MountFileSystem struct {
+	mu     sync.RWMutex
+	mounts map[string]filesys.FileSystem
+}
+
+// New returns a MountFileSystem without mounts, in which only
+// the root directory exists
+func New() *MountFileSystem {
+	return &MountFileSystem{mounts: map[string]filesys.FileSystem{}}
+}
+
+// Mount makes fs available at dir. The directories that contain dir don't
+// have to exist, and entries of a file system that are mounted over are
+// hidden. Mounting at a directory that is already a mount point fails
+// with EBUSY, and mounting nil with EINVAL.
+func (m *MountFileSystem) Mount(dir string, fs filesys.FileSystem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir = path.Join("/", dir)
+	if fs == nil {
+		return &os.PathError{"mount", dir, syscall.EINVAL}
+	}
+	if _, ok := m.mounts[dir]; ok {
+		return &os.PathError{"mount", dir, syscall.EBUSY}
+	}
+	m.mounts[dir] = fs
+	return nil
+}
+
+// Unmount removes the file system that is mounted at dir. Files that are
+// open stay usable.
+func (m *MountFileSystem) Unmount(dir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir = path.Join("/", dir)
+	if _, ok := m.mounts[dir]; !ok {
+		return &os.PathError{"unmount", dir, syscall.EINVAL}
+	}
+	delete(m.mounts, dir)
+	return nil
+}
+
+// Mounts returns the mount points in lexical order
+func (m *MountFileSystem) Mounts() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	dirs := make([]string, 0, len(m.mounts))
+	for dir := range m.mounts {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// route returns the mount point of name, its file system and the name
+// in that file system. If name isn't in a mounted file system, fs is nil.
+func (m *MountFileSystem) route(name string) (point string, fs filesys.FileSystem, inner string) {
+	p := path.Join("/", name)
+	for dir := p; ; dir = path.Dir(dir) {
+		if fs, ok := m.mounts[dir]; ok {
+			return dir, fs, path.Join("/", strings.TrimPrefix(p, dir))
+		}
+		if dir == "/" {
+			return "", nil, p
+		}
+	}
+}
+
+// children returns the names of the mount points, and of the directories
+// that contain them, directly in the directory p
+func (m *MountFileSystem) children(p string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for dir := range m.mounts {
+		rel, ok := strings.CutPrefix(dir, p)
+		if !ok || dir == p || p != "/" && rel[0] != '/' {
+			continue
+		}
+		name, _, _ := strings.Cut(strings.TrimPrefix(rel, "/"), "/")
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// busy reports whether p is a mount point or contains one
+func (m *MountFileSystem) busy(p string) bool {
+	for dir := range m.mounts {
+		if dir == p || p == "/" || strings.HasPrefix(dir, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// synthesized returns the error for modifying or creating a name that isn't
+// in a mounted file system. Only the directories with mount points exist
+// there, and they are read-only.
+func (m *MountFileSystem) synthesized(name string, create bool) error {
+	p := path.Join("/", name)
+	if _, err := m.synthesizedInfo("", p); err == nil {
+		return os.ErrPermission
+	}
+	if _, err := m.synthesizedInfo("", path.Dir(p)); err == nil && create {
+		return os.ErrPermission
+	}
+	return os.ErrNotExist
+}
+
+// synthesizedInfo returns the FileInfo of a name that isn't in a mounted
+// file system
+func (m *MountFileSystem) synthesizedInfo(op, name string) (os.FileInfo, error) {
+	p := path.Join("/", name)
+	if p != "/" && len(m.children(p)) == 0 {
+		return nil, &os.PathError{op, name, os.ErrNotExist}
+	}
+	return dirInfo{path.Base(p)}, nil
+}
+
+// stat returns the FileInfo of p, with the name of the mount point for
+// the root directory of a mounted file system
+func (m *MountFileSystem) stat(name string, follow bool) (os.FileInfo, error) {
+	point, fs, inner := m.route(name)
+	if fs == nil {
+		return m.synthesizedInfo("stat", name)
+	}
+	var fi os.FileInfo
+	var err error
+	if follow {
+		fi, err = fs.Stat(inner)
+	} else {
+		fi, err = fs.Lstat(inner)
+	}
+	if fs.IsNotExist(err) {
+		// Maybe a directory with mount points
+		return m.synthesizedInfo("stat", name)
+	}
+	if err != nil {
+		return nil, compose.FixError(err, name)
+	}
+	if inner == "/" {
+		fi = namedInfo{fi, path.Base(point)}
+	}
+	return fi, nil
+}
+
+// readDir returns the contents of the directory p, with its mount points
+func (m *MountFileSystem) readDir(name string) ([]os.FileInfo, error) {
+	p := path.Join("/", name)
+	children := m.children(p)
+	_, fs, inner := m.route(name)
+	if fs == nil {
+		if _, err := m.synthesizedInfo("readdir", name); err != nil {
+			return nil, err
+		}
+	}
+
+	var infos []os.FileInfo
+	if fs != nil {
+		var err error
+		infos, err = fs.ReadDir(inner)
+		if err != nil && !(fs.IsNotExist(err) && len(children) > 0) {
+			return nil, compose.FixError(err, name)
+		}
+	}
+	if len(children) == 0 {
+		return infos, nil
+	}
+	mounted := make(map[string]bool, len(children))
+	for _, child := range children {
+		mounted[child] = true
+	}
+	merged := make([]os.FileInfo, 0, len(infos)+len(children))
+	for _, fi := range infos {
+		if !mounted[fi.Name()] {
+			merged = append(merged, fi)
+		}
+	}
+	for _, child := range children {
+		childPath := path.Join(p, child)
+		if childFs, ok := m.mounts[childPath]; ok {
+			fi, err := childFs.Stat("/")
+			if err != nil {
+				return nil, compose.FixError(err, childPath)
+			}
+			merged = append(merged, namedInfo{fi, child})
+		} else {
+			merged = append(merged, dirInfo{child})
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+	return merged, nil
+}
+
+func (m *MountFileSystem) Open(name string) (filesys.File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens directories with mount points in them as a directory that
+// lists the mount points as well
+func (m *MountFileSystem) OpenFile(name string, flag int, perm os.FileMode) (filesys.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, fs, inner := m.route(name)
+	p := path.Join("/", name)
+	if fs != nil && len(m.children(p)) == 0 {
+		f, err := fs.OpenFile(inner, flag, perm)
+		return f, compose.FixError(err, name)
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		if fs == nil {
+			return nil, &os.PathError{"open", name, m.synthesized(name, flag&os.O_CREATE != 0)}
+		}
+		return nil, &os.PathError{"open", name, syscall.EISDIR}
+	}
+	infos, err := m.readDir(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := m.stat(name, true)
+	if err != nil {
+		return nil, err
+	}
+	return compose.NewDirFile(name, fi, infos), nil
+}
+
+func (m *MountFileSystem) Create(name string) (filesys.File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// call passes a method that modifies name to its file system
+func (m *MountFileSystem) call(op, name string, create bool, fn func(fs filesys.FileSystem, inner string) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, fs, inner := m.route(name)
+	if fs == nil {
+		return &os.PathError{op, name, m.synthesized(name, create)}
+	}
+	return compose.FixError(fn(fs, inner), name)
+}
+
+func (m *MountFileSystem) Mkdir(name string, perm os.FileMode) error {
+	return m.call("mkdir", name, true, func(fs filesys.FileSystem, inner string) error {
+		return fs.Mkdir(inner, perm)
+	})
+}
+
+// MkdirAll can't create directories outside of the mounted file systems,
+// but succeeds for those that contain mount points
+func (m *MountFileSystem) MkdirAll(name string, perm os.FileMode) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, fs, inner := m.route(name)
+	if fs == nil {
+		if _, err := m.synthesizedInfo("mkdir", name); err == nil {
+			// Already a directory
+			return nil
+		}
+		return &os.PathError{"mkdir", name, m.synthesized(name, true)}
+	}
+	return compose.FixError(fs.MkdirAll(inner, perm), name)
+}
+
+// Remove fails with EBUSY for mount points and the directories that
+// contain them
+func (m *MountFileSystem) Remove(name string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.busy(path.Join("/", name)) {
+		return &os.PathError{"remove", name, syscall.EBUSY}
+	}
+	_, fs, inner := m.route(name)
+	if fs == nil {
+		return &os.PathError{"remove", name, m.synthesized(name, false)}
+	}
+	return compose.FixError(fs.Remove(inner), name)
+}
+
+func (m *MountFileSystem) RemoveAll(name string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.busy(path.Join("/", name)) {
+		return &os.PathError{"remove", name, syscall.EBUSY}
+	}
+	_, fs, inner := m.route(name)
+	if fs == nil {
+		// Nothing is there
+		return nil
+	}
+	return compose.FixError(fs.RemoveAll(inner), name)
+}
+
+// Rename fails with EXDEV if the names are in different file systems, so
+// callers like fsutil.Move can copy instead
+func (m *MountFileSystem) Rename(oldPath, newPath string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.busy(path.Join("/", oldPath)) || m.busy(path.Join("/", newPath)) {
+		return &os.LinkError{"rename", oldPath, newPath, syscall.EBUSY}
+	}
+	oldPoint, oldFs, oldInner := m.route(oldPath)
+	newPoint, newFs, newInner := m.route(newPath)
+	switch {
+	case oldFs == nil:
+		return &os.LinkError{"rename", oldPath, newPath, m.synthesized(oldPath, false)}
+	case newFs == nil:
+		return &os.LinkError{"rename", oldPath, newPath, m.synthesized(newPath, true)}
+	case oldPoint != newPoint:
+		return &os.LinkError{"rename", oldPath, newPath, syscall.EXDEV}
+	}
+	return compose.FixLinkError(oldFs.Rename(oldInner, newInner), oldPath, newPath)
+}
+
+func (m *MountFileSystem) Stat(name string) (os.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.stat(name, true)
+}
+
+func (m *MountFileSystem) Lstat(name string) (os.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.stat(name, false)
+}
+
+// Symlink stores the target as it is, so absolute targets are resolved in
+// the file system of the link
+func (m *MountFileSystem) Symlink(oldname, newname string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, fs, inner := m.route(newname)
+	if fs == nil {
+		return &os.LinkError{"symlink", oldname, newname, m.synthesized(newname, true)}
+	}
+	return compose.FixLinkError(fs.Symlink(oldname, inner), oldname, newname)
+}
+
+func (m *MountFileSystem) Readlink(name string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, fs, inner := m.route(name)
+	if fs == nil {
+		if _, err := m.synthesizedInfo("readlink", name); err != nil {
+			return "", err
+		}
+		return "", &os.PathError{"readlink", name, syscall.EINVAL}
+	}
+	target, err := fs.Readlink(inner)
+	return target, compose.FixError(err, name)
+}
+
+func (m *MountFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	return m.call("chtimes", name, false, func(fs filesys.FileSystem, inner string) error {
+		return fs.Chtimes(inner, atime, mtime)
+	})
+}
+
+func (m *MountFileSystem) Chmod(name string, mode os.FileMode) error {
+	return m.call("chmod", name, false, func(fs filesys.FileSystem, inner string) error {
+		return fs.Chmod(inner, mode)
+	})
+}
+
+func (m *MountFileSystem) Chown(name string, uid, gid int) error {
+	return m.call("chown", name, false, func(fs filesys.FileSystem, inner string) error {
+		return fs.Chown(inner, uid, gid)
+	})
+}
+
+func (m *MountFileSystem) Lchown(name string, uid, gid int) error {
+	return m.call("lchown", name, false, func(fs filesys.FileSystem, inner string) error {
+		return fs.Lchown(inner, uid, gid)
+	})
+}
+
+// anyFs reports whether fn is true for the os package or any of the
+// mounted file systems, whose errors may be returned
+func (m *MountFileSystem) anyFs(fn func(fs filesys.FileSystem) bool) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, fs := range m.mounts {
+		if fn(fs) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MountFileSystem) IsNotExist(err error) bool {
+	return os.IsNotExist(err) || m.anyFs(func(fs filesys.FileSystem) bool { return fs.IsNotExist(err) })
+}
+
+func (m *MountFileSystem) IsExist(err error) bool {
+	return os.IsExist(err) || m.anyFs(func(fs filesys.FileSystem) bool { return fs.IsExist(err) })
+}
+
+func (m *MountFileSystem) IsPermission(err error) bool {
+	return os.IsPermission(err) || m.anyFs(func(fs filesys.FileSystem) bool { return fs.IsPermission(err) })
+}
+
+func (m *MountFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.readDir(name)
+}
+
+func (m *MountFileSystem) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, fs, inner := m.route(name)
+	if fs == nil {
+		if _, err := m.synthesizedInfo("open", name); err != nil {
+			return nil, err
+		}
+		return nil, &os.PathError{"read", name, syscall.EISDIR}
+	}
+	data, err := fs.ReadFile(inner)
+	return data, compose.FixError(err, name)
+}
+
+func (m *MountFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return m.call("open", name, true, func(fs filesys.FileSystem, inner string) error {
+		return fs.WriteFile(inner, data, perm)
+	})
+}
+
+// Statfs reports the usage of the mounted file system. It fails with
+// errors.ErrUnsupported if that doesn't implement filesys.StatfsFileSystem.
+func (m *MountFileSystem) Statfs(name string) (filesys.DiskUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, fs, inner := m.route(name)
+	sfs, ok := fs.(filesys.StatfsFileSystem)
+	if !ok {
+		return filesys.DiskUsage{}, &os.PathError{"statfs", name, errors.ErrUnsupported}
+	}
+	usage, err := sfs.Statfs(inner)
+	return usage, compose.FixError(err, name)
+}
+
+// namedInfo is the FileInfo of the root directory of a mounted file
+// system, with the name of the mount point
+type namedInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi namedInfo) Name() string {
+	return fi.name
+}
+
+// dirInfo is the FileInfo of a directory that only exists because
+// it contains mount points
+type dirInfo struct {
+	name string
+}
+
+func (fi dirInfo) Name() string       { return fi.name }
+func (fi dirInfo) Size() int64        { return 0 }
+func (fi dirInfo) Mode() os.FileMode  { return os.ModeDir | 0555 }
+func (fi dirInfo) ModTime() time.Time { return time.Time{} }
+func (fi dirInfo) IsDir() bool        { return true }
+func (fi dirInfo) Sys() interface{}   { return nil }
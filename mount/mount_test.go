@@ -0,0 +1,205 @@
+package mount
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"testing/fstest"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/basepath"
+	"github.com/poppels/filesys/filesystest"
+	"github.com/poppels/filesys/fsutil"
+	"github.com/poppels/filesys/internal/assert"
+	"github.com/poppels/filesys/internal/compose"
+	"github.com/poppels/filesys/iofs"
+	"github.com/poppels/filesys/osfilesys"
+	"github.com/poppels/filesys/virtual"
+)
+
+var (
+	_ filesys.FileSystem       = (*MountFileSystem)(nil)
+	_ filesys.StatfsFileSystem = (*MountFileSystem)(nil)
+	_ filesys.File             = (*compose.DirFile)(nil)
+)
+
+func TestConformance(t *testing.T) {
+	t.Run("Root", func(t *testing.T) {
+		filesystest.Run(t, func(t *testing.T) (filesys.FileSystem, string) {
+			fs := New()
+			fs.Mount("/", virtual.NewVirtualFilesys())
+			return fs, "/"
+		})
+	})
+	t.Run("Nested", func(t *testing.T) {
+		filesystest.Run(t, func(t *testing.T) (filesys.FileSystem, string) {
+			fs := New()
+			fs.Mount("/mnt/data", virtual.NewVirtualFilesys())
+			return fs, "/mnt/data"
+		})
+	})
+}
+
+func newMounts(t *testing.T) *MountFileSystem {
+	fs := New()
+	config := iofs.FromFS(fstest.MapFS{"app.json": {Data: []byte("{}")}})
+	if err := fs.Mount("/config", config); err != nil {
+		t.Fatal(err)
+	}
+	data, err := basepath.New(osfilesys.NewOsWrapper(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { data.Close() })
+	if err := fs.Mount("/srv/data", data); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mount("/tmp", virtual.NewVirtualFilesys()); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestRouting(t *testing.T) {
+	fs := newMounts(t)
+
+	if data, err := fs.ReadFile("/config/app.json"); err != nil || string(data) != "{}" {
+		t.Errorf("Expected the file of the embedded file system, got %q, %v", data, err)
+	}
+	if err := fs.WriteFile("/srv/data/a.txt", []byte("a"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/tmp/b.txt", []byte("b"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/config/app.json", nil, 0666); !fs.IsPermission(err) {
+		t.Errorf("Expected the embedded file system to be read-only, got %v", err)
+	}
+
+	assert.Names(t, fs, "/", "config", "srv", "tmp")
+	assert.Names(t, fs, "/srv", "data")
+	fi, err := fs.Stat("/srv/data")
+	if err != nil || fi.Name() != "data" || !fi.IsDir() {
+		t.Errorf("Expected the directory data, got %v, %v", fi, err)
+	}
+	f, err := fs.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if infos, err := f.Readdir(-1); err != nil || len(infos) != 3 {
+		t.Errorf("Expected three entries, got %v, %v", infos, err)
+	}
+
+	_, err = fs.ReadFile("/tmp/missing.txt")
+	if pe, ok := err.(*os.PathError); !ok || pe.Path != "/tmp/missing.txt" || !fs.IsNotExist(err) {
+		t.Errorf("Expected a PathError with the name passed, got %#v", err)
+	}
+	if _, err := fs.Stat("/missing"); !fs.IsNotExist(err) {
+		t.Errorf("Expected IsNotExist outside of the mounts, got %v", err)
+	}
+}
+
+func TestSynthesizedDirs(t *testing.T) {
+	fs := newMounts(t)
+
+	if err := fs.WriteFile("/a.txt", nil, 0666); !fs.IsPermission(err) {
+		t.Errorf("Expected a permission error creating a file in the root, got %v", err)
+	}
+	if err := fs.Mkdir("/srv/new", 0777); !fs.IsPermission(err) {
+		t.Errorf("Expected a permission error for Mkdir, got %v", err)
+	}
+	if err := fs.Mkdir("/missing/new", 0777); !fs.IsNotExist(err) {
+		t.Errorf("Expected IsNotExist for Mkdir in a missing directory, got %v", err)
+	}
+	if err := fs.MkdirAll("/srv", 0777); err != nil {
+		t.Errorf("Expected MkdirAll of an existing directory to work, got %v", err)
+	}
+	for _, name := range []string{"/tmp", "/srv", "/"} {
+		if err := fs.Remove(name); !errors.Is(err, syscall.EBUSY) {
+			t.Errorf("Expected EBUSY removing %s, got %v", name, err)
+		}
+		if err := fs.RemoveAll(name); !errors.Is(err, syscall.EBUSY) {
+			t.Errorf("Expected EBUSY for RemoveAll of %s, got %v", name, err)
+		}
+	}
+	if err := fs.Mount("/tmp", virtual.NewVirtualFilesys()); !errors.Is(err, syscall.EBUSY) {
+		t.Errorf("Expected EBUSY mounting twice, got %v", err)
+	}
+}
+
+func TestNestedMounts(t *testing.T) {
+	root := virtual.NewVirtualFilesys()
+	if err := root.MkdirAll("/a/b", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.WriteFile("/a/b/hidden.txt", nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Mkdir("/a/c", 0777); err != nil {
+		t.Fatal(err)
+	}
+	inner := virtual.NewVirtualFilesys()
+	if err := inner.Mkdir("/d", 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := New()
+	fs.Mount("/", root)
+	fs.Mount("/a/b", inner)
+	fs.Mount("/x/y", virtual.NewVirtualFilesys())
+
+	assert.Names(t, fs, "/", "a", "x")
+	assert.Names(t, fs, "/a", "b", "c")
+	assert.Names(t, fs, "/a/b", "d")
+	assert.Names(t, fs, "/x", "y")
+	// Not a directory of the root mount, but it contains a mount point
+	if fi, err := fs.Stat("/x"); err != nil || !fi.IsDir() {
+		t.Errorf("Expected a directory, got %v, %v", fi, err)
+	}
+
+	if err := fs.Unmount("/a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/a/b/hidden.txt"); err != nil {
+		t.Errorf("Expected the file to be visible after Unmount, got %v", err)
+	}
+	if !reflect.DeepEqual(fs.Mounts(), []string{"/", "/x/y"}) {
+		t.Errorf("Expected the remaining mounts, got %v", fs.Mounts())
+	}
+
+	if err := fs.Mount("/nil", nil); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("Expected EINVAL for mounting nil, got %v", err)
+	}
+	if fs.IsNotExist(os.ErrExist) {
+		t.Error("Expected ErrExist not to satisfy IsNotExist")
+	}
+}
+
+func TestRenameAcrossMounts(t *testing.T) {
+	fs := newMounts(t)
+	if err := fs.WriteFile("/tmp/a.txt", []byte("a"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	err := fs.Rename("/tmp/a.txt", "/srv/data/a.txt")
+	if !errors.Is(err, syscall.EXDEV) {
+		t.Fatalf("Expected EXDEV, got %v", err)
+	}
+	if err := fs.Rename("/tmp/a.txt", "/tmp/b.txt"); err != nil {
+		t.Errorf("Expected to rename within a mount, got %v", err)
+	}
+
+	// Move copies instead
+	if err := fsutil.Move(fs, "/srv/data/b.txt", fs, "/tmp/b.txt", fsutil.CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := fs.ReadFile("/srv/data/b.txt"); err != nil || string(data) != "a" {
+		t.Errorf("Expected the moved file, got %q, %v", data, err)
+	}
+	if _, err := fs.Stat("/tmp/b.txt"); !fs.IsNotExist(err) {
+		t.Errorf("Expected the file to be moved, got %v", err)
+	}
+}
@@ -20,6 +20,11 @@ func (OsFileSystem) Open(name string) (filesys.File, error) {
 	return file, err
 }
 
+func (OsFileSystem) OpenFile(name string, flag int, perm os.FileMode) (filesys.File, error) {
+	file, err := os.OpenFile(name, flag, perm)
+	return file, err
+}
+
 func (OsFileSystem) Create(name string) (filesys.File, error) {
 	file, err := os.Create(name)
 	return file, err
@@ -50,10 +55,36 @@ func (OsFileSystem) Stat(name string) (os.FileInfo, error) {
 	return fi, err
 }
 
+func (OsFileSystem) Lstat(name string) (os.FileInfo, error) {
+	fi, err := os.Lstat(name)
+	return fi, err
+}
+
+func (OsFileSystem) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (OsFileSystem) Readlink(name string) (string, error) {
+	target, err := os.Readlink(name)
+	return target, err
+}
+
 func (OsFileSystem) Chtimes(name string, atime, mtime time.Time) error {
 	return os.Chtimes(name, atime, mtime)
 }
 
+func (OsFileSystem) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (OsFileSystem) Chown(name string, uid, gid int) error {
+	return os.Chown(name, uid, gid)
+}
+
+func (OsFileSystem) Lchown(name string, uid, gid int) error {
+	return os.Lchown(name, uid, gid)
+}
+
 func (OsFileSystem) IsNotExist(err error) bool {
 	return os.IsNotExist(err)
 }
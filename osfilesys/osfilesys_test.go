@@ -0,0 +1,32 @@
+package osfilesys
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/filesystest"
+)
+
+func TestConformance(t *testing.T) {
+	filesystest.Run(t, func(t *testing.T) (filesys.FileSystem, string) {
+		return NewOsWrapper(), t.TempDir()
+	})
+}
+
+func TestStatfs(t *testing.T) {
+	fs := NewOsWrapper().(filesys.StatfsFileSystem)
+	usage, err := fs.Statfs(t.TempDir())
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Total == 0 || usage.Free > usage.Total || usage.Available > usage.Free {
+		t.Fatalf("Unexpected usage %+v", usage)
+	}
+	if _, err := fs.Statfs("/does/not/exist"); !fs.IsNotExist(err) {
+		t.Fatalf("Expected not exist error, got %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd
+
+package osfilesys
+
+import (
+	"errors"
+	"os"
+
+	"github.com/poppels/filesys"
+)
+
+func (OsFileSystem) Statfs(name string) (filesys.DiskUsage, error) {
+	return filesys.DiskUsage{}, &os.PathError{"statfs", name, errors.ErrUnsupported}
+}
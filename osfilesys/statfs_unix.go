@@ -0,0 +1,25 @@
+//go:build linux || darwin || freebsd
+
+package osfilesys
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/poppels/filesys"
+)
+
+func (OsFileSystem) Statfs(name string) (filesys.DiskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(name, &st); err != nil {
+		return filesys.DiskUsage{}, &os.PathError{"statfs", name, err}
+	}
+	// The field types differ between platforms
+	bsize := uint64(st.Bsize)
+	return filesys.DiskUsage{
+		Total:     uint64(st.Blocks) * bsize,
+		Free:      uint64(st.Bfree) * bsize,
+		Available: uint64(st.Bavail) * bsize,
+		Files:     uint64(st.Files),
+		FreeFiles: uint64(st.Ffree)}, nil
+}
@@ -0,0 +1,867 @@
+// Package overlay combines two filesys.FileSystems into one, like the
+// overlay file system of Linux. Reads go through to the base layer, which
+// is never modified, and files are copied up to the upper layer before
+// they are modified:
+//
+//	base, _ := basepath.New(osfilesys.NewOsWrapper(), "testdata/fixture")
+//	fs := overlay.New(base, virtual.NewVirtualFilesys())
+//	// Runs against the fixture, but only changes the virtual file system
+//	runApp(fs)
+//	changes, _ := fs.Changes()
+//
+// Removed entries of the base layer are hidden by whiteouts, which are kept
+// in memory, and the contents of directories are merged from both layers.
+// Both layers are used with absolute names, relative names are relative to
+// the root directory.
+package overlay
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/fsutil"
+	"github.com/poppels/filesys/internal/compose"
+	"github.com/poppels/filesys/internal/links"
+)
+
+const permBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// OverlayFileSystem is a filesys.FileSystem that shows the upper layer on
+// top of the base layer, and only modifies the upper layer
+type OverlayFileSystem struct {
+	base, upper filesys.FileSystem
+	mu          sync.RWMutex
+	// whiteout are the entries of the base layer that were removed
+	whiteout map[string]bool
+	// opaque are the entries of the upper layer that replace an entry of
+	// the base layer that was removed, so the contents of the directories
+	// aren't merged
+	opaque map[string]bool
+}
+
+// New returns an OverlayFileSystem of base with upper on top of it.
+// The upper layer is normally an empty virtual file system.
+func New(base, upper filesys.FileSystem) *OverlayFileSystem {
+	return &OverlayFileSystem{
+		base:     base,
+		upper:    upper,
+		whiteout: map[string]bool{},
+		opaque:   map[string]bool{},
+	}
+}
+
+func (o *OverlayFileSystem) layer(upper bool) filesys.FileSystem {
+	if upper {
+		return o.upper
+	}
+	return o.base
+}
+
+// baseVisible reports whether the entry p of the base layer is part of
+// the overlay, if it exists
+func (o *OverlayFileSystem) baseVisible(p string) bool {
+	if len(o.whiteout) == 0 && len(o.opaque) == 0 {
+		return true
+	}
+	if o.whiteout[p] {
+		return false
+	}
+	for q := p; q != "/"; {
+		q = path.Dir(q)
+		if o.whiteout[q] || o.opaque[q] {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the entry p, a path without links in its directories,
+// and whether it's in the upper layer
+func (o *OverlayFileSystem) lookup(p string) (os.FileInfo, bool, error) {
+	fi, err := o.upper.Lstat(p)
+	if err == nil || !o.upper.IsNotExist(err) || !o.baseVisible(p) {
+		return fi, true, err
+	}
+	fi, err = o.base.Lstat(p)
+	return fi, false, err
+}
+
+// resolve returns the absolute path of name with all links resolved,
+// following them from one layer to the other. The last element is only
+// resolved if follow is set.
+func (o *OverlayFileSystem) resolve(op, name string, follow bool) (string, error) {
+	return links.Resolver{FS: merged{o}, Rooted: true}.Resolve(op, name, follow)
+}
+
+// merged looks up entries in the layer they are visible in
+type merged struct {
+	o *OverlayFileSystem
+}
+
+func (m merged) Lstat(p string) (os.FileInfo, error) {
+	fi, _, err := m.o.lookup(p)
+	return fi, err
+}
+
+func (m merged) Readlink(p string) (string, error) {
+	_, upper, err := m.o.lookup(p)
+	if err != nil {
+		return "", err
+	}
+	return m.o.layer(upper).Readlink(p)
+}
+
+// ensureParent copies the parent directory of p up, if it isn't in the
+// upper layer yet, so an entry can be created in it
+func (o *OverlayFileSystem) ensureParent(op, p string) error {
+	dir := path.Dir(p)
+	fi, upper, err := o.lookup(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &os.PathError{op, p, syscall.ENOTDIR}
+	}
+	if !upper {
+		return o.copyUp(dir)
+	}
+	return nil
+}
+
+// copyUp copies the entry p of the base layer to the upper layer, without
+// the contents of directories
+func (o *OverlayFileSystem) copyUp(p string) error {
+	if err := o.ensureParent("copyup", p); err != nil {
+		return err
+	}
+	fi, err := o.base.Lstat(p)
+	if err != nil {
+		return err
+	}
+
+	// Copying up is possible in read-only directories
+	dir := path.Dir(p)
+	if dfi, err := o.upper.Stat(dir); err == nil && dfi.Mode()&0300 != 0300 {
+		if err := o.upper.Chmod(dir, dfi.Mode()&permBits|0300); err != nil {
+			return err
+		}
+		defer o.upper.Chmod(dir, dfi.Mode()&permBits)
+	}
+
+	if !fi.IsDir() {
+		return fsutil.Copy(o.upper, p, o.base, p, fsutil.CopyOptions{})
+	}
+	if err := o.upper.Mkdir(p, 0700); err != nil {
+		return err
+	}
+	if err := o.upper.Chmod(p, fi.Mode()&permBits); err != nil {
+		return err
+	}
+	atime := filesys.Times(fi).AccessTime
+	if atime.IsZero() {
+		atime = fi.ModTime()
+	}
+	return o.upper.Chtimes(p, atime, fi.ModTime())
+}
+
+// copyUpTree copies the entry p, and for directories everything in them,
+// to the upper layer, as far as it isn't there yet
+func (o *OverlayFileSystem) copyUpTree(p string) error {
+	fi, upper, err := o.lookup(p)
+	if err != nil {
+		return err
+	}
+	if !upper {
+		if err := o.copyUp(p); err != nil {
+			return err
+		}
+	}
+	if !fi.IsDir() {
+		return nil
+	}
+	infos, err := o.readDir(p)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if err := o.copyUpTree(path.Join(p, info.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// created records that p was created in the upper layer. If the base layer
+// has an entry p, it was removed or is replaced, and is hidden.
+func (o *OverlayFileSystem) created(p string) {
+	o.forget(p)
+	if _, err := o.base.Lstat(p); err == nil {
+		o.opaque[p] = true
+	}
+}
+
+// removed records that p was removed from the upper layer, and adds a
+// whiteout if the base layer has it
+func (o *OverlayFileSystem) removed(p string, inBase bool) {
+	o.forget(p)
+	if inBase {
+		o.whiteout[p] = true
+	}
+}
+
+// inBase reports whether p is an entry of the base layer that is visible
+func (o *OverlayFileSystem) inBase(p string) bool {
+	if !o.baseVisible(p) {
+		return false
+	}
+	_, err := o.base.Lstat(p)
+	return err == nil
+}
+
+// forget removes the whiteouts of p and everything in it
+func (o *OverlayFileSystem) forget(p string) {
+	for _, m := range []map[string]bool{o.whiteout, o.opaque} {
+		for name := range m {
+			if name == p || strings.HasPrefix(name, p+"/") || p == "/" {
+				delete(m, name)
+			}
+		}
+	}
+}
+
+// readDir returns the merged contents of the directory p
+func (o *OverlayFileSystem) readDir(p string) ([]os.FileInfo, error) {
+	infos, err := o.upper.ReadDir(p)
+	if err != nil && !o.upper.IsNotExist(err) {
+		return nil, err
+	}
+	if !o.baseVisible(p) || o.opaque[p] {
+		return infos, nil
+	}
+	baseInfos, err := o.base.ReadDir(p)
+	if o.base.IsNotExist(err) {
+		return infos, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(infos))
+	for _, fi := range infos {
+		names[fi.Name()] = true
+	}
+	for _, fi := range baseInfos {
+		if !names[fi.Name()] && !o.whiteout[path.Join(p, fi.Name())] {
+			infos = append(infos, fi)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (o *OverlayFileSystem) Open(name string) (filesys.File, error) {
+	return o.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (o *OverlayFileSystem) OpenFile(name string, flag int, perm os.FileMode) (filesys.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		p, create, err := o.prepareWrite(name, flag)
+		if err != nil {
+			return nil, compose.FixError(err, name)
+		}
+		f, err := o.upper.OpenFile(p, flag, perm)
+		if err != nil {
+			return nil, compose.FixError(err, name)
+		}
+		if create {
+			o.created(p)
+		}
+		return f, nil
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	p, err := o.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	fi, upper, err := o.lookup(p)
+	if err != nil {
+		return nil, compose.FixError(err, name)
+	}
+	if fi.IsDir() {
+		infos, err := o.readDir(p)
+		if err != nil {
+			return nil, compose.FixError(err, name)
+		}
+		return compose.NewDirFile(name, fi, infos), nil
+	}
+	f, err := o.layer(upper).OpenFile(p, flag, perm)
+	if err != nil {
+		return nil, compose.FixError(err, name)
+	}
+	if !upper {
+		f = &baseFile{File: f, name: name}
+	}
+	return f, nil
+}
+
+// prepareWrite copies the file name up, or its directory if it doesn't
+// exist, and returns its path and whether it will be created
+func (o *OverlayFileSystem) prepareWrite(name string, flag int) (string, bool, error) {
+	if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		// Like os, anything at name exists, also a dangling link
+		p, err := o.resolve("open", name, false)
+		if err != nil {
+			return "", false, err
+		}
+		if _, _, err := o.lookup(p); err == nil {
+			return "", false, &os.PathError{"open", name, os.ErrExist}
+		}
+	}
+	p, err := o.resolve("open", name, true)
+	if err != nil {
+		return "", false, err
+	}
+	fi, upper, err := o.lookup(p)
+	switch {
+	case err == nil && fi.IsDir():
+		return "", false, &os.PathError{"open", name, syscall.EISDIR}
+	case err == nil && !upper:
+		return p, false, o.copyUp(p)
+	case err == nil:
+		return p, false, nil
+	case !o.IsNotExist(err) || flag&os.O_CREATE == 0:
+		return "", false, err
+	}
+	return p, true, o.ensureParent("open", p)
+}
+
+func (o *OverlayFileSystem) Create(name string) (filesys.File, error) {
+	return o.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (o *OverlayFileSystem) Mkdir(name string, perm os.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve("mkdir", name, false)
+	if err != nil {
+		return err
+	}
+	return compose.FixError(o.mkdir(p, perm), name)
+}
+
+func (o *OverlayFileSystem) mkdir(p string, perm os.FileMode) error {
+	if _, _, err := o.lookup(p); err == nil {
+		return &os.PathError{"mkdir", p, os.ErrExist}
+	}
+	if err := o.ensureParent("mkdir", p); err != nil {
+		return err
+	}
+	if err := o.upper.Mkdir(p, perm); err != nil {
+		return err
+	}
+	o.created(p)
+	return nil
+}
+
+func (o *OverlayFileSystem) MkdirAll(name string, perm os.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	dir := ""
+	for _, part := range strings.Split(name, "/") {
+		if part == "" {
+			continue
+		}
+		dir += "/" + part
+		p, err := o.resolve("mkdir", dir, true)
+		if err != nil {
+			return err
+		}
+		fi, _, err := o.lookup(p)
+		switch {
+		case err == nil && fi.IsDir():
+			continue
+		case err == nil:
+			return &os.PathError{"mkdir", name, syscall.ENOTDIR}
+		case !o.IsNotExist(err):
+			return compose.FixError(err, name)
+		}
+		if err := o.mkdir(p, perm); err != nil {
+			return compose.FixError(err, name)
+		}
+	}
+	return nil
+}
+
+func (o *OverlayFileSystem) Remove(name string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve("remove", name, false)
+	if err != nil {
+		return err
+	}
+	fi, upper, err := o.lookup(p)
+	if err != nil {
+		return compose.FixError(err, name)
+	}
+	if fi.IsDir() {
+		infos, err := o.readDir(p)
+		if err != nil {
+			return compose.FixError(err, name)
+		}
+		if len(infos) > 0 {
+			return &os.PathError{"remove", name, syscall.ENOTEMPTY}
+		}
+	}
+	inBase := o.inBase(p)
+	if upper {
+		if err := o.upper.Remove(p); err != nil {
+			return compose.FixError(err, name)
+		}
+	}
+	o.removed(p, inBase)
+	return nil
+}
+
+func (o *OverlayFileSystem) RemoveAll(name string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve("remove", name, false)
+	if err != nil {
+		return err
+	}
+	_, upper, err := o.lookup(p)
+	if o.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return compose.FixError(err, name)
+	}
+	inBase := o.inBase(p)
+	if upper {
+		if err := o.upper.RemoveAll(p); err != nil {
+			return compose.FixError(err, name)
+		}
+	}
+	o.removed(p, inBase)
+	return nil
+}
+
+// Rename copies everything below a directory of the base layer up,
+// before it's renamed in the upper layer
+func (o *OverlayFileSystem) Rename(oldPath, newPath string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	err := o.rename(oldPath, newPath)
+	return compose.FixLinkError(err, oldPath, newPath)
+}
+
+func (o *OverlayFileSystem) rename(oldPath, newPath string) error {
+	oldP, err := o.resolve("rename", oldPath, false)
+	if err != nil {
+		return err
+	}
+	newP, err := o.resolve("rename", newPath, false)
+	if err != nil {
+		return err
+	}
+	fi, _, err := o.lookup(oldP)
+	if err != nil {
+		return err
+	}
+	if oldP == newP {
+		return nil
+	}
+	if strings.HasPrefix(newP, oldP+"/") || oldP == "/" {
+		return &os.PathError{"rename", oldPath, syscall.EINVAL}
+	}
+
+	existing, _, err := o.lookup(newP)
+	switch {
+	case err == nil && fi.IsDir() && !existing.IsDir():
+		return &os.PathError{"rename", newPath, syscall.ENOTDIR}
+	case err == nil && !fi.IsDir() && existing.IsDir():
+		return &os.PathError{"rename", newPath, syscall.EISDIR}
+	case err == nil && existing.IsDir():
+		infos, err := o.readDir(newP)
+		if err != nil {
+			return err
+		}
+		if len(infos) > 0 {
+			return &os.PathError{"rename", newPath, syscall.ENOTEMPTY}
+		}
+	case err != nil && !o.IsNotExist(err):
+		return err
+	}
+
+	if err := o.ensureParent("rename", newP); err != nil {
+		return err
+	}
+	inBase := o.inBase(oldP)
+	if err := o.copyUpTree(oldP); err != nil {
+		return err
+	}
+	if err := o.upper.Rename(oldP, newP); err != nil {
+		return err
+	}
+	o.removed(oldP, inBase)
+	o.created(newP)
+	return nil
+}
+
+func (o *OverlayFileSystem) Stat(name string) (os.FileInfo, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	p, err := o.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	fi, _, err := o.lookup(p)
+	return fi, compose.FixError(err, name)
+}
+
+func (o *OverlayFileSystem) Lstat(name string) (os.FileInfo, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	p, err := o.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	fi, _, err := o.lookup(p)
+	return fi, compose.FixError(err, name)
+}
+
+func (o *OverlayFileSystem) Symlink(oldname, newname string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve("symlink", newname, false)
+	if err != nil {
+		return compose.FixLinkError(err, oldname, newname)
+	}
+	if _, _, err := o.lookup(p); err == nil {
+		return &os.LinkError{"symlink", oldname, newname, os.ErrExist}
+	}
+	if err := o.ensureParent("symlink", p); err != nil {
+		return compose.FixLinkError(err, oldname, newname)
+	}
+	if err := o.upper.Symlink(oldname, p); err != nil {
+		return compose.FixLinkError(err, oldname, newname)
+	}
+	o.created(p)
+	return nil
+}
+
+func (o *OverlayFileSystem) Readlink(name string) (string, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	p, err := o.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	_, upper, err := o.lookup(p)
+	if err != nil {
+		return "", compose.FixError(err, name)
+	}
+	target, err := o.layer(upper).Readlink(p)
+	return target, compose.FixError(err, name)
+}
+
+// modify copies name up, and then modifies it in the upper layer
+func (o *OverlayFileSystem) modify(op, name string, follow bool, fn func(p string) error) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve(op, name, follow)
+	if err != nil {
+		return err
+	}
+	_, upper, err := o.lookup(p)
+	if err != nil {
+		return compose.FixError(err, name)
+	}
+	if !upper {
+		if err := o.copyUp(p); err != nil {
+			return compose.FixError(err, name)
+		}
+	}
+	return compose.FixError(fn(p), name)
+}
+
+func (o *OverlayFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	return o.modify("chtimes", name, true, func(p string) error {
+		return o.upper.Chtimes(p, atime, mtime)
+	})
+}
+
+func (o *OverlayFileSystem) Chmod(name string, mode os.FileMode) error {
+	return o.modify("chmod", name, true, func(p string) error {
+		return o.upper.Chmod(p, mode)
+	})
+}
+
+func (o *OverlayFileSystem) Chown(name string, uid, gid int) error {
+	return o.modify("chown", name, true, func(p string) error {
+		return o.upper.Chown(p, uid, gid)
+	})
+}
+
+func (o *OverlayFileSystem) Lchown(name string, uid, gid int) error {
+	return o.modify("lchown", name, false, func(p string) error {
+		return o.upper.Lchown(p, uid, gid)
+	})
+}
+
+func (o *OverlayFileSystem) IsNotExist(err error) bool {
+	return os.IsNotExist(err) || o.upper.IsNotExist(err) || o.base.IsNotExist(err)
+}
+
+func (o *OverlayFileSystem) IsExist(err error) bool {
+	return os.IsExist(err) || o.upper.IsExist(err) || o.base.IsExist(err)
+}
+
+func (o *OverlayFileSystem) IsPermission(err error) bool {
+	return os.IsPermission(err) || o.upper.IsPermission(err) || o.base.IsPermission(err)
+}
+
+func (o *OverlayFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	p, err := o.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	fi, _, err := o.lookup(p)
+	if err != nil {
+		return nil, compose.FixError(err, name)
+	}
+	if !fi.IsDir() {
+		return nil, &os.PathError{"readdir", name, syscall.ENOTDIR}
+	}
+	infos, err := o.readDir(p)
+	return infos, compose.FixError(err, name)
+}
+
+func (o *OverlayFileSystem) ReadFile(name string) ([]byte, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	p, err := o.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	_, upper, err := o.lookup(p)
+	if err != nil {
+		return nil, compose.FixError(err, name)
+	}
+	data, err := o.layer(upper).ReadFile(p)
+	return data, compose.FixError(err, name)
+}
+
+func (o *OverlayFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, create, err := o.prepareWrite(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return compose.FixError(err, name)
+	}
+	if err := o.upper.WriteFile(p, data, perm); err != nil {
+		return compose.FixError(err, name)
+	}
+	if create {
+		o.created(p)
+	}
+	return nil
+}
+
+// ChangeKind is the kind of a change of the overlay to the base layer
+type ChangeKind int
+
+const (
+	// Created entries don't exist in the base layer
+	Created ChangeKind = iota
+	// Modified entries have different contents, types, permissions or,
+	// except for directories, modification times than in the base layer
+	Modified
+	// Deleted entries only exist in the base layer
+	Deleted
+)
+
+var changeKindNames = [...]string{"created", "modified", "deleted"}
+
+func (k ChangeKind) String() string {
+	if k < 0 || int(k) >= len(changeKindNames) {
+		return fmt.Sprintf("ChangeKind(%d)", int(k))
+	}
+	return changeKindNames[k]
+}
+
+// Change is an entry of the overlay that differs from the base layer
+type Change struct {
+	Path string
+	Kind ChangeKind
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s", c.Kind, c.Path)
+}
+
+// Changes returns the differences between the overlay and the base layer,
+// in lexical order. Deleted directories are reported without their
+// contents. Files that were copied up, but not modified, aren't reported.
+func (o *OverlayFileSystem) Changes() ([]Change, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.changes()
+}
+
+func (o *OverlayFileSystem) changes() ([]Change, error) {
+	var changes []Change
+	for p := range o.whiteout {
+		if _, err := o.base.Lstat(p); err == nil {
+			changes = append(changes, Change{p, Deleted})
+		}
+	}
+	for p := range o.opaque {
+		infos, err := o.base.ReadDir(p)
+		if err != nil {
+			// Not a directory in the base layer
+			continue
+		}
+		for _, fi := range infos {
+			name := path.Join(p, fi.Name())
+			if _, err := o.upper.Lstat(name); o.upper.IsNotExist(err) {
+				changes = append(changes, Change{name, Deleted})
+			}
+		}
+	}
+	changes, err := o.upperChanges("/", changes)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// upperChanges adds the entries in the directory dir of the upper layer
+// that differ from the base layer
+func (o *OverlayFileSystem) upperChanges(dir string, changes []Change) ([]Change, error) {
+	infos, err := o.upper.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range infos {
+		p := path.Join(dir, fi.Name())
+		baseFi, err := o.base.Lstat(p)
+		if err != nil {
+			changes = append(changes, Change{p, Created})
+		} else if modified, err := o.modified(p, baseFi, fi); err != nil {
+			return nil, err
+		} else if modified {
+			changes = append(changes, Change{p, Modified})
+		}
+		if fi.IsDir() {
+			if changes, err = o.upperChanges(p, changes); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return changes, nil
+}
+
+// modified reports whether the entry p differs between the layers
+func (o *OverlayFileSystem) modified(p string, baseFi, upperFi os.FileInfo) (bool, error) {
+	switch {
+	case baseFi.Mode().Type() != upperFi.Mode().Type():
+		return true, nil
+	case baseFi.Mode()&os.ModeSymlink != 0:
+		baseTarget, err := o.base.Readlink(p)
+		if err != nil {
+			return false, err
+		}
+		upperTarget, err := o.upper.Readlink(p)
+		return baseTarget != upperTarget, err
+	case baseFi.Mode()&permBits != upperFi.Mode()&permBits:
+		return true, nil
+	case baseFi.IsDir():
+		// Their modification times change with their contents
+		return false, nil
+	case !baseFi.ModTime().Equal(upperFi.ModTime()) || baseFi.Size() != upperFi.Size():
+		return true, nil
+	}
+	baseData, err := o.base.ReadFile(p)
+	if err != nil {
+		return false, err
+	}
+	upperData, err := o.upper.ReadFile(p)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(baseData, upperData), nil
+}
+
+// Commit applies the changes to the base layer, after which the overlay
+// has no more changes. If it fails, the changes that were applied so far
+// stay applied.
+func (o *OverlayFileSystem) Commit() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	changes, err := o.changes()
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		if err := o.commit(c); err != nil {
+			return err
+		}
+	}
+	// The base layer matches the overlay now
+	o.whiteout = map[string]bool{}
+	o.opaque = map[string]bool{}
+	return nil
+}
+
+func (o *OverlayFileSystem) commit(c Change) error {
+	if c.Kind == Deleted {
+		return o.base.RemoveAll(c.Path)
+	}
+	fi, err := o.upper.Lstat(c.Path)
+	if err != nil {
+		return err
+	}
+	existing, err := o.base.Lstat(c.Path)
+	exists := err == nil
+	if exists && existing.IsDir() != fi.IsDir() {
+		if err := o.base.RemoveAll(c.Path); err != nil {
+			return err
+		}
+		exists = false
+	}
+	if !fi.IsDir() {
+		return fsutil.Copy(o.base, c.Path, o.upper, c.Path, fsutil.CopyOptions{Overwrite: fsutil.Overwrite})
+	}
+	if !exists {
+		if err := o.base.Mkdir(c.Path, 0700); err != nil {
+			return err
+		}
+	}
+	return o.base.Chmod(c.Path, fi.Mode()&permBits)
+}
+
+// baseFile is a file of the base layer, which is opened for reading only
+type baseFile struct {
+	filesys.File
+	name string
+}
+
+func (f *baseFile) Write(b []byte) (int, error) {
+	return 0, &os.PathError{"write", f.name, syscall.EBADF}
+}
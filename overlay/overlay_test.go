@@ -0,0 +1,349 @@
+package overlay
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/basepath"
+	"github.com/poppels/filesys/filesystest"
+	"github.com/poppels/filesys/fsutil"
+	"github.com/poppels/filesys/internal/assert"
+	"github.com/poppels/filesys/osfilesys"
+	"github.com/poppels/filesys/virtual"
+)
+
+var (
+	_ filesys.FileSystem = (*OverlayFileSystem)(nil)
+	_ filesys.File       = (*baseFile)(nil)
+)
+
+func TestConformance(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		filesystest.Run(t, func(t *testing.T) (filesys.FileSystem, string) {
+			return New(virtual.NewVirtualFilesys(), virtual.NewVirtualFilesys()), "/"
+		})
+	})
+	t.Run("Base", func(t *testing.T) {
+		// The directory of the tests only exists in the base layer
+		filesystest.Run(t, func(t *testing.T) (filesys.FileSystem, string) {
+			base := virtual.NewVirtualFilesys()
+			if err := base.MkdirAll("/test", 0777); err != nil {
+				t.Fatal(err)
+			}
+			return New(base, virtual.NewVirtualFilesys()), "/test"
+		})
+	})
+}
+
+var fixtureTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newFixture returns an overlay of a base layer with the files of
+// the txtar archive, and the base layer
+func newFixture(t *testing.T) (*OverlayFileSystem, *virtual.VirtualFileSystem) {
+	base := virtual.NewVirtualFilesysWithClock(virtual.FixedClock(fixtureTime))
+	err := fsutil.PutTxtar(base, "/", fsutil.ParseTxtar([]byte(`
+-- etc/app.conf --
+debug = false
+-- data/a.txt --
+a
+-- data/b.txt --
+b
+-- data/sub/c.txt --
+c
+`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(base, virtual.NewVirtualFilesys()), base
+}
+
+func expectContent(t *testing.T, fs filesys.FileSystem, name, expected string) {
+	t.Helper()
+	data, err := fs.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Errorf("Expected %s to contain %q, got %q", name, expected, data)
+	}
+}
+
+func TestCopyUp(t *testing.T) {
+	fs, base := newFixture(t)
+
+	if err := fs.WriteFile("/etc/app.conf", []byte("debug = true\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.OpenFile("/data/a.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("a\n"))
+	f.Close()
+	if err := fs.WriteFile("/data/sub/d.txt", []byte("d\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	expectContent(t, fs, "/etc/app.conf", "debug = true\n")
+	expectContent(t, fs, "/data/a.txt", "a\na\n")
+	expectContent(t, base, "/etc/app.conf", "debug = false\n")
+	expectContent(t, base, "/data/a.txt", "a\n")
+	if _, err := base.Stat("/data/sub/d.txt"); !base.IsNotExist(err) {
+		t.Errorf("Expected the base layer to be unchanged, got %v", err)
+	}
+	assert.Names(t, fs, "/data", "a.txt", "b.txt", "sub")
+	assert.Names(t, fs, "/data/sub", "c.txt", "d.txt")
+
+	// Files of the base layer can be read, but not written through a file
+	// opened for reading
+	f, err = fs.Open("/data/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("Expected an error writing to a file opened for reading")
+	}
+
+	// Changing the mode copies up as well
+	if err := fs.Chmod("/data/b.txt", 0600); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := base.Stat("/data/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() == 0600 {
+		t.Errorf("Expected the mode in the base layer to be unchanged, got %v", fi.Mode())
+	}
+}
+
+func TestWhiteout(t *testing.T) {
+	fs, base := newFixture(t)
+
+	if err := fs.Remove("/data/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/data/a.txt"); !fs.IsNotExist(err) {
+		t.Errorf("Expected a removed file to be gone, got %v", err)
+	}
+	assert.Names(t, fs, "/data", "b.txt", "sub")
+	if err := fs.Remove("/data"); err == nil {
+		t.Error("Expected an error removing a directory that isn't empty")
+	}
+
+	if err := fs.RemoveAll("/data/sub"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Names(t, fs, "/data", "b.txt")
+	// A directory that is created again is empty
+	if err := fs.MkdirAll("/data/sub", 0777); err != nil {
+		t.Fatal(err)
+	}
+	assert.Names(t, fs, "/data/sub")
+	if _, err := fs.Stat("/data/sub/c.txt"); !fs.IsNotExist(err) {
+		t.Errorf("Expected the contents of the base layer to be gone, got %v", err)
+	}
+	// A file that is created again has new contents
+	if err := fs.WriteFile("/data/a.txt", []byte("new"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	expectContent(t, fs, "/data/a.txt", "new")
+
+	expectContent(t, base, "/data/sub/c.txt", "c\n")
+}
+
+func TestRename(t *testing.T) {
+	fs, base := newFixture(t)
+
+	if err := fs.Rename("/data", "/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/data"); !fs.IsNotExist(err) {
+		t.Errorf("Expected the old name to be gone, got %v", err)
+	}
+	assert.Names(t, fs, "/", "etc", "moved")
+	assert.Names(t, fs, "/moved", "a.txt", "b.txt", "sub")
+	expectContent(t, fs, "/moved/sub/c.txt", "c\n")
+
+	if err := fs.Rename("/moved/a.txt", "/moved/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	expectContent(t, fs, "/moved/b.txt", "a\n")
+	if err := fs.Rename("/moved/b.txt", "/moved/sub"); err == nil {
+		t.Error("Expected an error replacing a directory with a file")
+	}
+
+	// Renaming back restores the name, with the new contents
+	if err := fs.Rename("/moved", "/data"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Names(t, fs, "/data", "b.txt", "sub")
+	expectContent(t, base, "/data/a.txt", "a\n")
+}
+
+func TestSymlinkAcrossLayers(t *testing.T) {
+	fs, _ := newFixture(t)
+
+	if err := fs.Symlink("/data/sub", "/link"); err != nil {
+		t.Fatal(err)
+	}
+	expectContent(t, fs, "/link/c.txt", "c\n")
+	// Writing through the link copies the target up
+	if err := fs.WriteFile("/link/c.txt", []byte("changed"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	expectContent(t, fs, "/data/sub/c.txt", "changed")
+	if target, err := fs.Readlink("/link"); err != nil || target != "/data/sub" {
+		t.Errorf("Expected target /data/sub, got %q, %v", target, err)
+	}
+}
+
+func TestExclusiveDanglingLink(t *testing.T) {
+	fs, base := newFixture(t)
+	if err := base.Symlink("/data/missing.txt", "/dangling"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Like os, the link exists even if its target doesn't
+	_, err := fs.OpenFile("/dangling", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if !fs.IsExist(err) {
+		t.Errorf("Expected IsExist for a dangling link, got %v", err)
+	}
+	if _, err := fs.Lstat("/data/missing.txt"); !fs.IsNotExist(err) {
+		t.Errorf("Expected the target not to be created, got %v", err)
+	}
+	f, err := fs.OpenFile("/dangling", os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	expectContent(t, fs, "/data/missing.txt", "")
+}
+
+func TestOpenDir(t *testing.T) {
+	fs, _ := newFixture(t)
+	if err := fs.WriteFile("/data/z.txt", nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fs.Open("/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	infos, err := f.Readdir(2)
+	if err != nil || len(infos) != 2 || infos[0].Name() != "a.txt" {
+		t.Fatalf("Expected the first two entries, got %v, %v", infos, err)
+	}
+	if infos, err = f.Readdir(-1); err != nil || len(infos) != 2 || infos[1].Name() != "z.txt" {
+		t.Fatalf("Expected the last two entries, got %v, %v", infos, err)
+	}
+	if fi, err := f.Stat(); err != nil || !fi.IsDir() {
+		t.Errorf("Expected a directory, got %v, %v", fi, err)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	fs, base := newFixture(t)
+
+	// Copied up, but not changed
+	if err := fs.Chmod("/data/b.txt", 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/etc/app.conf", []byte("debug = true\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RemoveAll("/data/sub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("/data/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.MkdirAll("/data/new/dir", 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := fs.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Change{
+		{"/data/a.txt", Deleted},
+		{"/data/new", Created},
+		{"/data/new/dir", Created},
+		{"/data/sub", Deleted},
+		{"/etc/app.conf", Modified},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %v, got %v", expected, changes)
+	}
+
+	if err := fs.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectContent(t, base, "/etc/app.conf", "debug = true\n")
+	assert.Names(t, base, "/data", "b.txt", "new")
+	if changes, err := fs.Changes(); err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes after Commit, got %v, %v", changes, err)
+	}
+}
+
+func TestChangesOpaque(t *testing.T) {
+	fs, _ := newFixture(t)
+	if err := fs.RemoveAll("/data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.MkdirAll("/data/sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/data/b.txt", []byte("b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Chtimes("/data/b.txt", fixtureTime, fixtureTime); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := fs.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Change{
+		{"/data/a.txt", Deleted},
+		{"/data/sub/c.txt", Deleted},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %v, got %v", expected, changes)
+	}
+}
+
+func TestOsBase(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "fixture"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "fixture", "a.txt"), []byte("a"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	base, err := basepath.New(osfilesys.NewOsWrapper(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer base.Close()
+	fs := New(base, virtual.NewVirtualFilesys())
+
+	if err := fs.WriteFile("/fixture/a.txt", []byte("b"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/fixture", "/renamed"); err != nil {
+		t.Fatal(err)
+	}
+	expectContent(t, fs, "/renamed/a.txt", "b")
+	if data, err := os.ReadFile(filepath.Join(dir, "fixture", "a.txt")); err != nil || string(data) != "a" {
+		t.Errorf("Expected the fixture to be unchanged, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,270 @@
+// Package readonly wraps a filesys.FileSystem so it can be read but not
+// modified, except for the directories that are explicitly writable:
+//
+//	fs := readonly.New(osfilesys.NewOsWrapper(), "/tmp/reports")
+//	fs.ReadFile("/data/input.csv")                // works
+//	fs.WriteFile("/data/input.csv", nil, 0666)    // fails with a permission error
+//	fs.WriteFile("/tmp/reports/a.txt", nil, 0666) // works
+//
+// Links are resolved before a name is checked, so a link in a writable
+// directory doesn't allow writing to the directory it points to.
+package readonly
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/internal/links"
+)
+
+// ReadOnlyFileSystem passes the methods that read to the wrapped file
+// system, and fails the methods that modify it with an error that
+// satisfies IsPermission, unless the name is in a writable directory
+type ReadOnlyFileSystem struct {
+	fs       filesys.FileSystem
+	writable []string
+}
+
+// New returns a read-only view of fs. The writable directories, and
+// everything in them, can still be modified. Writable directories are
+// compared with the names passed to the methods, so relative names are
+// only writable if the directories are given relative as well.
+func New(fs filesys.FileSystem, writable ...string) *ReadOnlyFileSystem {
+	r := &ReadOnlyFileSystem{fs: fs}
+	for _, dir := range writable {
+		r.writable = append(r.writable, path.Clean(dir))
+	}
+	return r
+}
+
+// canWrite reports whether name is in a writable directory. The last
+// element of name is only resolved if follow is set, like the operation
+// that modifies it does.
+func (r *ReadOnlyFileSystem) canWrite(name string, follow bool) bool {
+	if len(r.writable) == 0 {
+		return false
+	}
+	real, ok := r.resolve(name, follow)
+	if !ok {
+		return false
+	}
+	for _, dir := range r.writable {
+		for _, d := range []string{dir, r.resolveDir(dir)} {
+			if real == d || strings.HasPrefix(real, d+"/") || d == "/" && path.IsAbs(real) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveDir returns dir with its links resolved, or dir if it
+// can't be resolved
+func (r *ReadOnlyFileSystem) resolveDir(dir string) string {
+	if real, ok := r.resolve(dir, true); ok {
+		return real
+	}
+	return dir
+}
+
+// resolve returns name with the links in it resolved, as far as they
+// exist, or false if they can't be resolved
+func (r *ReadOnlyFileSystem) resolve(name string, follow bool) (string, bool) {
+	real, err := links.Resolver{FS: r.fs}.Resolve("open", name, follow)
+	return real, err == nil
+}
+
+func (r *ReadOnlyFileSystem) Open(name string) (filesys.File, error) {
+	f, err := r.fs.Open(name)
+	return r.wrap(f, err, name, false)
+}
+
+// OpenFile only opens files for writing, or creates them, in writable
+// directories
+func (r *ReadOnlyFileSystem) OpenFile(name string, flag int, perm os.FileMode) (filesys.File, error) {
+	write := flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0
+	if write && !r.canWrite(name, true) {
+		return nil, &os.PathError{"open", name, os.ErrPermission}
+	}
+	f, err := r.fs.OpenFile(name, flag, perm)
+	return r.wrap(f, err, name, write)
+}
+
+func (r *ReadOnlyFileSystem) Create(name string) (filesys.File, error) {
+	if !r.canWrite(name, true) {
+		return nil, &os.PathError{"open", name, os.ErrPermission}
+	}
+	f, err := r.fs.Create(name)
+	return r.wrap(f, err, name, true)
+}
+
+func (r *ReadOnlyFileSystem) wrap(f filesys.File, err error, name string, writable bool) (filesys.File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyFile{file: f, name: name, writable: writable}, nil
+}
+
+func (r *ReadOnlyFileSystem) Mkdir(name string, perm os.FileMode) error {
+	if !r.canWrite(name, false) {
+		return &os.PathError{"mkdir", name, os.ErrPermission}
+	}
+	return r.fs.Mkdir(name, perm)
+}
+
+func (r *ReadOnlyFileSystem) MkdirAll(name string, perm os.FileMode) error {
+	if !r.canWrite(name, true) {
+		if fi, err := r.fs.Stat(name); err == nil && fi.IsDir() {
+			// Nothing to do, like for the os package
+			return nil
+		}
+		return &os.PathError{"mkdir", name, os.ErrPermission}
+	}
+	return r.fs.MkdirAll(name, perm)
+}
+
+func (r *ReadOnlyFileSystem) Remove(name string) error {
+	if !r.canWrite(name, false) {
+		return &os.PathError{"remove", name, os.ErrPermission}
+	}
+	return r.fs.Remove(name)
+}
+
+func (r *ReadOnlyFileSystem) RemoveAll(name string) error {
+	if !r.canWrite(name, false) {
+		return &os.PathError{"remove", name, os.ErrPermission}
+	}
+	return r.fs.RemoveAll(name)
+}
+
+func (r *ReadOnlyFileSystem) Rename(oldPath, newPath string) error {
+	if !r.canWrite(oldPath, false) || !r.canWrite(newPath, false) {
+		return &os.LinkError{"rename", oldPath, newPath, os.ErrPermission}
+	}
+	return r.fs.Rename(oldPath, newPath)
+}
+
+func (r *ReadOnlyFileSystem) Stat(name string) (os.FileInfo, error) {
+	return r.fs.Stat(name)
+}
+
+func (r *ReadOnlyFileSystem) Lstat(name string) (os.FileInfo, error) {
+	return r.fs.Lstat(name)
+}
+
+func (r *ReadOnlyFileSystem) Symlink(oldname, newname string) error {
+	if !r.canWrite(newname, false) {
+		return &os.LinkError{"symlink", oldname, newname, os.ErrPermission}
+	}
+	return r.fs.Symlink(oldname, newname)
+}
+
+func (r *ReadOnlyFileSystem) Readlink(name string) (string, error) {
+	return r.fs.Readlink(name)
+}
+
+func (r *ReadOnlyFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	if !r.canWrite(name, true) {
+		return &os.PathError{"chtimes", name, os.ErrPermission}
+	}
+	return r.fs.Chtimes(name, atime, mtime)
+}
+
+func (r *ReadOnlyFileSystem) Chmod(name string, mode os.FileMode) error {
+	if !r.canWrite(name, true) {
+		return &os.PathError{"chmod", name, os.ErrPermission}
+	}
+	return r.fs.Chmod(name, mode)
+}
+
+func (r *ReadOnlyFileSystem) Chown(name string, uid, gid int) error {
+	if !r.canWrite(name, true) {
+		return &os.PathError{"chown", name, os.ErrPermission}
+	}
+	return r.fs.Chown(name, uid, gid)
+}
+
+func (r *ReadOnlyFileSystem) Lchown(name string, uid, gid int) error {
+	if !r.canWrite(name, false) {
+		return &os.PathError{"lchown", name, os.ErrPermission}
+	}
+	return r.fs.Lchown(name, uid, gid)
+}
+
+func (r *ReadOnlyFileSystem) IsNotExist(err error) bool {
+	return r.fs.IsNotExist(err)
+}
+
+func (r *ReadOnlyFileSystem) IsExist(err error) bool {
+	return r.fs.IsExist(err)
+}
+
+// IsPermission also reports the errors of the read-only file system itself,
+// whatever the wrapped file system reports
+func (r *ReadOnlyFileSystem) IsPermission(err error) bool {
+	return errors.Is(err, os.ErrPermission) || r.fs.IsPermission(err)
+}
+
+func (r *ReadOnlyFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	return r.fs.ReadDir(name)
+}
+
+func (r *ReadOnlyFileSystem) ReadFile(name string) ([]byte, error) {
+	return r.fs.ReadFile(name)
+}
+
+func (r *ReadOnlyFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if !r.canWrite(name, true) {
+		return &os.PathError{"open", name, os.ErrPermission}
+	}
+	return r.fs.WriteFile(name, data, perm)
+}
+
+// Statfs fails with errors.ErrUnsupported if the wrapped file system
+// doesn't implement filesys.StatfsFileSystem
+func (r *ReadOnlyFileSystem) Statfs(name string) (filesys.DiskUsage, error) {
+	sfs, ok := r.fs.(filesys.StatfsFileSystem)
+	if !ok {
+		return filesys.DiskUsage{}, &os.PathError{"statfs", name, errors.ErrUnsupported}
+	}
+	return sfs.Statfs(name)
+}
+
+// readOnlyFile wraps a file opened through a ReadOnlyFileSystem, and only
+// writes if it was opened for writing in a writable directory
+type readOnlyFile struct {
+	file     filesys.File
+	name     string
+	writable bool
+}
+
+func (f *readOnlyFile) Read(b []byte) (int, error) {
+	return f.file.Read(b)
+}
+
+func (f *readOnlyFile) Write(b []byte) (int, error) {
+	if !f.writable {
+		return 0, &os.PathError{"write", f.name, os.ErrPermission}
+	}
+	return f.file.Write(b)
+}
+
+func (f *readOnlyFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+func (f *readOnlyFile) Close() error {
+	return f.file.Close()
+}
+
+func (f *readOnlyFile) Stat() (os.FileInfo, error) {
+	return f.file.Stat()
+}
+
+func (f *readOnlyFile) Readdir(n int) ([]os.FileInfo, error) {
+	return f.file.Readdir(n)
+}
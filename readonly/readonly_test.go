@@ -0,0 +1,166 @@
+package readonly
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/filesystest"
+	"github.com/poppels/filesys/virtual"
+)
+
+var (
+	_ filesys.FileSystem       = (*ReadOnlyFileSystem)(nil)
+	_ filesys.StatfsFileSystem = (*ReadOnlyFileSystem)(nil)
+	_ filesys.File             = (*readOnlyFile)(nil)
+)
+
+func TestConformance(t *testing.T) {
+	// With everything writable, the wrapper must behave like the backend
+	filesystest.Run(t, func(t *testing.T) (filesys.FileSystem, string) {
+		return New(virtual.NewVirtualFilesys(), "/"), "/"
+	})
+}
+
+func newFixture(t *testing.T) *virtual.VirtualFileSystem {
+	vfs := virtual.NewVirtualFilesys()
+	if err := vfs.MkdirAll("/data/dir", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := vfs.MkdirAll("/scratch", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := vfs.WriteFile("/data/a.txt", []byte("a"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return vfs
+}
+
+func TestReadOnly(t *testing.T) {
+	vfs := newFixture(t)
+	fs := New(vfs)
+
+	if data, err := fs.ReadFile("/data/a.txt"); err != nil || string(data) != "a" {
+		t.Fatalf("Expected to read a, got %q, %v", data, err)
+	}
+	if infos, err := fs.ReadDir("/data"); err != nil || len(infos) != 2 {
+		t.Fatalf("Expected two entries, got %v, %v", infos, err)
+	}
+
+	openWrite := func() error {
+		_, err := fs.OpenFile("/data/a.txt", os.O_WRONLY, 0)
+		return err
+	}
+	create := func() error {
+		_, err := fs.Create("/data/b.txt")
+		return err
+	}
+	tests := map[string]func() error{
+		"OpenFile":  openWrite,
+		"Create":    create,
+		"WriteFile": func() error { return fs.WriteFile("/data/a.txt", nil, 0666) },
+		"Mkdir":     func() error { return fs.Mkdir("/data/new", 0777) },
+		"MkdirAll":  func() error { return fs.MkdirAll("/data/new/sub", 0777) },
+		"Remove":    func() error { return fs.Remove("/data/a.txt") },
+		"RemoveAll": func() error { return fs.RemoveAll("/data") },
+		"Rename":    func() error { return fs.Rename("/data/a.txt", "/data/b.txt") },
+		"Symlink":   func() error { return fs.Symlink("a.txt", "/data/link") },
+		"Chtimes":   func() error { return fs.Chtimes("/data/a.txt", time.Now(), time.Now()) },
+		"Chmod":     func() error { return fs.Chmod("/data/a.txt", 0600) },
+		"Chown":     func() error { return fs.Chown("/data/a.txt", 1, 1) },
+		"Lchown":    func() error { return fs.Lchown("/data/a.txt", 1, 1) },
+	}
+	for name, fn := range tests {
+		if err := fn(); !fs.IsPermission(err) {
+			t.Errorf("Expected a permission error for %s, got %v", name, err)
+		}
+	}
+	if data, _ := vfs.ReadFile("/data/a.txt"); string(data) != "a" {
+		t.Errorf("Expected the file to be unchanged, got %q", data)
+	}
+
+	// Files that are opened for reading can't be written either
+	f, err := fs.Open("/data/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("b")); !fs.IsPermission(err) {
+		t.Errorf("Expected a permission error writing to the file, got %v", err)
+	}
+	// Directories that exist don't have to be created
+	if err := fs.MkdirAll("/data/dir", 0777); err != nil {
+		t.Errorf("Expected MkdirAll of an existing directory to work, got %v", err)
+	}
+}
+
+func TestWritable(t *testing.T) {
+	vfs := newFixture(t)
+	fs := New(vfs, "/scratch/")
+
+	if err := fs.MkdirAll("/scratch/a/b", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/scratch/a/b/c.txt", []byte("c"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.OpenFile("/scratch/a/b/c.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("d")); err != nil {
+		t.Errorf("Expected to write to the file, got %v", err)
+	}
+	f.Close()
+	if err := fs.Rename("/scratch/a/b/c.txt", "/scratch/c.txt"); err != nil {
+		t.Error(err)
+	}
+	if data, err := vfs.ReadFile("/scratch/c.txt"); err != nil || string(data) != "cd" {
+		t.Errorf("Expected cd, got %q, %v", data, err)
+	}
+
+	// Files can't be moved in or out, and similar names aren't writable
+	if err := fs.Rename("/scratch/c.txt", "/data/c.txt"); !fs.IsPermission(err) {
+		t.Errorf("Expected a permission error moving out, got %v", err)
+	}
+	if err := fs.WriteFile("/scratch2", nil, 0666); !fs.IsPermission(err) {
+		t.Errorf("Expected a permission error for /scratch2, got %v", err)
+	}
+	if err := fs.WriteFile("/scratch/../data/a.txt", nil, 0666); !fs.IsPermission(err) {
+		t.Errorf("Expected a permission error for .., got %v", err)
+	}
+}
+
+func TestWritableLinks(t *testing.T) {
+	vfs := newFixture(t)
+	if err := vfs.Symlink("/data", "/scratch/data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vfs.Symlink("/data/a.txt", "/scratch/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vfs.Symlink("/scratch", "/tmp"); err != nil {
+		t.Fatal(err)
+	}
+	fs := New(vfs, "/scratch")
+
+	// Links in a writable directory don't make their targets writable
+	if err := fs.WriteFile("/scratch/data/b.txt", nil, 0666); !fs.IsPermission(err) {
+		t.Errorf("Expected a permission error through a link to a directory, got %v", err)
+	}
+	if err := fs.WriteFile("/scratch/a.txt", nil, 0666); !fs.IsPermission(err) {
+		t.Errorf("Expected a permission error through a link to a file, got %v", err)
+	}
+	if err := fs.Chmod("/scratch/a.txt", 0600); !fs.IsPermission(err) {
+		t.Errorf("Expected a permission error for Chmod through a link, got %v", err)
+	}
+	// But the links themselves are in it
+	if err := fs.Remove("/scratch/a.txt"); err != nil {
+		t.Errorf("Expected to remove the link, got %v", err)
+	}
+	// And links to the writable directory lead to it
+	if err := fs.WriteFile("/tmp/b.txt", nil, 0666); err != nil {
+		t.Errorf("Expected to write through a link to the writable directory, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package filesys
+
+import (
+	"errors"
+	"os"
+)
+
+// DiskUsage is the size and usage of the file system that contains a path,
+// like the result of statfs(2)
+type DiskUsage struct {
+	Total     uint64 // Size in bytes
+	Free      uint64 // Free bytes
+	Available uint64 // Free bytes that unprivileged users can use
+	Files     uint64 // Maximum number of files, directories and links
+	FreeFiles uint64 // Number of files, directories and links that can still be created
+}
+
+// Used returns the number of bytes in use
+func (u DiskUsage) Used() uint64 {
+	return u.Total - u.Free
+}
+
+// StatfsFileSystem is implemented by file systems that can report their
+// size and usage. It's not part of FileSystem, so existing implementations
+// don't break.
+type StatfsFileSystem interface {
+	FileSystem
+	Statfs(path string) (DiskUsage, error)
+}
+
+// Statfs returns the usage of the file system containing path. It fails
+// with errors.ErrUnsupported if the global FileSystem can't report it.
+func Statfs(path string) (DiskUsage, error) {
+	fs := getSingleton()
+	sfs, ok := fs.(StatfsFileSystem)
+	if !ok {
+		return DiskUsage{}, &os.PathError{"statfs", path, errors.ErrUnsupported}
+	}
+	return sfs.Statfs(path)
+}
@@ -0,0 +1,34 @@
+package filesys
+
+import (
+	"os"
+	"time"
+)
+
+// FileTimes are the timestamps of a file. Times that the backend
+// or platform doesn't provide are zero.
+type FileTimes struct {
+	ModTime    time.Time // Last change of the contents
+	AccessTime time.Time // Last access
+	ChangeTime time.Time // Last change of the contents or metadata
+	BirthTime  time.Time // Creation
+}
+
+// Times extracts the timestamps from fi, whichever backend it came from.
+// A FileInfo can provide them with AccessTime, ChangeTime and BirthTime
+// methods, like the virtual backend does. Otherwise they are taken from
+// the result of Sys, like the *syscall.Stat_t of the os package.
+func Times(fi os.FileInfo) FileTimes {
+	t := FileTimes{ModTime: fi.ModTime()}
+	sysTimes(fi.Sys(), &t)
+	if a, ok := fi.(interface{ AccessTime() time.Time }); ok {
+		t.AccessTime = a.AccessTime()
+	}
+	if c, ok := fi.(interface{ ChangeTime() time.Time }); ok {
+		t.ChangeTime = c.ChangeTime()
+	}
+	if b, ok := fi.(interface{ BirthTime() time.Time }); ok {
+		t.BirthTime = b.BirthTime()
+	}
+	return t
+}
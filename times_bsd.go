@@ -0,0 +1,17 @@
+//go:build darwin || freebsd || netbsd
+
+package filesys
+
+import (
+	"syscall"
+	"time"
+)
+
+// sysTimes reads the times from a stat structure
+func sysTimes(sys interface{}, t *FileTimes) {
+	if st, ok := sys.(*syscall.Stat_t); ok {
+		t.AccessTime = time.Unix(st.Atimespec.Unix())
+		t.ChangeTime = time.Unix(st.Ctimespec.Unix())
+		t.BirthTime = time.Unix(st.Birthtimespec.Unix())
+	}
+}
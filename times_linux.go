@@ -0,0 +1,15 @@
+package filesys
+
+import (
+	"syscall"
+	"time"
+)
+
+// sysTimes reads the times from a stat structure. Linux
+// doesn't report the birth time through stat.
+func sysTimes(sys interface{}, t *FileTimes) {
+	if st, ok := sys.(*syscall.Stat_t); ok {
+		t.AccessTime = time.Unix(st.Atim.Unix())
+		t.ChangeTime = time.Unix(st.Ctim.Unix())
+	}
+}
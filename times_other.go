@@ -0,0 +1,7 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !windows
+
+package filesys
+
+// sysTimes doesn't know the structure of Sys on this platform
+func sysTimes(sys interface{}, t *FileTimes) {
+}
@@ -0,0 +1,42 @@
+package filesys
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTimes(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(name, []byte("Hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	atime := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	mtime := time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(name, atime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ft := Times(fi)
+	if !ft.ModTime.Equal(mtime) {
+		t.Fatalf("Expected mtime %v, got %v", mtime, ft.ModTime)
+	}
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd", "netbsd":
+		// The change time is when Chtimes was called
+		if ft.ChangeTime.Before(mtime) {
+			t.Fatalf("Expected a recent ctime, got %v", ft.ChangeTime)
+		}
+		fallthrough
+	case "windows":
+		if !ft.AccessTime.Equal(atime) {
+			t.Fatalf("Expected atime %v, got %v", atime, ft.AccessTime)
+		}
+	}
+}
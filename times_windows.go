@@ -0,0 +1,15 @@
+package filesys
+
+import (
+	"syscall"
+	"time"
+)
+
+// sysTimes reads the times from the file attributes. Windows
+// doesn't have a change time.
+func sysTimes(sys interface{}, t *FileTimes) {
+	if attr, ok := sys.(*syscall.Win32FileAttributeData); ok {
+		t.AccessTime = time.Unix(0, attr.LastAccessTime.Nanoseconds())
+		t.BirthTime = time.Unix(0, attr.CreationTime.Nanoseconds())
+	}
+}
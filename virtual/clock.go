@@ -0,0 +1,63 @@
+package virtual
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of the timestamps that a virtual file system sets.
+// Tests that check modification times can use a FixedClock or a FakeClock
+// instead of the system clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the real time, as returned by time.Now
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// FixedClock returns a clock that is always at time t
+func FixedClock(t time.Time) Clock {
+	return fixedClock{t}
+}
+
+type fixedClock struct {
+	t time.Time
+}
+
+func (c fixedClock) Now() time.Time { return c.t }
+
+// FakeClock is a clock that only moves when it's told to. It's safe for
+// concurrent use.
+type FakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewFakeClock returns a clock that starts at time t
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{t: t}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Advance moves the clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// Set moves the clock to time t, which may also be in the past
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = t
+}
@@ -0,0 +1,65 @@
+package virtual
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	fs := NewVirtualFilesysWithClock(clock)
+
+	if err := fs.MkdirAll("/a/b", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/a/b/c.txt", []byte("Hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/", "/a", "/a/b", "/a/b/c.txt"} {
+		expectModTime(t, fs, name, start)
+	}
+
+	// Writing through a handle updates the time when it's closed
+	clock.Advance(48 * time.Hour)
+	f, err := fs.OpenFile("/a/b/c.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(" world"))
+	expectModTime(t, fs, "/a/b/c.txt", start)
+	f.Close()
+	expectModTime(t, fs, "/a/b/c.txt", start.Add(48*time.Hour))
+
+	clock.Set(start)
+	if err := fs.Symlink("c.txt", "/a/b/d"); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := fs.Lstat("/a/b/d")
+	if err != nil {
+		t.Fatal(err)
+	} else if !fi.ModTime().Equal(start) {
+		t.Fatalf("Expected link time %v, got %v", start, fi.ModTime())
+	}
+}
+
+func TestFixedClock(t *testing.T) {
+	fixed := time.Date(2000, 6, 1, 0, 0, 0, 0, time.UTC)
+	fs := NewVirtualFilesysWithClock(FixedClock(fixed))
+	if err := fs.WriteFile("/a.txt", nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	expectModTime(t, fs, "/a.txt", fixed)
+}
+
+func expectModTime(t *testing.T, fs *VirtualFileSystem, name string, expected time.Time) {
+	t.Helper()
+	fi, err := fs.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(expected) {
+		t.Fatalf("Expected modification time %v for %s, got %v", expected, name, fi.ModTime())
+	}
+}
@@ -0,0 +1,173 @@
+package virtual
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+// These tests are meant to be run with the race detector enabled:
+// go test -race ./virtual
+
+func TestConcurrentTreeOperations(t *testing.T) {
+	fs := NewVirtualFilesys()
+	if err := fs.MkdirAll("/work", 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 16
+	const iterations = 200
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			view, err := fs.ChangeDir("/work")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for i := 0; i < iterations; i++ {
+				dir := fmt.Sprintf("d%d", i%5)
+				name := fmt.Sprintf("%s/f%d-%d", dir, w, i%7)
+				view.MkdirAll(dir, 0777)
+				view.WriteFile(name, []byte(name), 0666)
+				view.Stat(name)
+				view.ReadDir(dir)
+				view.ReadFile(name)
+				view.Rename(name, name+".old")
+				view.Remove(name + ".old")
+				view.CurrentDir()
+				if i%50 == 0 {
+					view.RemoveAll(dir)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// The tree must still be consistent
+	infos, err := fs.ReadDir("/work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range infos {
+		if !info.IsDir() {
+			t.Fatalf("Unexpected file %s in /work", info.Name())
+		}
+		if _, err := fs.ReadDir("/work/" + info.Name()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConcurrentWritesToSharedFile(t *testing.T) {
+	fs := NewVirtualFilesys()
+	if err := fs.WriteFile("/log.txt", []byte{}, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 8
+	const lines = 100
+	line := []byte("0123456789\n")
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := fs.OpenFile("/log.txt", os.O_WRONLY|os.O_APPEND, 0666)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer f.Close()
+			for i := 0; i < lines; i++ {
+				if _, err := f.Write(line); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	// Read the file while it is being written
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < lines; i++ {
+			f, err := fs.Open("/log.txt")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ioutil.ReadAll(f)
+			f.Stat()
+			f.Close()
+		}
+	}()
+	wg.Wait()
+
+	// Appends are atomic, so no line may have been torn or overwritten
+	data, err := fs.ReadFile("/log.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != workers*lines*len(line) {
+		t.Fatalf("Expected %d bytes, got %d", workers*lines*len(line), len(data))
+	}
+	for i := 0; i < len(data); i += len(line) {
+		if string(data[i:i+len(line)]) != string(line) {
+			t.Fatalf("Torn write at offset %d", i)
+		}
+	}
+}
+
+func TestConcurrentUseOfSingleHandle(t *testing.T) {
+	fs := NewVirtualFilesys()
+	content := make([]byte, 4096)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	if err := fs.WriteFile("/data.bin", content, 0666); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Open("/data.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Every byte must be read exactly once, by one of the readers
+	const workers = 8
+	var mu sync.Mutex
+	total := 0
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 7)
+			for {
+				n, err := f.Read(buf)
+				mu.Lock()
+				total += n
+				mu.Unlock()
+				if err == io.EOF {
+					return
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if total != len(content) {
+		t.Fatalf("Expected %d bytes to be read in total, got %d", len(content), total)
+	}
+}
@@ -0,0 +1,30 @@
+package virtual
+
+import (
+	"testing"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/filesystest"
+)
+
+func TestConformance(t *testing.T) {
+	t.Run("Root", func(t *testing.T) {
+		filesystest.Run(t, func(t *testing.T) (filesys.FileSystem, string) {
+			return NewVirtualFilesys(), "/"
+		})
+	})
+
+	t.Run("Relative", func(t *testing.T) {
+		filesystest.Run(t, func(t *testing.T) (filesys.FileSystem, string) {
+			fs := NewVirtualFilesys()
+			if err := fs.MkdirAll("/home/user", 0755); err != nil {
+				t.Fatal(err)
+			}
+			fs, err := fs.ChangeDir("/home")
+			if err != nil {
+				t.Fatal(err)
+			}
+			return fs, "user"
+		})
+	})
+}
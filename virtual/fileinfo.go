@@ -10,6 +10,10 @@ type VirtualFileInfo struct {
 	size    int64
 	mode    os.FileMode
 	modTime time.Time
+	atime   time.Time
+	ctime   time.Time
+	btime   time.Time
+	sys     interface{}
 }
 
 func (fi VirtualFileInfo) Name() string       { return fi.name }
@@ -17,7 +21,13 @@ func (fi VirtualFileInfo) Size() int64        { return fi.size }
 func (fi VirtualFileInfo) Mode() os.FileMode  { return fi.mode }
 func (fi VirtualFileInfo) ModTime() time.Time { return fi.modTime }
 func (fi VirtualFileInfo) IsDir() bool        { return fi.mode.IsDir() }
-func (fi VirtualFileInfo) Sys() interface{}   { return nil }
+func (fi VirtualFileInfo) Sys() interface{}   { return fi.sys }
+
+// AccessTime, ChangeTime and BirthTime are the times of the last access,
+// of the last change to the contents or metadata, and of the creation
+func (fi VirtualFileInfo) AccessTime() time.Time { return fi.atime }
+func (fi VirtualFileInfo) ChangeTime() time.Time { return fi.ctime }
+func (fi VirtualFileInfo) BirthTime() time.Time  { return fi.btime }
 
 // For sorting file infos by names
 type byName []os.FileInfo
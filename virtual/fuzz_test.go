@@ -0,0 +1,264 @@
+//go:build linux || darwin
+
+package virtual
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/osfilesys"
+)
+
+// FuzzDifferential replays random sequences of operations on both a fresh
+// virtual file system and the real one in a temporary directory, and fails
+// if the results or the final trees differ. Run it with
+//
+//	go test -fuzz=FuzzDifferential ./virtual
+//
+// The fuzzer minimizes failing inputs, and the failure message lists the
+// operations of the minimized input as a reproducer.
+func FuzzDifferential(f *testing.F) {
+	f.Add([]byte{0, 1, 0, 3, 2, 1, 0, 0, 0, 1, 0, 0})
+	f.Add([]byte{2, 5, 0, 0, 1, 5, 0, 2, 5, 5, 0, 0, 3, 0, 0, 0})
+	f.Add([]byte{1, 0, 0, 0, 1, 0, 0, 0, 4, 0, 2, 0, 9, 2, 0, 0})
+	f.Add([]byte{1, 0, 0, 0, 0, 4, 0, 1, 11, 4, 7, 0, 6, 7, 0, 0, 7, 7, 0, 0})
+	f.Add([]byte{1, 0, 0, 0, 0, 4, 0, 1, 12, 4, 0, 3, 6, 4, 0, 0, 13, 0, 0, 3})
+
+	umask := os.FileMode(syscall.Umask(0))
+	syscall.Umask(int(umask))
+
+	f.Fuzz(func(t *testing.T, program []byte) {
+		ops := decodeProgram(program)
+		dir := t.TempDir()
+		defer makeRemovable(dir)
+
+		osfs := osfilesys.NewOsWrapper()
+		virt := NewVirtualFilesys().AsUser(os.Getuid(), os.Getgid())
+		virt.SetUmask(umask)
+
+		for i, op := range ops {
+			expected := op.run(osfs, dir)
+			actual := op.run(virt, "/")
+			if expected != actual {
+				t.Fatalf("Operation %d gave different results\nos:      %s\nvirtual: %s\n%s",
+					i, expected, actual, reproducer(ops[:i+1]))
+			}
+		}
+
+		expected := dumpTree(osfs, dir)
+		actual := dumpTree(virt, "/")
+		if expected != actual {
+			t.Fatalf("Final trees differ\nos:\n%s\nvirtual:\n%s\n%s", expected, actual, reproducer(ops))
+		}
+	})
+}
+
+// The operations only use a small set of paths, so they often collide
+var fuzzPaths = []string{"a", "b", "a/b", "a/c", "b/a", "a/b/c", "c.txt", "a/c.txt", "a/b/c.txt", "x/y"}
+
+var fuzzModes = []os.FileMode{0755, 0644, 0700, 0500, 0300, 0000, 0777, 0600}
+
+var fuzzFlags = []int{
+	os.O_RDONLY,
+	os.O_WRONLY | os.O_CREATE,
+	os.O_RDWR | os.O_CREATE | os.O_TRUNC,
+	os.O_WRONLY | os.O_CREATE | os.O_EXCL,
+	os.O_WRONLY | os.O_APPEND,
+	os.O_RDWR,
+	os.O_RDONLY | os.O_CREATE,
+	os.O_WRONLY | os.O_TRUNC,
+}
+
+var fuzzOpNames = []string{
+	"WriteFile", "MkdirAll", "Mkdir", "Remove", "RemoveAll", "Rename", "Stat", "Lstat",
+	"ReadFile", "ReadDir", "OpenFile", "Symlink", "Chmod", "Readlink",
+}
+
+type fuzzOp struct {
+	name string
+	p, q string
+	data string
+	mode os.FileMode
+	flag int
+}
+
+// decodeProgram turns every four bytes into an operation
+func decodeProgram(program []byte) []fuzzOp {
+	var ops []fuzzOp
+	for i := 0; i+4 <= len(program) && len(ops) < 64; i += 4 {
+		b := program[i : i+4]
+		ops = append(ops, fuzzOp{
+			name: fuzzOpNames[int(b[0])%len(fuzzOpNames)],
+			p:    fuzzPaths[int(b[1])%len(fuzzPaths)],
+			q:    fuzzPaths[int(b[2])%len(fuzzPaths)],
+			data: strings.Repeat("x", int(b[3])%8),
+			mode: fuzzModes[int(b[3])%len(fuzzModes)],
+			flag: fuzzFlags[int(b[3])%len(fuzzFlags)],
+		})
+	}
+	return ops
+}
+
+func (op fuzzOp) String() string {
+	switch op.name {
+	case "WriteFile":
+		return fmt.Sprintf("WriteFile(%q, %q, 0666)", op.p, op.data)
+	case "MkdirAll", "Mkdir":
+		return fmt.Sprintf("%s(%q, 0777)", op.name, op.p)
+	case "Rename":
+		return fmt.Sprintf("Rename(%q, %q)", op.p, op.q)
+	case "Symlink":
+		return fmt.Sprintf("Symlink(%q, %q)", op.q, op.p)
+	case "Chmod":
+		return fmt.Sprintf("Chmod(%q, %#o)", op.p, op.mode)
+	case "OpenFile":
+		return fmt.Sprintf("OpenFile(%q, %#x, 0666) + Write(%q)", op.p, op.flag, op.data)
+	}
+	return fmt.Sprintf("%s(%q)", op.name, op.p)
+}
+
+func reproducer(ops []fuzzOp) string {
+	lines := []string{"Reproducer:"}
+	for _, op := range ops {
+		lines = append(lines, "\t"+op.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// run performs the operation with paths relative to dir, and describes
+// the outcome in a way that can be compared between backends
+func (op fuzzOp) run(fs filesys.FileSystem, dir string) string {
+	p := path.Join(dir, op.p)
+	q := path.Join(dir, op.q)
+	switch op.name {
+	case "WriteFile":
+		return errClass(fs.WriteFile(p, []byte(op.data), 0666))
+	case "MkdirAll":
+		return errClass(fs.MkdirAll(p, 0777))
+	case "Mkdir":
+		return errClass(fs.Mkdir(p, 0777))
+	case "Remove":
+		return errClass(fs.Remove(p))
+	case "RemoveAll":
+		return errClass(fs.RemoveAll(p))
+	case "Rename":
+		return errClass(fs.Rename(p, q))
+	case "Stat":
+		fi, err := fs.Stat(p)
+		return errClass(err) + describe(fi)
+	case "Lstat":
+		fi, err := fs.Lstat(p)
+		return errClass(err) + describe(fi)
+	case "ReadFile":
+		data, err := fs.ReadFile(p)
+		return errClass(err) + " " + string(data)
+	case "ReadDir":
+		infos, err := fs.ReadDir(p)
+		result := errClass(err)
+		for _, fi := range infos {
+			result += " " + fi.Name()
+		}
+		return result
+	case "OpenFile":
+		f, err := fs.OpenFile(p, op.flag, 0666)
+		if err != nil {
+			return errClass(err)
+		}
+		defer f.Close()
+		_, err = f.Write([]byte(op.data))
+		return "ok, write " + errClass(err)
+	case "Symlink":
+		// The target is relative to the directory of the link
+		return errClass(fs.Symlink(op.q, p))
+	case "Chmod":
+		return errClass(fs.Chmod(p, op.mode))
+	case "Readlink":
+		target, err := fs.Readlink(p)
+		return errClass(err) + " " + target
+	}
+	panic("unknown operation " + op.name)
+}
+
+func errClass(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case os.IsNotExist(err):
+		return "not exist"
+	case os.IsExist(err):
+		return "exist"
+	case os.IsPermission(err):
+		return "permission"
+	}
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	} else if le, ok := err.(*os.LinkError); ok {
+		err = le.Err
+	}
+	if errno, ok := err.(syscall.Errno); ok && (errno == syscall.ENOTDIR || errno == syscall.EISDIR || errno == syscall.ELOOP) {
+		return errno.Error()
+	}
+	return "error"
+}
+
+func describe(fi os.FileInfo) string {
+	if fi == nil {
+		return ""
+	}
+	s := fmt.Sprintf(" %s %s", fi.Name(), fi.Mode())
+	if fi.Mode().IsRegular() {
+		s += fmt.Sprintf(" %d", fi.Size())
+	}
+	return s
+}
+
+// dumpTree lists everything below dir, one line per entry
+func dumpTree(fs filesys.FileSystem, dir string) string {
+	var lines []string
+	var walk func(rel string)
+	walk = func(rel string) {
+		infos, err := fs.ReadDir(path.Join(dir, rel))
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("%s: readdir %s", rel, errClass(err)))
+			return
+		}
+		for _, fi := range infos {
+			name := path.Join(rel, fi.Name())
+			full := path.Join(dir, name)
+			line := name + describe(fi)
+			switch {
+			case fi.Mode()&os.ModeSymlink != 0:
+				target, err := fs.Readlink(full)
+				line += " -> " + target + " " + errClass(err)
+			case fi.Mode().IsRegular():
+				data, err := fs.ReadFile(full)
+				line += " " + errClass(err) + " " + string(data)
+			}
+			lines = append(lines, line)
+			if fi.IsDir() {
+				walk(name)
+			}
+		}
+	}
+	walk("")
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// makeRemovable restores permissions taken away by Chmod,
+// so the temporary directory can be cleaned up
+func makeRemovable(dir string) {
+	filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err == nil && fi.IsDir() {
+			os.Chmod(name, 0755)
+		}
+		return nil
+	})
+}
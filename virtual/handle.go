@@ -3,31 +3,45 @@ package virtual
 import (
 	"io"
 	"os"
-	"time"
+	"sync"
 )
 
+// VirtualFileHandle is an open file or directory. A handle may be used from
+// multiple goroutines; its operations are serialized, so concurrent reads and
+// writes never observe a partially updated position.
 type VirtualFileHandle struct {
+	mu       sync.Mutex
+	tree     *tree
 	res      *resource
+	name     string
+	linkName string
 	position int
 	canRead  bool
 	canWrite bool
+	append   bool
 	modified bool
 	closed   bool
 }
 
 func (fh *VirtualFileHandle) Read(b []byte) (int, error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
 	if fh.closed {
-		return 0, &os.PathError{"read", fh.res.name, errClosed}
+		return 0, &os.PathError{"read", fh.name, errClosed}
 	}
 	if fh.res.isDir {
-		return 0, &os.PathError{"read", fh.res.name, errIsDirectory}
+		return 0, &os.PathError{"read", fh.name, errIsDirectory}
 	}
 	if !fh.canRead {
-		return 0, &os.PathError{"read", fh.res.name, errNotReadable}
+		return 0, &os.PathError{"read", fh.name, errNotReadable}
 	}
 	if len(b) == 0 {
 		return 0, nil
 	}
+
+	fh.tree.mu.RLock()
+	defer fh.tree.mu.RUnlock()
+	fh.tree.accessed(fh.res)
 	if fh.position >= len(fh.res.data) {
 		return 0, io.EOF
 	}
@@ -38,24 +52,48 @@ func (fh *VirtualFileHandle) Read(b []byte) (int, error) {
 }
 
 func (fh *VirtualFileHandle) Write(b []byte) (int, error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
 	if fh.closed {
-		return 0, &os.PathError{"write", fh.res.name, errClosed}
-	}
-	if fh.res.isDir {
-		return 0, &os.PathError{"write", fh.res.name, errIsDirectory}
+		return 0, &os.PathError{"write", fh.name, errClosed}
 	}
 	if !fh.canWrite {
-		return 0, &os.PathError{"write", fh.res.name, errNotWritable}
+		return 0, &os.PathError{"write", fh.name, errNotWritable}
+	}
+	if fh.res.isDir {
+		return 0, &os.PathError{"write", fh.name, errIsDirectory}
 	}
 	if len(b) == 0 {
 		return 0, nil
 	}
 
+	fh.tree.mu.Lock()
+	defer fh.tree.mu.Unlock()
+	if fh.append {
+		fh.position = len(fh.res.data)
+	}
+
+	// Like a real disk, write what fits and then fail
+	var limitErr error
+	if growth := int64(fh.position + len(b) - len(fh.res.data)); growth > 0 {
+		room, err := fh.tree.room(fh.res)
+		if growth > room {
+			limitErr = &os.PathError{"write", fh.name, err}
+			if cut := growth - room; cut < int64(len(b)) {
+				b = b[:int64(len(b))-cut]
+			} else {
+				return 0, limitErr
+			}
+		}
+	}
+
+	fh.res.unshare()
+
 	// If position is after EOF, the gap should be filled with null bytes
 	lenFile := len(fh.res.data)
 	if fh.position > lenFile {
 		filler := make([]byte, fh.position-lenFile)
-		fh.res.data = append(fh.res.data, filler...)
+		fh.res.setData(append(fh.res.data, filler...))
 		lenFile = fh.position
 	}
 
@@ -63,20 +101,22 @@ func (fh *VirtualFileHandle) Write(b []byte) (int, error) {
 	if end < lenFile {
 		copy(fh.res.data[fh.position:end], b)
 	} else {
-		fh.res.data = append(fh.res.data[:fh.position], b...)
+		fh.res.setData(append(fh.res.data[:fh.position], b...))
 	}
 
 	fh.position = end
 	fh.modified = true
-	return len(b), nil
+	return len(b), limitErr
 }
 
 func (fh *VirtualFileHandle) Seek(offset int64, whence int) (int64, error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
 	if fh.closed {
-		return 0, &os.PathError{"seek", fh.res.name, errClosed}
+		return 0, &os.PathError{"seek", fh.name, errClosed}
 	}
 	if fh.res.isDir {
-		return 0, &os.PathError{"seek", fh.res.name, errIsDirectory}
+		return 0, &os.PathError{"seek", fh.name, errIsDirectory}
 	}
 	if whence < 0 || whence > 2 {
 		return 0, os.ErrInvalid
@@ -88,14 +128,16 @@ func (fh *VirtualFileHandle) Seek(offset int64, whence int) (int64, error) {
 	} else if whence == io.SeekCurrent {
 		pos = int64(fh.position) + offset
 	} else if whence == io.SeekEnd {
+		fh.tree.mu.RLock()
 		pos = int64(len(fh.res.data)) + offset
+		fh.tree.mu.RUnlock()
 	}
 
 	if pos < 0 {
-		return 0, &os.PathError{"seek", fh.res.name, errNegativeSeek}
+		return 0, &os.PathError{"seek", fh.name, errNegativeSeek}
 	}
 	if int64(int(pos)) != pos {
-		return 0, &os.PathError{"seek", fh.res.name, errSeekOverflow}
+		return 0, &os.PathError{"seek", fh.name, errSeekOverflow}
 	}
 
 	fh.position = int(pos)
@@ -103,25 +145,39 @@ func (fh *VirtualFileHandle) Seek(offset int64, whence int) (int64, error) {
 }
 
 func (fh *VirtualFileHandle) Stat() (os.FileInfo, error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
 	if fh.closed {
-		return nil, &os.PathError{"stat", fh.res.name, errClosed}
+		return nil, &os.PathError{"stat", fh.name, errClosed}
 	}
-	return fh.res.stat(), nil
+	fh.tree.mu.RLock()
+	defer fh.tree.mu.RUnlock()
+	return fh.res.statAs(fh.linkName), nil
 }
 
 func (fh *VirtualFileHandle) Readdir(n int) ([]os.FileInfo, error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
 	if fh.closed {
-		return nil, &os.PathError{"read", fh.res.name, errClosed}
+		return nil, &os.PathError{"read", fh.name, errClosed}
 	}
 	if !fh.res.isDir {
-		return nil, &os.PathError{"read", fh.res.name, errNotDirectory}
+		return nil, &os.PathError{"read", fh.name, errNotDirectory}
 	}
 
+	fh.tree.mu.RLock()
 	infos := fh.res.readdir()
+	fh.tree.accessed(fh.res)
+	fh.tree.mu.RUnlock()
+
+	// Entries may have been removed since the last call
+	if fh.position > len(infos) {
+		fh.position = len(infos)
+	}
 	var err error
 	if n <= 0 {
 		infos = infos[fh.position:]
-		fh.position = len(infos)
+		fh.position += len(infos)
 	} else {
 		end := fh.position + n
 		if end > len(infos) {
@@ -136,9 +192,14 @@ func (fh *VirtualFileHandle) Readdir(n int) ([]os.FileInfo, error) {
 }
 
 func (fh *VirtualFileHandle) Close() error {
-	if !fh.res.isDir && fh.modified {
-		fh.res.modTime = time.Now()
-	}
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	fh.tree.mu.Lock()
+	defer fh.tree.mu.Unlock()
+	if !fh.res.isDir && fh.modified && !fh.closed {
+		fh.tree.modified(fh.res)
+	}
+	delete(fh.tree.handles, fh)
 	fh.closed = true
 	return nil
 }
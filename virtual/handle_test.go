@@ -3,6 +3,7 @@ package virtual
 import (
 	"io"
 	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/poppels/filesys/fsutil"
@@ -225,3 +226,93 @@ func TestFolderReaddir(t *testing.T) {
 		t.Fatal("Error expected for Readdir on file")
 	}
 }
+
+func TestOpenFile(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fsutil.PutFile(fs, "/a/b/c.txt", []byte("Hello"))
+
+	// Write only
+	f, err := fs.OpenFile("/a/b/c.txt", os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Read(make([]byte, 5)); err == nil {
+		t.Fatal("Should not be able to read from write only file")
+	}
+	if _, err := f.Write([]byte("J")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := fsutil.VerifyFileContent(fs, "/a/b/c.txt", []byte("Jello")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read only
+	f, err = fs.OpenFile("/a/b/c.txt", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("Y")); err == nil {
+		t.Fatal("Should not be able to write to read only file")
+	}
+	f.Close()
+
+	// Append always writes at the end, even after seeking
+	f, err = fs.OpenFile("/a/b/c.txt", os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte(" world")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("!")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := fsutil.VerifyFileContent(fs, "/a/b/c.txt", []byte("Jello world!")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create without truncating an existing file
+	f, err = fs.OpenFile("/a/b/c.txt", os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := fsutil.VerifyFileContent(fs, "/a/b/c.txt", []byte("Jello world!")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Exclusive create
+	if _, err := fs.OpenFile("/a/b/c.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666); !fs.IsExist(err) {
+		t.Fatalf("Expected os.ErrExist, got %v", err)
+	}
+	f, err = fs.OpenFile("/a/b/d.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// Missing file without O_CREATE
+	if _, err := fs.OpenFile("/a/b/e.txt", os.O_WRONLY, 0666); !fs.IsNotExist(err) {
+		t.Fatalf("Expected os.ErrNotExist, got %v", err)
+	}
+
+	// Truncate
+	f, err = fs.OpenFile("/a/b/c.txt", os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := fsutil.VerifyFileContent(fs, "/a/b/c.txt", []byte{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Directories can't be opened for writing
+	if _, err := fs.OpenFile("/a/b", os.O_RDWR, 0); err == nil {
+		t.Fatal("Should not be able to open directory for writing")
+	}
+}
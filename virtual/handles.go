@@ -0,0 +1,92 @@
+package virtual
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/poppels/filesys"
+)
+
+// errTooManyOpenFiles is returned when the limit of open files is reached
+var errTooManyOpenFiles = syscall.EMFILE
+
+// maxStackDepth is the number of frames recorded for each open handle
+const maxStackDepth = 32
+
+// openHandle is the entry of a handle in the registry of open handles
+type openHandle struct {
+	seq   uint64
+	path  string
+	stack []uintptr
+}
+
+// SetOpenFileLimit limits the number of files and directories that can be
+// open at the same time, in all views of the file system. Opening more
+// fails with EMFILE. Zero or less means unlimited, which is the default.
+func (fs *VirtualFileSystem) SetOpenFileLimit(n int) {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	fs.tree.openFileLimit = n
+}
+
+// OpenHandles returns the files that are open, in the order they were
+// opened, with the stack of the code that opened them
+func (fs *VirtualFileSystem) OpenHandles() []filesys.OpenHandle {
+	fs.tree.mu.RLock()
+	entries := make([]*openHandle, 0, len(fs.tree.handles))
+	for _, entry := range fs.tree.handles {
+		entries = append(entries, entry)
+	}
+	fs.tree.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	handles := make([]filesys.OpenHandle, len(entries))
+	for i, entry := range entries {
+		handles[i] = filesys.OpenHandle{Path: entry.path, Stack: formatStack(entry.stack)}
+	}
+	return handles
+}
+
+// checkOpenFiles returns an error if no more files can be opened
+func (t *tree) checkOpenFiles() error {
+	if t.openFileLimit > 0 && len(t.handles) >= t.openFileLimit {
+		return errTooManyOpenFiles
+	}
+	return nil
+}
+
+// register adds a new handle to the registry. It must be called by
+// openFile, so the stack starts at the caller of Open, OpenFile or Create.
+func (fs *VirtualFileSystem) register(fh *VirtualFileHandle) {
+	stack := make([]uintptr, maxStackDepth)
+	// Skip runtime.Callers, register, openFile and the exported method
+	stack = stack[:runtime.Callers(4, stack)]
+
+	name := fh.name
+	if !path.IsAbs(name) {
+		name = path.Join(fs.tree.pathOf(fs.currentDir), name)
+	}
+	if fs.tree.handles == nil {
+		fs.tree.handles = map[*VirtualFileHandle]*openHandle{}
+	}
+	fs.tree.handleSeq++
+	fs.tree.handles[fh] = &openHandle{seq: fs.tree.handleSeq, path: path.Clean(name), stack: stack}
+}
+
+// formatStack formats a stack like the traces of panics
+func formatStack(stack []uintptr) string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(stack)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
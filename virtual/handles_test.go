@@ -0,0 +1,74 @@
+package virtual
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestOpenHandles(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fs.MkdirAll("/a/b", 0777)
+	fs.WriteFile("/a/b/c.txt", []byte("Hello"), 0666)
+
+	f1, err := fs.Open("/a/b/c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, _ := fs.ChangeDir("/a")
+	f2, err := view.Create("b/d.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handles := fs.OpenHandles()
+	if len(handles) != 2 {
+		t.Fatalf("Expected 2 open handles, got %d", len(handles))
+	}
+	if handles[0].Path != "/a/b/c.txt" || handles[1].Path != "/a/b/d.txt" {
+		t.Fatalf("Unexpected paths %s and %s", handles[0].Path, handles[1].Path)
+	}
+	// The stack starts at the caller
+	first := strings.SplitN(handles[0].Stack, "\n", 2)[0]
+	if !strings.HasSuffix(first, ".TestOpenHandles") {
+		t.Fatalf("Expected stack to start at the test, got %s", handles[0].Stack)
+	}
+
+	f1.Close()
+	f2.Close()
+	f2.Close()
+	if handles := fs.OpenHandles(); len(handles) != 0 {
+		t.Fatalf("Expected no open handles, got %d", len(handles))
+	}
+}
+
+func TestOpenFileLimit(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fs.SetOpenFileLimit(2)
+	f1, err := fs.Create("/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f1.Close()
+	f2, err := fs.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fs.OpenFile("/b.txt", os.O_WRONLY|os.O_CREATE, 0666)
+	if !errors.Is(err, syscall.EMFILE) {
+		t.Fatalf("Expected EMFILE, got %v", err)
+	}
+	if _, err := fs.Stat("/b.txt"); !fs.IsNotExist(err) {
+		t.Fatal("File created even though it couldn't be opened")
+	}
+
+	f2.Close()
+	f3, err := fs.OpenFile("/b.txt", os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f3.Close()
+}
@@ -0,0 +1,88 @@
+package virtual
+
+import (
+	"os"
+)
+
+// The user and group that own the files of a new file system, and that
+// it is used as, unless another user is chosen with AsUser
+const (
+	DefaultUid = 1000
+	DefaultGid = 1000
+)
+
+// user holds the credentials a file system is used with
+type user struct {
+	uid    int
+	gid    int
+	groups []int
+}
+
+func (u user) inGroup(gid int) bool {
+	if u.gid == gid {
+		return true
+	}
+	for _, g := range u.groups {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// AsUser returns a view of the file system that performs every operation as
+// the given user, with gid as its primary group and optionally supplementary
+// groups. Permission checks use the owner, group or other bits depending on
+// the ownership of each file, and new files are owned by the user. Uid 0 is
+// the root user, which bypasses the permission checks. The view shares the
+// files and the current directory with fs.
+func (fs *VirtualFileSystem) AsUser(uid, gid int, groups ...int) *VirtualFileSystem {
+	return &VirtualFileSystem{
+		tree:       fs.tree,
+		currentDir: fs.currentDir,
+		user:       user{uid: uid, gid: gid, groups: append([]int(nil), groups...)}}
+}
+
+func (fs *VirtualFileSystem) isOwner(r *resource) bool {
+	return fs.user.uid == 0 || fs.user.uid == r.uid
+}
+
+// own sets the ownership of a new resource. New resources belong to the
+// user, and to the group of the user, unless the parent has the setgid bit
+// set, in which case they inherit its group as well as the bit for folders.
+func (fs *VirtualFileSystem) own(r *resource) *resource {
+	r.uid = fs.user.uid
+	r.gid = fs.user.gid
+	if r.parent != nil && r.parent.mode&os.ModeSetgid != 0 {
+		r.gid = r.parent.gid
+		if r.isDir {
+			r.mode |= os.ModeSetgid
+		}
+	}
+	return r
+}
+
+// chown changes the owner and group of r, leaving them unchanged if -1.
+// Only root can give files away, while owners may change the group
+// to one of their own groups.
+func (fs *VirtualFileSystem) chown(r *resource, uid, gid int) error {
+	if uid == -1 {
+		uid = r.uid
+	}
+	if gid == -1 {
+		gid = r.gid
+	}
+	if fs.user.uid != 0 {
+		if r.uid != fs.user.uid || uid != r.uid || (gid != r.gid && !fs.user.inGroup(gid)) {
+			return os.ErrPermission
+		}
+		// Changing ownership of a file clears its setuid and setgid bits
+		if !r.isDir {
+			r.mode &^= os.ModeSetuid | os.ModeSetgid
+		}
+	}
+	r.uid = uid
+	r.gid = gid
+	fs.tree.changed(r)
+	return nil
+}
@@ -0,0 +1,111 @@
+package virtual
+
+import (
+	"os"
+	"testing"
+
+	"github.com/poppels/filesys/fsutil"
+)
+
+func TestOwnerGroupOtherPermissions(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fsutil.PutFile(fs, "/a/c.txt", []byte("Hello"))
+	fs.Chmod("/a/c.txt", 0640)
+
+	owner := fs
+	member := fs.AsUser(2000, 3000, DefaultGid)
+	other := fs.AsUser(2000, 3000)
+	root := fs.AsUser(0, 0)
+
+	if err := owner.WriteFile("/a/c.txt", []byte("Bye"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := member.ReadFile("/a/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := member.WriteFile("/a/c.txt", []byte("Bye"), 0666); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if _, err := other.ReadFile("/a/c.txt"); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if err := root.WriteFile("/a/c.txt", []byte("Root"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the owner can change the mode
+	if err := other.Chmod("/a/c.txt", 0666); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+
+	// New files belong to the user creating them
+	fs.Chmod("/a", 0777)
+	if err := other.WriteFile("/a/d.txt", []byte{}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	expectOwner(t, fs, "/a/d.txt", 2000, 3000)
+}
+
+func TestChown(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fsutil.PutFile(fs, "/a/c.txt", []byte("Hello"))
+	fs.Symlink("c.txt", "/a/link")
+	user := fs.AsUser(DefaultUid, DefaultGid, 4000)
+	root := fs.AsUser(0, 0)
+
+	// Owners can change the group to one of their own
+	if err := user.Chown("/a/c.txt", -1, 4000); err != nil {
+		t.Fatal(err)
+	}
+	expectOwner(t, fs, "/a/c.txt", DefaultUid, 4000)
+	if err := user.Chown("/a/c.txt", -1, 5000); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+
+	// Only root can give files away
+	if err := user.Chown("/a/c.txt", 2000, -1); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if err := root.Chown("/a/link", 2000, 5000); err != nil {
+		t.Fatal(err)
+	}
+	expectOwner(t, fs, "/a/c.txt", 2000, 5000)
+	expectOwner(t, fs, "/a/link", DefaultUid, DefaultGid)
+
+	if err := root.Lchown("/a/link", 2000, 5000); err != nil {
+		t.Fatal(err)
+	}
+	expectOwner(t, fs, "/a/link", 2000, 5000)
+}
+
+func TestStickyDirectory(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fs.MkdirAll("/tmp", 0777)
+	fs.Chmod("/tmp", os.ModeSticky|0777)
+	alice := fs.AsUser(2000, 2000)
+	bob := fs.AsUser(3000, 3000)
+
+	if err := alice.WriteFile("/tmp/alice.txt", []byte{}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Remove("/tmp/alice.txt"); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if err := bob.Rename("/tmp/alice.txt", "/tmp/bob.txt"); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if err := alice.Remove("/tmp/alice.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectOwner(t *testing.T, fs *VirtualFileSystem, name string, uid, gid int) {
+	t.Helper()
+	r, err := fs.getResourceNoFollow(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.uid != uid || r.gid != gid {
+		t.Fatalf("Expected %s to be owned by %d:%d, got %d:%d", name, uid, gid, r.uid, r.gid)
+	}
+}
@@ -0,0 +1,69 @@
+package virtual
+
+import (
+	"os"
+)
+
+// Permission bits, as they appear in each of the user, group and other triplets
+const (
+	permRead  os.FileMode = 4
+	permWrite os.FileMode = 2
+	permExec  os.FileMode = 1
+)
+
+// chmodBits are the mode bits that can be changed with Chmod
+const chmodBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+const defaultUmask os.FileMode = 022
+
+// SetUmask sets the mask that is cleared from the permissions of new files
+// and directories, and returns the previous mask. The mask is shared with all
+// views of the file system created with ChangeDir. The default umask is 022.
+func (fs *VirtualFileSystem) SetUmask(mask os.FileMode) os.FileMode {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	old := fs.tree.umask
+	fs.tree.umask = mask & os.ModePerm
+	return old
+}
+
+// canAccess reports whether the permission bits of r grant all of the
+// wanted permissions to the user of the file system. The bits that apply
+// are those of the owner, the group or others, in that order. The root user
+// is granted everything, except executing files without any execute bit set.
+func (fs *VirtualFileSystem) canAccess(r *resource, want os.FileMode) bool {
+	if fs.user.uid == 0 {
+		return want&permExec == 0 || r.isDir || r.mode&0111 != 0
+	}
+	bits := r.mode
+	if fs.user.uid == r.uid {
+		bits >>= 6
+	} else if fs.user.inGroup(r.gid) {
+		bits >>= 3
+	}
+	return bits&want == want
+}
+
+// canUnlink checks the sticky bit of dir, which restricts removing
+// and renaming its entries to their owners and the owner of dir
+func (fs *VirtualFileSystem) canUnlink(dir, r *resource) bool {
+	return dir.mode&os.ModeSticky == 0 || fs.isOwner(dir) || fs.isOwner(r)
+}
+
+// canRemoveContents reports whether everything below the directory r
+// can be removed, which requires listing and modifying every non-empty
+// directory in the subtree
+func (fs *VirtualFileSystem) canRemoveContents(r *resource) bool {
+	if !r.isDir || len(r.children) == 0 {
+		return true
+	}
+	if !fs.canAccess(r, permRead|permWrite|permExec) {
+		return false
+	}
+	for _, child := range r.children {
+		if !fs.canUnlink(r, child) || !fs.canRemoveContents(child) {
+			return false
+		}
+	}
+	return true
+}
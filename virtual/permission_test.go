@@ -0,0 +1,164 @@
+package virtual
+
+import (
+	"os"
+	"testing"
+
+	"github.com/poppels/filesys/fsutil"
+)
+
+func TestUmask(t *testing.T) {
+	fs := NewVirtualFilesys()
+	if err := fs.MkdirAll("/a/b", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/a/b/c.txt", []byte("Hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	expectMode(t, fs, "/a", os.ModeDir|0755)
+	expectMode(t, fs, "/a/b", os.ModeDir|0755)
+	expectMode(t, fs, "/a/b/c.txt", 0644)
+
+	if old := fs.SetUmask(077); old != 022 {
+		t.Fatalf("Expected previous umask 022, got %o", old)
+	}
+	f, err := fs.OpenFile("/a/b/d.txt", os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	expectMode(t, fs, "/a/b/d.txt", 0600)
+}
+
+func TestChmod(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fsutil.PutFile(fs, "/a/c.txt", []byte("Hello"))
+	if err := fs.Chmod("/a/c.txt", 0400); err != nil {
+		t.Fatal(err)
+	}
+	expectMode(t, fs, "/a/c.txt", 0400)
+
+	// Chmod follows symbolic links
+	fs.Symlink("c.txt", "/a/link")
+	if err := fs.Chmod("/a/link", 0640); err != nil {
+		t.Fatal(err)
+	}
+	expectMode(t, fs, "/a/c.txt", 0640)
+
+	if err := fs.Chmod("/a/missing", 0640); !fs.IsNotExist(err) {
+		t.Fatalf("Expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestFilePermissions(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fsutil.PutFile(fs, "/a/c.txt", []byte("Hello"))
+
+	// Read only file
+	fs.Chmod("/a/c.txt", 0444)
+	if _, err := fs.ReadFile("/a/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/a/c.txt", []byte("Bye"), 0666); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if _, err := fs.OpenFile("/a/c.txt", os.O_RDWR, 0); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if _, err := fs.OpenFile("/a/c.txt", os.O_WRONLY|os.O_TRUNC, 0); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if err := fsutil.VerifyFileContent(fs, "/a/c.txt", []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write only file
+	fs.Chmod("/a/c.txt", 0200)
+	if _, err := fs.ReadFile("/a/c.txt"); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if _, err := fs.Open("/a/c.txt"); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if err := fs.WriteFile("/a/c.txt", []byte("Bye"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// Handles keep the access they were opened with
+	fs.Chmod("/a/c.txt", 0600)
+	f, err := fs.OpenFile("/a/c.txt", os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fs.Chmod("/a/c.txt", 0400)
+	if _, err := f.Write([]byte("Hi")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDirectoryPermissions(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fsutil.PutFile(fs, "/a/b/c.txt", []byte("Hello"))
+
+	// Without write permission nothing can be created or removed
+	fs.Chmod("/a/b", 0555)
+	if err := fs.WriteFile("/a/b/d.txt", []byte{}, 0666); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if err := fs.Mkdir("/a/b/d", 0777); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if err := fs.Remove("/a/b/c.txt"); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if err := fs.Rename("/a/b/c.txt", "/a/c.txt"); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if err := fs.RemoveAll("/a"); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if _, err := fs.Stat("/a/b/c.txt"); err != nil {
+		t.Fatal("RemoveAll should not remove anything when it fails")
+	}
+	// Existing files can still be modified
+	if err := fs.WriteFile("/a/b/c.txt", []byte("Bye"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without read permission the directory can't be listed,
+	// but its contents are still accessible by name
+	fs.Chmod("/a/b", 0333)
+	if _, err := fs.ReadDir("/a/b"); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if _, err := fs.Open("/a/b"); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if _, err := fs.Stat("/a/b/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without execute permission the directory can't be traversed
+	fs.Chmod("/a/b", 0666)
+	if _, err := fs.Stat("/a/b/c.txt"); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if _, err := fs.ChangeDir("/a/b"); !fs.IsPermission(err) {
+		t.Fatalf("Expected permission error, got %v", err)
+	}
+	if _, err := fs.Stat("/a/b"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectMode(t *testing.T, fs *VirtualFileSystem, name string, mode os.FileMode) {
+	t.Helper()
+	fi, err := fs.Lstat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode() != mode {
+		t.Fatalf("Expected mode %s for %s, got %s", mode, name, fi.Mode())
+	}
+}
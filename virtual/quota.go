@@ -0,0 +1,186 @@
+package virtual
+
+import (
+	"math"
+	"os"
+	"syscall"
+
+	"github.com/poppels/filesys"
+)
+
+// Errors for running out of space, like on a real disk
+var (
+	errNoSpace = syscall.ENOSPC
+	errQuota   = syscall.EDQUOT
+)
+
+// SetCapacity limits the total size of all files in the file system to the
+// given number of bytes. Writes that don't fit write as much as they can
+// and then fail with ENOSPC. Zero or less means unlimited, which is the
+// default. Files that are already larger are kept.
+func (fs *VirtualFileSystem) SetCapacity(bytes int64) {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	fs.tree.capacity = bytes
+}
+
+// SetInodeLimit limits the number of files, directories and symbolic links,
+// including the root directory. Creating more fails with ENOSPC. Zero or
+// less means unlimited, which is the default.
+func (fs *VirtualFileSystem) SetInodeLimit(n int64) {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	fs.tree.inodeLimit = n
+}
+
+// SetQuota limits the total size of the files below the directory name.
+// Writes that don't fit write as much as they can and then fail with
+// EDQUOT, as does moving files into the directory when they don't fit.
+// Zero or less removes the quota.
+func (fs *VirtualFileSystem) SetQuota(name string, bytes int64) error {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	dir, err := fs.getFolder(name)
+	if err != nil {
+		return &os.PathError{"quota", name, err}
+	}
+	if bytes < 0 {
+		bytes = 0
+	}
+	dir.quota = bytes
+	return nil
+}
+
+// Statfs reports the capacity and usage of the file system. If name is
+// below a directory with a quota, the quota is reported as the size, like
+// df does for project quotas. Without limits, the size and number of
+// files are reported as the largest int64.
+func (fs *VirtualFileSystem) Statfs(name string) (filesys.DiskUsage, error) {
+	fs.tree.mu.RLock()
+	defer fs.tree.mu.RUnlock()
+	r, err := fs.getResource(name)
+	if err != nil {
+		return filesys.DiskUsage{}, &os.PathError{"statfs", name, err}
+	}
+
+	total, used := int64(math.MaxInt64), fs.tree.root.size()
+	if fs.tree.capacity > 0 {
+		total = fs.tree.capacity
+	}
+	if !r.isDir {
+		r = r.parent
+	}
+	for dir := r; dir != nil; dir = dir.parent {
+		if dir.quota > 0 && dir.quota < total {
+			total, used = dir.quota, dir.size()
+		}
+	}
+	free := total - used
+	if free < 0 {
+		free = 0
+	}
+
+	files, inodes := int64(math.MaxInt64), fs.tree.root.inodes()
+	if fs.tree.inodeLimit > 0 {
+		files = fs.tree.inodeLimit
+	}
+	freeFiles := files - inodes
+	if freeFiles < 0 {
+		freeFiles = 0
+	}
+	return filesys.DiskUsage{
+		Total:     uint64(total),
+		Free:      uint64(free),
+		Available: uint64(free),
+		Files:     uint64(files),
+		FreeFiles: uint64(freeFiles)}, nil
+}
+
+// room returns how many bytes the file r may still grow, and the error for
+// growing any further
+func (t *tree) room(r *resource) (int64, error) {
+	room, err := int64(math.MaxInt64), error(nil)
+	if t.capacity > 0 {
+		room, err = t.capacity-t.root.size(), errNoSpace
+	}
+	for dir := r.parent; dir != nil; dir = dir.parent {
+		if dir.quota > 0 && dir.quota-dir.size() < room {
+			room, err = dir.quota-dir.size(), errQuota
+		}
+	}
+	if room < 0 {
+		room = 0
+	}
+	return room, err
+}
+
+// checkInodes returns an error if no more resources can be created
+func (t *tree) checkInodes() error {
+	if t.inodeLimit > 0 && t.root.inodes() >= t.inodeLimit {
+		return errNoSpace
+	}
+	return nil
+}
+
+// checkMove returns an error if moving r into the directory parent would
+// exceed the quota of one of the new ancestors. Quotas that r is already
+// counted in don't change.
+func checkMove(r, parent *resource) error {
+	for dir := parent; dir != nil; dir = dir.parent {
+		if dir.quota > 0 && !dir.contains(r) && dir.size()+r.size() > dir.quota {
+			return errQuota
+		}
+	}
+	return nil
+}
+
+// size returns the total size of the files in the tree of r
+func (r *resource) size() int64 {
+	return r.treeSize
+}
+
+// inodes returns the number of resources in the tree of r
+func (r *resource) inodes() int64 {
+	return r.treeInodes
+}
+
+// grow adds to the usage of r and its ancestors. Removed resources keep
+// their parent, but aren't counted in it any more.
+func (r *resource) grow(bytes, inodes int64) {
+	for ; r != nil; r = r.parent {
+		r.treeSize += bytes
+		r.treeInodes += inodes
+		if r.parent != nil && r.parent.children[r.name] != r {
+			break
+		}
+	}
+}
+
+// setData replaces the contents of the file r, and updates the usage
+func (r *resource) setData(data []byte) {
+	r.grow(int64(len(data)-len(r.data)), 0)
+	r.data = data
+}
+
+// attach adds r to the directory dir, and its usage to the ancestors
+func (dir *resource) attach(r *resource) {
+	r.parent = dir
+	dir.children[r.name] = r
+	dir.grow(r.treeSize, r.treeInodes)
+}
+
+// detach removes r from its directory, and its usage from the ancestors
+func (r *resource) detach() {
+	delete(r.parent.children, r.name)
+	r.parent.grow(-r.treeSize, -r.treeInodes)
+}
+
+// contains reports whether other is in the tree of r
+func (r *resource) contains(other *resource) bool {
+	for ; other != nil; other = other.parent {
+		if other == r {
+			return true
+		}
+	}
+	return false
+}
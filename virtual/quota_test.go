@@ -0,0 +1,182 @@
+package virtual
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/poppels/filesys"
+	"github.com/poppels/filesys/fsutil"
+)
+
+var _ filesys.StatfsFileSystem = (*VirtualFileSystem)(nil)
+
+func TestCapacity(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fs.SetCapacity(10)
+	if err := fs.WriteFile("/a.txt", []byte("Hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fs.OpenFile("/b.txt", os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n, err := f.Write([]byte("Goodbye"))
+	if n != 5 || !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("Expected to write 5 bytes and get ENOSPC, got %d, %v", n, err)
+	}
+	if n, err := f.Write([]byte("!")); n != 0 || !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("Expected ENOSPC for a full disk, got %d, %v", n, err)
+	}
+	if err := fsutil.VerifyFileContent(fs, "/b.txt", []byte("Goodb")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Overwriting doesn't need more space, and removing files frees it
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("Hi")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/c.txt", []byte("0123456789"), 0666); !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("Expected ENOSPC, got %v", err)
+	}
+	if err := fsutil.VerifyFileContent(fs, "/c.txt", []byte("01234")); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := fs.Statfs("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Total != 10 || usage.Free != 0 || usage.Used() != 10 {
+		t.Fatalf("Unexpected usage %+v", usage)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fs.MkdirAll("/home/a", 0777)
+	fs.MkdirAll("/home/b", 0777)
+	if err := fs.SetQuota("/home/a", 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.WriteFile("/home/a/x.txt", []byte("Hello"), 0666); !errors.Is(err, syscall.EDQUOT) {
+		t.Fatalf("Expected EDQUOT, got %v", err)
+	}
+	if err := fs.WriteFile("/home/b/x.txt", []byte("Hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/home/b/x.txt", "/home/a/y.txt"); !errors.Is(err, syscall.EDQUOT) {
+		t.Fatalf("Expected EDQUOT when moving into the directory, got %v", err)
+	}
+
+	usage, err := fs.Statfs("/home/a/x.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Total != 4 || usage.Free != 0 {
+		t.Fatalf("Expected the quota as usage, got %+v", usage)
+	}
+
+	if err := fs.SetQuota("/home/a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/home/b/x.txt", "/home/a/y.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInodeLimit(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fs.SetInodeLimit(3)
+	if err := fs.Mkdir("/a", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/a/b.txt", nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Symlink("a", "/c"); !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("Expected ENOSPC, got %v", err)
+	}
+	if err := fs.MkdirAll("/d/e", 0777); !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("Expected ENOSPC, got %v", err)
+	}
+	usage, err := fs.Statfs("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Files != 3 || usage.FreeFiles != 0 {
+		t.Fatalf("Unexpected usage %+v", usage)
+	}
+}
+
+// expectUsage checks the usage kept on the resources against a count of
+// the whole tree
+func expectUsage(t *testing.T, r *resource) (int64, int64) {
+	t.Helper()
+	size, inodes := int64(len(r.data)), int64(1)
+	for _, child := range r.children {
+		s, n := expectUsage(t, child)
+		size, inodes = size+s, inodes+n
+	}
+	if r.size() != size || r.inodes() != inodes {
+		t.Errorf("Expected %s to use %d bytes in %d inodes, got %d in %d",
+			r.name, size, inodes, r.size(), r.inodes())
+	}
+	return size, inodes
+}
+
+func TestUsage(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fs.SetCapacity(1 << 20)
+	fsutil.PutFile(fs, "/a/b/c.txt", []byte("Hello"))
+	fsutil.PutFile(fs, "/a/d.txt", []byte("world"))
+	fs.Symlink("/a/d.txt", "/a/link")
+	expectUsage(t, fs.tree.root)
+
+	f, err := fs.OpenFile("/a/b/c.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write([]byte(", hello"))
+	expectUsage(t, fs.tree.root)
+
+	// Overwriting a file frees its space
+	if err := fs.Rename("/a/d.txt", "/a/b/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	expectUsage(t, fs.tree.root)
+	if err := fs.Rename("/a/b", "/e"); err != nil {
+		t.Fatal(err)
+	}
+	expectUsage(t, fs.tree.root)
+
+	// Writing to a removed file doesn't count
+	f, err = fs.OpenFile("/e/c.txt", os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := fs.RemoveAll("/e"); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("Goodbye world"))
+	expectUsage(t, fs.tree.root)
+	if fs.tree.root.size() != 0 || fs.tree.root.inodes() != 3 {
+		t.Errorf("Expected 0 bytes in 3 inodes, got %d in %d", fs.tree.root.size(), fs.tree.root.inodes())
+	}
+
+	fs.WriteFile("/a/f.txt", []byte("Hello"), 0666)
+	fs.Restore(fs.Snapshot())
+	expectUsage(t, fs.tree.root)
+}
@@ -3,58 +3,130 @@ package virtual
 import (
 	"os"
 	"sort"
+	"sync/atomic"
 	"time"
 )
 
 type resource struct {
-	data     []byte
-	children map[string]*resource
-	isDir    bool
-	name     string
-	modTime  time.Time
-	parent   *resource
+	data       []byte
+	children   map[string]*resource
+	isDir      bool
+	isSymlink  bool
+	target     string
+	name       string
+	mode       os.FileMode
+	uid        int
+	gid        int
+	modTime    time.Time
+	changeTime time.Time
+	birthTime  time.Time
+	parent     *resource
+	quota      int64
+	// treeSize and treeInodes are the total size and number of the
+	// resources in the tree of r, kept up to date for the limits
+	treeSize   int64
+	treeInodes int64
+	// shared is set when data is shared with a copy of the tree,
+	// and must be copied before it's modified
+	shared bool
+	// atime is the access time in nanoseconds since the epoch. Reading
+	// a file updates it while holding only the read lock of the tree.
+	atime atomic.Int64
 }
 
-func makeFolder(name string, parent *resource) *resource {
-	return &resource{
-		data:     nil,
-		children: map[string]*resource{},
-		isDir:    true,
-		name:     name,
-		modTime:  time.Now(),
-		parent:   parent}
+func makeFolder(name string, parent *resource, perm os.FileMode, now time.Time) *resource {
+	return withTimes(&resource{
+		data:       nil,
+		children:   map[string]*resource{},
+		isDir:      true,
+		name:       name,
+		mode:       perm,
+		parent:     parent,
+		treeInodes: 1}, now)
 }
 
-func makeFile(name string, parent *resource, data []byte) *resource {
-	return &resource{
-		data:     data,
-		children: nil,
-		isDir:    false,
-		modTime:  time.Now(),
-		name:     name,
-		parent:   parent}
+func makeFile(name string, parent *resource, data []byte, perm os.FileMode, now time.Time) *resource {
+	return withTimes(&resource{
+		data:       data,
+		children:   nil,
+		isDir:      false,
+		mode:       perm,
+		name:       name,
+		parent:     parent,
+		treeSize:   int64(len(data)),
+		treeInodes: 1}, now)
+}
+
+func makeSymlink(name string, parent *resource, target string, now time.Time) *resource {
+	return withTimes(&resource{
+		isSymlink:  true,
+		target:     target,
+		mode:       0777,
+		name:       name,
+		parent:     parent,
+		treeInodes: 1}, now)
+}
+
+// unshare copies the data of r if it's shared with another tree
+func (r *resource) unshare() {
+	if r.shared {
+		r.data = append([]byte(nil), r.data...)
+		r.shared = false
+	}
+}
+
+// withTimes sets all timestamps of a new resource to now
+func withTimes(r *resource, now time.Time) *resource {
+	r.modTime = now
+	r.changeTime = now
+	r.birthTime = now
+	r.atime.Store(now.UnixNano())
+	return r
+}
+
+func (r *resource) accessTime() time.Time {
+	return time.Unix(0, r.atime.Load())
 }
 
 func (r *resource) stat() os.FileInfo {
 	var size int64
-	mode := os.ModeDir | 0777
-	if !r.isDir {
+	mode := os.ModeDir | r.mode
+	if r.isSymlink {
+		size = int64(len(r.target))
+		mode = os.ModeSymlink | r.mode
+	} else if !r.isDir {
 		size = int64(len(r.data))
-		mode = 0666
+		mode = r.mode
 	}
 	return VirtualFileInfo{
 		size:    size,
 		modTime: r.modTime,
+		atime:   r.accessTime(),
+		ctime:   r.changeTime,
+		btime:   r.birthTime,
 		name:    r.name,
-		mode:    mode}
+		mode:    mode,
+		sys:     r.sys(mode, size)}
 }
 
-func (r *resource) open(flag int) *VirtualFileHandle {
+// statAs is like stat, but reports the given name if it's not empty
+func (r *resource) statAs(name string) os.FileInfo {
+	fi := r.stat().(VirtualFileInfo)
+	if name != "" {
+		fi.name = name
+	}
+	return fi
+}
+
+func (r *resource) open(t *tree, name string, flag int) *VirtualFileHandle {
 	return &VirtualFileHandle{
+		tree:     t,
 		res:      r,
+		name:     name,
 		position: 0,
-		canRead:  flag&os.O_RDONLY == os.O_RDONLY || flag&os.O_RDWR == os.O_RDWR,
-		canWrite: flag&os.O_WRONLY == os.O_WRONLY || flag&os.O_RDWR == os.O_RDWR,
+		canRead:  isReadable(flag),
+		canWrite: isWritable(flag),
+		append:   flag&os.O_APPEND != 0,
 		modified: false,
 		closed:   false}
 }
@@ -67,3 +139,17 @@ func (r *resource) readdir() []os.FileInfo {
 	sort.Sort(byName(infos))
 	return infos
 }
+
+// The access mode is stored in the lowest bits of the flag.
+// O_RDONLY is zero, so it can't be tested with a bitwise and.
+const accessModeMask = os.O_RDONLY | os.O_WRONLY | os.O_RDWR
+
+func isReadable(flag int) bool {
+	mode := flag & accessModeMask
+	return mode == os.O_RDONLY || mode == os.O_RDWR
+}
+
+func isWritable(flag int) bool {
+	mode := flag & accessModeMask
+	return mode == os.O_WRONLY || mode == os.O_RDWR
+}
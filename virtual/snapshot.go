@@ -0,0 +1,105 @@
+package virtual
+
+// Snapshot is an immutable copy of the contents and settings of a virtual
+// file system. It can be restored any number of times, also concurrently,
+// for example to give each parallel subtest its own copy of a fixture.
+type Snapshot struct {
+	tree *tree
+}
+
+// Snapshot copies the current contents and settings of the file system:
+// umask, limits, clock and access time policy. Only the directory structure
+// is copied; file contents are shared with the snapshot until either side
+// writes to them. Open files are not part of the snapshot.
+func (fs *VirtualFileSystem) Snapshot() *Snapshot {
+	// Marking the contents as shared modifies the tree
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	return &Snapshot{fs.tree.copy()}
+}
+
+// Restore replaces the contents and settings of the file system with those
+// of the snapshot. Files that are open keep referring to the replaced files.
+// The current directory is looked up again by its path, and is the root if
+// it doesn't exist in the snapshot. Other views created with ChangeDir or
+// AsUser see the restored contents when they use absolute paths, but should
+// be created again to use relative paths.
+func (fs *VirtualFileSystem) Restore(s *Snapshot) {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	cd := fs.tree.pathOf(fs.currentDir)
+	restored := s.tree.copy()
+	fs.tree.root = restored.root
+	fs.tree.copyConfig(restored)
+
+	fs.currentDir = fs.tree.root
+	if dir, err := fs.getFolder(cd); err == nil {
+		fs.currentDir = dir
+	}
+}
+
+// Clone returns an independent copy of the file system, with the same
+// current directory and user. It's the same as restoring a snapshot
+// into a new file system.
+func (fs *VirtualFileSystem) Clone() *VirtualFileSystem {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	clone := &VirtualFileSystem{tree: fs.tree.copy(), user: fs.user}
+	clone.user.groups = append([]int(nil), fs.user.groups...)
+	clone.currentDir = clone.tree.root
+	if dir, err := clone.getFolder(fs.tree.pathOf(fs.currentDir)); err == nil {
+		clone.currentDir = dir
+	}
+	return clone
+}
+
+// copy returns a tree with a copy of the resources and settings of t
+func (t *tree) copy() *tree {
+	c := &tree{root: copyResource(t.root, nil)}
+	c.copyConfig(t)
+	return c
+}
+
+func (t *tree) copyConfig(from *tree) {
+	t.umask = from.umask
+	t.capacity = from.capacity
+	t.inodeLimit = from.inodeLimit
+	t.clock = from.clock
+	t.atimePolicy = from.atimePolicy
+	t.openFileLimit = from.openFileLimit
+}
+
+// copyResource copies r and everything below it. The contents of files
+// are shared, and copied by the first write on either side.
+func copyResource(r, parent *resource) *resource {
+	// Resources of snapshots are already marked, and are only read,
+	// so snapshots can be restored concurrently
+	if r.data != nil && !r.shared {
+		r.shared = true
+	}
+	c := &resource{
+		data:       r.data,
+		shared:     r.data != nil,
+		isDir:      r.isDir,
+		isSymlink:  r.isSymlink,
+		target:     r.target,
+		name:       r.name,
+		mode:       r.mode,
+		uid:        r.uid,
+		gid:        r.gid,
+		modTime:    r.modTime,
+		changeTime: r.changeTime,
+		birthTime:  r.birthTime,
+		parent:     parent,
+		quota:      r.quota,
+		treeSize:   r.treeSize,
+		treeInodes: r.treeInodes}
+	c.atime.Store(r.atime.Load())
+	if r.children != nil {
+		c.children = make(map[string]*resource, len(r.children))
+		for name, child := range r.children {
+			c.children[name] = copyResource(child, c)
+		}
+	}
+	return c
+}
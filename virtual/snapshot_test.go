@@ -0,0 +1,121 @@
+package virtual
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/poppels/filesys/fsutil"
+)
+
+func TestSnapshot(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fsutil.PutFile(fs, "/a/b.txt", []byte("Hello"))
+	fs.Symlink("b.txt", "/a/link")
+	fs.SetUmask(077)
+	snap := fs.Snapshot()
+
+	// Writing in place must not change the snapshot
+	f, err := fs.OpenFile("/a/b.txt", os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("J"))
+	f.Close()
+	fs.Remove("/a/link")
+	fs.WriteFile("/c.txt", []byte("New"), 0666)
+	fs.SetUmask(022)
+
+	restored := NewVirtualFilesys()
+	restored.Restore(snap)
+	if err := fsutil.VerifyFileContent(restored, "/a/b.txt", []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := restored.Readlink("/a/link"); err != nil || target != "b.txt" {
+		t.Fatalf("Expected link to b.txt, got '%s', %v", target, err)
+	}
+	if _, err := restored.Stat("/c.txt"); !restored.IsNotExist(err) {
+		t.Fatal("Expected /c.txt not to exist in the snapshot")
+	}
+	if old := restored.SetUmask(0); old != 077 {
+		t.Fatalf("Expected the umask of the snapshot, got %o", old)
+	}
+
+	// Restoring into the original file system keeps its current directory
+	fs, _ = fs.ChangeDir("/a")
+	fs.Restore(snap)
+	if err := fsutil.VerifyFileContent(fs, "b.txt", []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshotParallel(t *testing.T) {
+	fixture := NewVirtualFilesys()
+	for i := 0; i < 10; i++ {
+		fsutil.PutFile(fixture, fmt.Sprintf("/data/%d.txt", i), []byte("Hello"))
+	}
+	snap := fixture.Snapshot()
+
+	for i := 0; i < 8; i++ {
+		i := i
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			t.Parallel()
+			fs := NewVirtualFilesys()
+			fs.Restore(snap)
+			name := fmt.Sprintf("/data/%d.txt", i)
+			f, err := fs.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write([]byte(fmt.Sprint(i)))
+			f.Close()
+			if err := fsutil.VerifyFileContent(fs, name, []byte(fmt.Sprint("Hello", i))); err != nil {
+				t.Fatal(err)
+			}
+			if err := fsutil.VerifyFileContent(fs, "/data/9.txt", []byte("Hello")); i != 9 && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestClone(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fsutil.PutFile(fs, "/a/b.txt", []byte("Hello"))
+	fs, _ = fs.ChangeDir("/a")
+	clone := fs.Clone()
+
+	clone.WriteFile("b.txt", []byte("Bye"), 0666)
+	if err := fsutil.VerifyFileContent(fs, "b.txt", []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsutil.VerifyFileContent(clone, "/a/b.txt", []byte("Bye")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writing to the original doesn't change the clone either
+	f, _ := fs.OpenFile("b.txt", os.O_WRONLY, 0)
+	f.Write([]byte("J"))
+	f.Close()
+	clone2 := fs.Clone()
+	f, _ = fs.OpenFile("b.txt", os.O_WRONLY, 0)
+	f.Write([]byte("C"))
+	f.Close()
+	if err := fsutil.VerifyFileContent(clone2, "b.txt", []byte("Jello")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkRestore(b *testing.B) {
+	fixture := NewVirtualFilesys()
+	data := make([]byte, 64<<10)
+	for i := 0; i < 1000; i++ {
+		fsutil.PutFile(fixture, fmt.Sprintf("/d%d/f%d.bin", i%10, i), data)
+	}
+	snap := fixture.Snapshot()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fs := NewVirtualFilesys()
+		fs.Restore(snap)
+	}
+}
@@ -0,0 +1,146 @@
+package virtual
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/poppels/filesys/fsutil"
+)
+
+func TestSymlink(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fsutil.PutFile(fs, "/a/b/c.txt", []byte("Hello"))
+	fs.MkdirAll("/d", 0777)
+
+	// Absolute and relative links to a file
+	if err := fs.Symlink("/a/b/c.txt", "/d/abs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Symlink("../a/b/c.txt", "/d/rel"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/d/abs", "/d/rel"} {
+		if err := fsutil.VerifyFileContent(fs, name, []byte("Hello")); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := fs.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		} else if fi.Mode()&os.ModeSymlink != 0 {
+			t.Fatalf("Stat should follow the link %s", name)
+		}
+		fi, err = fs.Lstat(name)
+		if err != nil {
+			t.Fatal(err)
+		} else if fi.Mode()&os.ModeSymlink == 0 {
+			t.Fatalf("Lstat should not follow the link %s", name)
+		}
+	}
+
+	target, err := fs.Readlink("/d/rel")
+	if err != nil {
+		t.Fatal(err)
+	} else if target != "../a/b/c.txt" {
+		t.Fatalf("Expected link target '../a/b/c.txt', got '%s'", target)
+	}
+	if _, err := fs.Readlink("/a/b/c.txt"); err == nil {
+		t.Fatal("Readlink should fail for regular files")
+	}
+	if err := fs.Symlink("/a", "/d/abs"); !fs.IsExist(err) {
+		t.Fatalf("Expected os.ErrExist, got %v", err)
+	}
+
+	// Link to a directory in the middle of a path
+	if err := fs.Symlink("../a/b", "/d/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsutil.VerifyFileContent(fs, "/d/dir/c.txt", []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/d/dir/new.txt", []byte("New"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsutil.VerifyFileContent(fs, "/a/b/new.txt", []byte("New")); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := fs.ReadDir("/d/dir")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(infos) != 2 {
+		t.Fatalf("Expected 2 entries in /d/dir, got %d", len(infos))
+	}
+
+	// Removing a link leaves the target alone
+	if err := fs.Remove("/d/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/a/b/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDanglingSymlink(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fs.MkdirAll("/a", 0777)
+	if err := fs.Symlink("missing.txt", "/a/link"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/a/link"); !fs.IsNotExist(err) {
+		t.Fatalf("Expected os.ErrNotExist, got %v", err)
+	}
+	if _, err := fs.Lstat("/a/link"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Creating a file through a dangling link creates the target
+	if err := fs.WriteFile("/a/link", []byte("Hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsutil.VerifyFileContent(fs, "/a/missing.txt", []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSymlinkLoop(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fs.MkdirAll("/a", 0777)
+	fs.Symlink("/a/y", "/a/x")
+	fs.Symlink("x", "/a/y")
+	fs.Symlink("self", "/a/self")
+
+	for _, name := range []string{"/a/x", "/a/y", "/a/self", "/a/x/z.txt"} {
+		_, err := fs.Stat(name)
+		if perr, ok := err.(*os.PathError); !ok || perr.Err != syscall.ELOOP {
+			t.Fatalf("Expected ELOOP for %s, got %v", name, err)
+		}
+	}
+	if _, err := fs.Lstat("/a/x"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenameSymlink(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fsutil.PutFile(fs, "/a/b/c.txt", []byte("Hello"))
+	fs.Symlink("b", "/a/link")
+
+	// Rename moves the link, not its target
+	if err := fs.Rename("/a/link", "/a/renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Lstat("/a/link"); !fs.IsNotExist(err) {
+		t.Fatal("Expected the old link to be gone")
+	}
+	if _, err := fs.Stat("/a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsutil.VerifyFileContent(fs, "/a/renamed/c.txt", []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cannot move a directory into itself through a link
+	if err := fs.Rename("/a/b", "/a/renamed/x"); err == nil {
+		t.Fatal("Should not be able to move folder into itself")
+	}
+}
@@ -0,0 +1,29 @@
+package virtual
+
+import (
+	"os"
+	"syscall"
+)
+
+// sys returns the *syscall.Stat_t for a FileInfo, the same type that
+// os.Stat provides, so code that inspects ownership or times works unchanged
+func (r *resource) sys(mode os.FileMode, size int64) interface{} {
+	mtime := syscall.NsecToTimespec(r.modTime.UnixNano())
+	atime := syscall.NsecToTimespec(r.atime.Load())
+	ctime := syscall.NsecToTimespec(r.changeTime.UnixNano())
+	st := &syscall.Stat_t{
+		Mode:   unixMode(mode),
+		Uid:    uint32(r.uid),
+		Gid:    uint32(r.gid),
+		Size:   size,
+		Blocks: (size + 511) / 512,
+		Atim:   atime,
+		Mtim:   mtime,
+		Ctim:   ctime}
+	st.Blksize = 4096
+	st.Nlink = 1
+	if r.isDir {
+		st.Nlink = 2
+	}
+	return st
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package virtual
+
+import (
+	"os"
+)
+
+// sys returns nil, since there is no stat structure to mimic on this platform
+func (r *resource) sys(mode os.FileMode, size int64) interface{} {
+	return nil
+}
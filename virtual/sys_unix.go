@@ -0,0 +1,31 @@
+//go:build linux || darwin
+
+package virtual
+
+import (
+	"os"
+	"syscall"
+)
+
+// unixMode converts a FileMode to the st_mode format of the stat system call
+func unixMode(mode os.FileMode) uint32 {
+	m := uint32(mode & os.ModePerm)
+	switch {
+	case mode&os.ModeDir != 0:
+		m |= syscall.S_IFDIR
+	case mode&os.ModeSymlink != 0:
+		m |= syscall.S_IFLNK
+	default:
+		m |= syscall.S_IFREG
+	}
+	if mode&os.ModeSetuid != 0 {
+		m |= syscall.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= syscall.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= syscall.S_ISVTX
+	}
+	return m
+}
@@ -0,0 +1,42 @@
+//go:build linux || darwin
+
+package virtual
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestSysStat(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fs.MkdirAll("/a", 0777)
+	fs.WriteFile("/a/c.txt", []byte("Hello"), 0666)
+	fs.AsUser(0, 0).Chown("/a/c.txt", 2000, 3000)
+
+	fi, err := fs.Stat("/a/c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		t.Fatalf("Expected Sys() to return *syscall.Stat_t, got %T", fi.Sys())
+	}
+	if st.Uid != 2000 || st.Gid != 3000 {
+		t.Fatalf("Expected owner 2000:3000, got %d:%d", st.Uid, st.Gid)
+	}
+	if st.Size != 5 {
+		t.Fatalf("Expected size 5, got %d", st.Size)
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFREG || os.FileMode(st.Mode&0777) != 0644 {
+		t.Fatalf("Unexpected mode %o", st.Mode)
+	}
+
+	fi, err = fs.Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := fi.Sys().(*syscall.Stat_t); st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		t.Fatalf("Unexpected mode %o", st.Mode)
+	}
+}
@@ -0,0 +1,57 @@
+package virtual
+
+import (
+	"time"
+)
+
+// AtimePolicy decides when reading a file or listing a directory updates
+// its access time, like the mount options of the same names on Linux
+type AtimePolicy int
+
+const (
+	// Relatime only updates the access time if it's not newer than the
+	// modification or change time, or more than a day old. It's the default.
+	Relatime AtimePolicy = iota
+	// StrictAtime updates the access time on every access
+	StrictAtime
+	// NoAtime never updates the access time
+	NoAtime
+)
+
+// SetAtimePolicy sets when access times are updated and returns the previous
+// policy. The policy is shared with all views of the file system.
+func (fs *VirtualFileSystem) SetAtimePolicy(policy AtimePolicy) AtimePolicy {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	old := fs.tree.atimePolicy
+	fs.tree.atimePolicy = policy
+	return old
+}
+
+// accessed updates the access time of r after it was read. Callers hold
+// at least the read lock of the tree.
+func (t *tree) accessed(r *resource) {
+	now := t.clock.Now()
+	switch t.atimePolicy {
+	case NoAtime:
+		return
+	case Relatime:
+		atime := r.accessTime()
+		if atime.After(r.modTime) && atime.After(r.changeTime) && now.Sub(atime) < 24*time.Hour {
+			return
+		}
+	}
+	r.atime.Store(now.UnixNano())
+}
+
+// changed updates the change time of r after its metadata changed
+func (t *tree) changed(r *resource) {
+	r.changeTime = t.clock.Now()
+}
+
+// modified updates the modification and change times of r
+// after its contents changed
+func (t *tree) modified(r *resource) {
+	r.modTime = t.clock.Now()
+	r.changeTime = r.modTime
+}
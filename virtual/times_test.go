@@ -0,0 +1,122 @@
+package virtual
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/poppels/filesys"
+)
+
+func TestAtimePolicy(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		policy  AtimePolicy
+		updates []bool // After each read
+	}{
+		{StrictAtime, []bool{true, true, true}},
+		{Relatime, []bool{true, false, true}},
+		{NoAtime, []bool{false, false, false}},
+	}
+	for _, test := range tests {
+		clock := NewFakeClock(start)
+		fs := NewVirtualFilesysWithClock(clock)
+		fs.SetAtimePolicy(test.policy)
+		fs.WriteFile("/a.txt", []byte("Hello"), 0666)
+
+		// Reads after one hour, two hours and two days
+		for i, after := range []time.Duration{time.Hour, 2 * time.Hour, 48 * time.Hour} {
+			clock.Set(start.Add(after))
+			before := times(t, fs, "/a.txt").AccessTime
+			if _, err := fs.ReadFile("/a.txt"); err != nil {
+				t.Fatal(err)
+			}
+			atime := times(t, fs, "/a.txt").AccessTime
+			if updated := !atime.Equal(before); updated != test.updates[i] {
+				t.Fatalf("Policy %d, read %d: expected update %v, got atime %v", test.policy, i, test.updates[i], atime)
+			}
+			if test.updates[i] && !atime.Equal(clock.Now()) {
+				t.Fatalf("Expected atime %v, got %v", clock.Now(), atime)
+			}
+		}
+	}
+}
+
+func TestAtimeOnHandleAndDirectory(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	fs := NewVirtualFilesysWithClock(clock)
+	fs.SetAtimePolicy(StrictAtime)
+	fs.MkdirAll("/a", 0777)
+	fs.WriteFile("/a/b.txt", []byte("Hello"), 0666)
+
+	clock.Advance(time.Minute)
+	f, err := fs.Open("/a/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Read(make([]byte, 3))
+	f.Close()
+	if atime := times(t, fs, "/a/b.txt").AccessTime; !atime.Equal(clock.Now()) {
+		t.Fatalf("Expected read to update atime, got %v", atime)
+	}
+
+	clock.Advance(time.Minute)
+	fs.ReadDir("/a")
+	if atime := times(t, fs, "/a").AccessTime; !atime.Equal(clock.Now()) {
+		t.Fatalf("Expected listing to update atime, got %v", atime)
+	}
+}
+
+func TestChangeAndBirthTime(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	fs := NewVirtualFilesysWithClock(clock)
+	fs.WriteFile("/a.txt", []byte("Hello"), 0666)
+
+	clock.Advance(time.Hour)
+	if err := fs.Chmod("/a.txt", 0600); err != nil {
+		t.Fatal(err)
+	}
+	ft := times(t, fs, "/a.txt")
+	if !ft.ChangeTime.Equal(clock.Now()) || !ft.ModTime.Equal(start) || !ft.BirthTime.Equal(start) {
+		t.Fatalf("Expected only ctime to change, got %+v", ft)
+	}
+
+	clock.Advance(time.Hour)
+	f, err := fs.OpenFile("/a.txt", os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	ft = times(t, fs, "/a.txt")
+	if !ft.ChangeTime.Equal(clock.Now()) || !ft.ModTime.Equal(clock.Now()) || !ft.BirthTime.Equal(start) {
+		t.Fatalf("Expected ctime and mtime to change, got %+v", ft)
+	}
+
+	// Chtimes sets atime and mtime, but ctime is always the current time
+	clock.Advance(time.Hour)
+	past := start.Add(-time.Hour)
+	if err := fs.Chtimes("/a.txt", past, past); err != nil {
+		t.Fatal(err)
+	}
+	ft = times(t, fs, "/a.txt")
+	if !ft.AccessTime.Equal(past) || !ft.ModTime.Equal(past) || !ft.ChangeTime.Equal(clock.Now()) {
+		t.Fatalf("Unexpected times after Chtimes %+v", ft)
+	}
+	if err := fs.Chtimes("/a.txt", time.Time{}, start); err != nil {
+		t.Fatal(err)
+	}
+	if ft := times(t, fs, "/a.txt"); !ft.AccessTime.Equal(past) || !ft.ModTime.Equal(start) {
+		t.Fatalf("Expected a zero atime to be left unchanged, got %+v", ft)
+	}
+}
+
+func times(t *testing.T, fs *VirtualFileSystem, name string) filesys.FileTimes {
+	t.Helper()
+	fi, err := fs.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filesys.Times(fi)
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/poppels/filesys"
@@ -14,50 +16,80 @@ var (
 	errClosed             = errors.New("already closed")
 	errNotReadable        = errors.New("not readable")
 	errNotWritable        = errors.New("not writable")
-	errNotEmpty           = errors.New("not empty")
-	errIsDirectory        = errors.New("is a directory")
-	errNotDirectory       = errors.New("not a directory")
+	errNotEmpty           = syscall.ENOTEMPTY
+	errIsDirectory        = syscall.EISDIR
+	errNotDirectory       = syscall.ENOTDIR
 	errInvalidDestination = errors.New("invalid destination")
 	errInvalidPath        = errors.New("invalid path")
 	errNegativeSeek       = errors.New("negative position")
 	errSeekOverflow       = errors.New("new position is too large")
 )
 
+// maxSymlinks is the maximum number of symbolic links
+// followed when resolving a path, the same as on Linux
+const maxSymlinks = 40
+
+// VirtualFileSystem is an in-memory file system. It is safe for concurrent use
+// by multiple goroutines, including views created with ChangeDir. Every
+// operation is atomic: it observes and leaves the tree in a consistent state,
+// as if all operations were performed one at a time in some order.
 type VirtualFileSystem struct {
-	root       *resource
+	tree       *tree
 	currentDir *resource
+	user       user
+}
+
+// tree is the state shared between a file system and its ChangeDir views
+type tree struct {
+	mu         sync.RWMutex
+	root       *resource
+	umask      os.FileMode
+	capacity   int64
+	inodeLimit int64
+	clock      Clock
+	// atimePolicy is read with only the read lock held
+	atimePolicy   AtimePolicy
+	handles       map[*VirtualFileHandle]*openHandle
+	handleSeq     uint64
+	openFileLimit int
 }
 
 func NewVirtualFilesys() *VirtualFileSystem {
-	root := makeFolder("", nil)
-	return &VirtualFileSystem{root: root, currentDir: root}
+	return NewVirtualFilesysWithClock(SystemClock)
+}
+
+// NewVirtualFilesysWithClock returns an empty file system that
+// takes the time for every timestamp it sets from clock
+func NewVirtualFilesysWithClock(clock Clock) *VirtualFileSystem {
+	root := makeFolder("", nil, 0755, clock.Now())
+	root.uid, root.gid = DefaultUid, DefaultGid
+	return &VirtualFileSystem{
+		tree:       &tree{root: root, umask: defaultUmask, clock: clock},
+		currentDir: root,
+		user:       user{uid: DefaultUid, gid: DefaultGid}}
 }
 
 func (fs *VirtualFileSystem) Mkdir(name string, perm os.FileMode) error {
-	dir, filename := path.Split(path.Clean(name))
-	if filename == "" || filename == "." {
-		return nil
-	}
-	parent, err := fs.getFolder(dir, false)
-	if err != nil {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	if err := fs.mkdir(name, perm); err != nil {
 		return &os.PathError{"mkdir", name, err}
 	}
-	if c, exists := parent.children[filename]; exists && !c.isDir {
-		return errNotDirectory
-	}
-	parent.children[filename] = makeFolder(filename, parent)
 	return nil
 }
 
 func (fs *VirtualFileSystem) MkdirAll(name string, perm os.FileMode) error {
-	_, err := fs.getFolder(name, true)
-	if err != nil {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	if err := fs.mkdirAll(name, perm); err != nil {
 		return &os.PathError{"mkdir", name, err}
 	}
 	return nil
 }
 
 func (fs *VirtualFileSystem) Remove(name string) error {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
 	err := fs.removePath(name, false)
 	if err != nil {
 		return &os.PathError{"remove", name, err}
@@ -66,7 +98,13 @@ func (fs *VirtualFileSystem) Remove(name string) error {
 }
 
 func (fs *VirtualFileSystem) RemoveAll(name string) error {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
 	err := fs.removePath(name, true)
+	if err == os.ErrNotExist {
+		// Like os.RemoveAll, it's fine if the path doesn't exist
+		return nil
+	}
 	if err != nil {
 		return &os.PathError{"remove", name, err}
 	}
@@ -74,76 +112,213 @@ func (fs *VirtualFileSystem) RemoveAll(name string) error {
 }
 
 func (fs *VirtualFileSystem) Rename(oldPath, newPath string) error {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
 	if oldPath == "" || newPath == "" {
 		return &os.LinkError{"rename", oldPath, newPath, errInvalidPath}
 	}
 
-	sourceResource, err := fs.getResource(oldPath)
+	// Both parent folders are resolved before the source itself is checked
+	_, _, sourceResource, err := fs.lookup(oldPath, false)
 	if err != nil {
 		return &os.LinkError{"rename", oldPath, newPath, err}
 	}
-
-	source := path.Clean(oldPath)
-	target := path.Clean(newPath)
-	if source == target {
+	targetParent, targetName, existing, err := fs.lookup(newPath, false)
+	if err != nil {
+		return &os.LinkError{"rename", oldPath, newPath, err}
+	}
+	if sourceResource, err = fs.getResourceNoFollow(oldPath); err != nil {
+		return &os.LinkError{"rename", oldPath, newPath, err}
+	}
+	if existing == sourceResource && (oldPath != newPath || !existing.isDir) {
 		return nil
 	}
-	if sourceResource == fs.root || target == "/" {
+	// Like os.Rename, never overwrite a folder
+	if existing != nil && existing.isDir {
+		return &os.LinkError{"rename", oldPath, newPath, os.ErrExist}
+	}
+	if sourceResource == fs.tree.root {
 		return &os.LinkError{"rename", oldPath, newPath, os.ErrPermission}
 	}
 	// Cannot move folder into itself or one of its descendants
-	if strings.HasPrefix(target, source+"/") {
-		return &os.LinkError{"rename", oldPath, newPath, errInvalidDestination}
+	for dir := targetParent; dir != nil; dir = dir.parent {
+		if dir == sourceResource {
+			return &os.LinkError{"rename", oldPath, newPath, errInvalidDestination}
+		}
 	}
 
-	targetDir, targetName := path.Split(target)
+	// Only overwrite a file with another file
+	if existing != nil && sourceResource.isDir {
+		return &os.LinkError{"rename", oldPath, newPath, errNotDirectory}
+	}
 
-	targetParent, err := fs.getFolder(targetDir, false)
-	if err != nil {
+	// Moving a folder to a new parent also updates its ".." entry
+	movesFolder := sourceResource.isDir && sourceResource.parent != targetParent
+	if !fs.canAccess(sourceResource.parent, permWrite|permExec) ||
+		!fs.canAccess(targetParent, permWrite|permExec) ||
+		(movesFolder && !fs.canAccess(sourceResource, permWrite)) ||
+		!fs.canUnlink(sourceResource.parent, sourceResource) ||
+		(existing != nil && !fs.canUnlink(targetParent, existing)) {
+		return &os.LinkError{"rename", oldPath, newPath, os.ErrPermission}
+	}
+	if err := checkMove(sourceResource, targetParent); err != nil {
 		return &os.LinkError{"rename", oldPath, newPath, err}
 	}
 
-	// Cannot overwrite folder neither with file nor folder
-	if c, found := targetParent.children[targetName]; found && (sourceResource.isDir || c.isDir) {
-		return &os.LinkError{"rename", oldPath, newPath, os.ErrExist}
+	if existing != nil {
+		existing.detach()
 	}
-
-	delete(sourceResource.parent.children, sourceResource.name)
+	sourceResource.detach()
 	sourceResource.name = targetName
-	targetParent.children[targetName] = sourceResource
+	targetParent.attach(sourceResource)
+	fs.tree.changed(sourceResource)
 	return nil
 }
 
 func (fs *VirtualFileSystem) Stat(name string) (os.FileInfo, error) {
+	fs.tree.mu.RLock()
+	defer fs.tree.mu.RUnlock()
 	r, err := fs.getResource(name)
 	if err != nil {
 		return nil, &os.PathError{"stat", name, err}
 	}
+	return r.statAs(fs.linkName(name)), nil
+}
+
+func (fs *VirtualFileSystem) Lstat(name string) (os.FileInfo, error) {
+	fs.tree.mu.RLock()
+	defer fs.tree.mu.RUnlock()
+	r, err := fs.getResourceNoFollow(name)
+	if err != nil {
+		return nil, &os.PathError{"lstat", name, err}
+	}
 	return r.stat(), nil
 }
 
-func (fs *VirtualFileSystem) Open(name string) (filesys.File, error) {
-	r, err := fs.getResource(name)
+func (fs *VirtualFileSystem) Symlink(oldname, newname string) error {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	if oldname == "" {
+		return &os.LinkError{"symlink", oldname, newname, os.ErrNotExist}
+	}
+	parent, filename, r, err := fs.lookup(newname, false)
 	if err != nil {
-		return nil, &os.PathError{"open", name, err}
+		return &os.LinkError{"symlink", oldname, newname, err}
+	}
+	if r != nil {
+		return &os.LinkError{"symlink", oldname, newname, os.ErrExist}
+	}
+	if !fs.canAccess(parent, permWrite|permExec) {
+		return &os.LinkError{"symlink", oldname, newname, os.ErrPermission}
 	}
-	return r.open(os.O_RDONLY), nil
+	if err := fs.tree.checkInodes(); err != nil {
+		return &os.LinkError{"symlink", oldname, newname, err}
+	}
+	parent.attach(fs.own(makeSymlink(filename, parent, oldname, fs.tree.clock.Now())))
+	return nil
+}
+
+func (fs *VirtualFileSystem) Readlink(name string) (string, error) {
+	fs.tree.mu.RLock()
+	defer fs.tree.mu.RUnlock()
+	r, err := fs.getResourceNoFollow(name)
+	if err != nil {
+		return "", &os.PathError{"readlink", name, err}
+	}
+	if !r.isSymlink {
+		return "", &os.PathError{"readlink", name, syscall.EINVAL}
+	}
+	fs.tree.accessed(r)
+	return r.target, nil
+}
+
+func (fs *VirtualFileSystem) Open(name string) (filesys.File, error) {
+	return fs.openFile(name, os.O_RDONLY, 0)
+}
+
+func (fs *VirtualFileSystem) OpenFile(name string, flag int, perm os.FileMode) (filesys.File, error) {
+	return fs.openFile(name, flag, perm)
 }
 
 func (fs *VirtualFileSystem) Create(name string) (filesys.File, error) {
-	f, err := fs.createFile(name)
+	return fs.openFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (fs *VirtualFileSystem) openFile(name string, flag int, perm os.FileMode) (filesys.File, error) {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	if err := fs.tree.checkOpenFiles(); err != nil {
+		return nil, &os.PathError{"open", name, err}
+	}
+	r, err := fs.openResource(name, flag, perm)
 	if err != nil {
-		return nil, &os.PathError{"create", name, err}
+		return nil, &os.PathError{"open", name, err}
 	}
-	return f.open(os.O_RDWR), nil
+	fh := r.open(fs.tree, name, flag)
+	fh.linkName = fs.linkName(name)
+	fs.register(fh)
+	return fh, nil
 }
 
 func (fs *VirtualFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
 	r, err := fs.getResource(name)
 	if err != nil {
 		return &os.PathError{"chtimes", name, err}
 	}
-	r.modTime = mtime
+	if !fs.isOwner(r) {
+		return &os.PathError{"chtimes", name, os.ErrPermission}
+	}
+	// Like in os, a zero time leaves the time unchanged
+	if !atime.IsZero() {
+		r.atime.Store(atime.UnixNano())
+	}
+	if !mtime.IsZero() {
+		r.modTime = mtime
+	}
+	fs.tree.changed(r)
+	return nil
+}
+
+func (fs *VirtualFileSystem) Chmod(name string, mode os.FileMode) error {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	r, err := fs.getResource(name)
+	if err != nil {
+		return &os.PathError{"chmod", name, err}
+	}
+	if !fs.isOwner(r) {
+		return &os.PathError{"chmod", name, os.ErrPermission}
+	}
+	r.mode = mode & chmodBits
+	fs.tree.changed(r)
+	return nil
+}
+
+func (fs *VirtualFileSystem) Chown(name string, uid, gid int) error {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	r, err := fs.getResource(name)
+	if err != nil {
+		return &os.PathError{"chown", name, err}
+	}
+	if err := fs.chown(r, uid, gid); err != nil {
+		return &os.PathError{"chown", name, err}
+	}
+	return nil
+}
+
+func (fs *VirtualFileSystem) Lchown(name string, uid, gid int) error {
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	r, err := fs.getResourceNoFollow(name)
+	if err != nil {
+		return &os.PathError{"lchown", name, err}
+	}
+	if err := fs.chown(r, uid, gid); err != nil {
+		return &os.PathError{"lchown", name, err}
+	}
 	return nil
 }
 
@@ -160,17 +335,25 @@ func (fs *VirtualFileSystem) IsPermission(err error) bool {
 }
 
 func (fs *VirtualFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	fs.tree.mu.RLock()
+	defer fs.tree.mu.RUnlock()
 	if name == "" {
 		return nil, errInvalidPath
 	}
-	folder, err := fs.getFolder(name, false)
+	folder, err := fs.getFolder(name)
 	if err != nil {
 		return nil, &os.PathError{"readdir", name, err}
 	}
+	if !fs.canAccess(folder, permRead) {
+		return nil, &os.PathError{"readdir", name, os.ErrPermission}
+	}
+	fs.tree.accessed(folder)
 	return folder.readdir(), err
 }
 
 func (fs *VirtualFileSystem) ReadFile(name string) ([]byte, error) {
+	fs.tree.mu.RLock()
+	defer fs.tree.mu.RUnlock()
 	r, err := fs.getResource(name)
 	if err != nil {
 		return nil, &os.PathError{"readfile", name, err}
@@ -178,46 +361,76 @@ func (fs *VirtualFileSystem) ReadFile(name string) ([]byte, error) {
 	if r.isDir {
 		return nil, &os.PathError{"readfile", name, errIsDirectory}
 	}
+	if !fs.canAccess(r, permRead) {
+		return nil, &os.PathError{"readfile", name, os.ErrPermission}
+	}
 	clone := make([]byte, len(r.data))
 	copy(clone, r.data)
+	fs.tree.accessed(r)
 	return clone, nil
 }
 
 func (fs *VirtualFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
-	f, err := fs.createFile(name)
+	fs.tree.mu.Lock()
+	defer fs.tree.mu.Unlock()
+	f, err := fs.openResource(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
 		return &os.PathError{"writefile", name, err}
 	}
-	f.data = make([]byte, len(data))
-	copy(f.data, data)
+	room, limitErr := fs.tree.room(f)
+	if int64(len(data)) > room {
+		data = data[:room]
+	} else {
+		limitErr = nil
+	}
+	buf := make([]byte, len(data))
+	copy(buf, data)
+	f.setData(buf)
+	f.shared = false
+	fs.tree.modified(f)
+	if limitErr != nil {
+		return &os.PathError{"writefile", name, limitErr}
+	}
 	return nil
 }
 
 func (fs *VirtualFileSystem) ChangeDir(name string) (*VirtualFileSystem, error) {
+	fs.tree.mu.RLock()
+	defer fs.tree.mu.RUnlock()
 	if name == "" {
 		return nil, errInvalidPath
 	}
-	f, err := fs.getFolder(name, false)
+	f, err := fs.getFolder(name)
 	if err != nil {
 		return nil, &os.PathError{"cd", name, err}
 	}
-	return &VirtualFileSystem{root: fs.root, currentDir: f}, nil
+	if !fs.canAccess(f, permExec) {
+		return nil, &os.PathError{"cd", name, os.ErrPermission}
+	}
+	return &VirtualFileSystem{tree: fs.tree, currentDir: f, user: fs.user}, nil
 }
 
 func (fs *VirtualFileSystem) CurrentDir() string {
-	if fs.currentDir == fs.root {
+	fs.tree.mu.RLock()
+	defer fs.tree.mu.RUnlock()
+	return fs.tree.pathOf(fs.currentDir)
+}
+
+// pathOf returns the absolute path of r
+func (t *tree) pathOf(r *resource) string {
+	if r == t.root {
 		return "/"
 	}
 
 	// Get length of final path before allocating it
 	length := 0
-	for current := fs.currentDir; current != fs.root; current = current.parent {
+	for current := r; current != t.root; current = current.parent {
 		length += len(current.name) + 1
 	}
 
 	path := make([]byte, length)
 	end := length
-	for current := fs.currentDir; current != fs.root; current = current.parent {
+	for current := r; current != t.root; current = current.parent {
 		start := end - len(current.name)
 		copy(path[start:end], current.name)
 		end = start - 1
@@ -227,99 +440,248 @@ func (fs *VirtualFileSystem) CurrentDir() string {
 	return string(path)
 }
 
-func (fs *VirtualFileSystem) createFile(name string) (*resource, error) {
-	if strings.HasSuffix(name, "/") {
-		return nil, errInvalidPath
-	}
-	dir, filename := path.Split(path.Clean(name))
-	if filename == "" || filename == "." {
-		return nil, errInvalidPath
-	}
-
-	folder, err := fs.getFolder(dir, false)
+// openResource looks up the resource to open with the given flags,
+// creating or truncating it as requested by the flags
+func (fs *VirtualFileSystem) openResource(name string, flag int, perm os.FileMode) (*resource, error) {
+	// With O_EXCL, even a dangling link counts as existing
+	exclusive := flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL
+	dir, filename, r, err := fs.lookup(name, !exclusive)
 	if err != nil {
 		return nil, err
 	}
+	if r == nil {
+		if flag&os.O_CREATE == 0 {
+			return nil, os.ErrNotExist
+		}
+		if strings.HasSuffix(name, "/") || filename == "" {
+			return nil, errInvalidPath
+		}
+		if !fs.canAccess(dir, permWrite|permExec) {
+			return nil, os.ErrPermission
+		}
+		if err := fs.tree.checkInodes(); err != nil {
+			return nil, err
+		}
+		file := fs.own(makeFile(filename, dir, []byte{}, perm&chmodBits&^fs.tree.umask, fs.tree.clock.Now()))
+		dir.attach(file)
+		return file, nil
+	}
 
-	if c, exists := folder.children[filename]; exists && c.isDir {
+	if exclusive {
+		return nil, os.ErrExist
+	}
+	if r.isDir && (isWritable(flag) || flag&os.O_CREATE != 0) {
 		return nil, errIsDirectory
 	}
+	if !r.isDir && strings.HasSuffix(name, "/") {
+		return nil, errNotDirectory
+	}
+	if (isReadable(flag) && !fs.canAccess(r, permRead)) ||
+		(isWritable(flag) && !fs.canAccess(r, permWrite)) {
+		return nil, os.ErrPermission
+	}
+	if flag&os.O_TRUNC != 0 && isWritable(flag) && len(r.data) > 0 {
+		r.setData([]byte{})
+		r.shared = false
+		fs.tree.modified(r)
+	}
+	return r, nil
+}
 
-	file := makeFile(filename, folder, []byte{})
-	folder.children[filename] = file
-	return file, nil
+// lookup resolves a path to the directory containing its final element, the
+// name of that element and the resource itself, which is nil if the final
+// element doesn't exist. Symbolic links are always followed in the directory
+// part of the path, but only followed for the final element if follow is true.
+// If it is followed, the returned directory and name are those of the target.
+func (fs *VirtualFileSystem) lookup(name string, follow bool) (*resource, string, *resource, error) {
+	if name == "" {
+		return nil, "", nil, os.ErrNotExist
+	}
+	links := 0
+	return fs.lookupFrom(fs.currentDir, name, follow, &links)
 }
 
-func (fs *VirtualFileSystem) getFolder(name string, createMissing bool) (*resource, error) {
-	var current *resource
+func (fs *VirtualFileSystem) lookupFrom(current *resource, name string, follow bool, links *int) (*resource, string, *resource, error) {
 	if strings.HasPrefix(name, "/") {
-		current = fs.root
-	} else {
-		current = fs.currentDir
+		current = fs.tree.root
 	}
 	parts := strings.Split(path.Clean(name), "/")
-	for _, part := range parts {
+	last := ""
+	for i, part := range parts {
 		if part == "" || part == "." {
 			continue
 		}
+		if !fs.canAccess(current, permExec) {
+			return nil, "", nil, os.ErrPermission
+		}
 		if part == ".." {
 			if current.parent != nil {
 				current = current.parent
 			}
 			continue
 		}
+		if i == len(parts)-1 {
+			last = part
+			break
+		}
 
 		child, exists := current.children[part]
-		if exists {
-			if !child.isDir {
-				return nil, os.ErrNotExist
+		if !exists {
+			return nil, "", nil, os.ErrNotExist
+		}
+		if child.isSymlink {
+			var err error
+			if child, err = fs.followLink(current, child, links); err != nil {
+				return nil, "", nil, err
 			}
-			current = child
-			continue
 		}
-		if !createMissing {
-			return nil, os.ErrNotExist
+		if !child.isDir {
+			return nil, "", nil, errNotDirectory
 		}
-
-		child = makeFolder(part, current)
-		current.children[part] = child
 		current = child
 	}
 
-	return current, nil
+	// The path refers to a directory, like "/" or "a/.."
+	if last == "" {
+		return current.parent, current.name, current, nil
+	}
+
+	child := current.children[last]
+	if child != nil && child.isSymlink && (follow || strings.HasSuffix(name, "/")) {
+		*links++
+		if *links > maxSymlinks {
+			return nil, "", nil, syscall.ELOOP
+		}
+		return fs.lookupFrom(current, child.target, true, links)
+	}
+	return current, last, child, nil
 }
 
-func (fs *VirtualFileSystem) getResource(name string) (*resource, error) {
-	if name == "/" {
-		return nil, os.ErrPermission
+// followLink resolves a symbolic link found in the directory dir
+func (fs *VirtualFileSystem) followLink(dir, link *resource, links *int) (*resource, error) {
+	*links++
+	if *links > maxSymlinks {
+		return nil, syscall.ELOOP
+	}
+	_, _, r, err := fs.lookupFrom(dir, link.target, true, links)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, os.ErrNotExist
+	}
+	return r, nil
+}
+
+func (fs *VirtualFileSystem) getFolder(name string) (*resource, error) {
+	r, err := fs.getResource(name)
+	if err != nil {
+		return nil, err
 	}
-	dir, filename := path.Split(path.Clean(name))
-	folder, err := fs.getFolder(dir, false)
+	if !r.isDir {
+		return nil, errNotDirectory
+	}
+	return r, nil
+}
+
+// mkdirAll works like os.MkdirAll: when the path can't be resolved,
+// the parent is created first and then the path itself
+func (fs *VirtualFileSystem) mkdirAll(name string, perm os.FileMode) error {
+	r, err := fs.getResource(name)
+	if err == nil {
+		if !r.isDir {
+			return errNotDirectory
+		}
+		return nil
+	}
+	if parent := path.Dir(path.Clean(name)); parent != path.Clean(name) {
+		if err := fs.mkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	if err := fs.mkdir(name, perm); err != nil {
+		if r, err := fs.getResourceNoFollow(name); err == nil && r.isDir {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (fs *VirtualFileSystem) mkdir(name string, perm os.FileMode) error {
+	parent, filename, r, err := fs.lookup(name, false)
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		return os.ErrExist
+	}
+	if !fs.canAccess(parent, permWrite|permExec) {
+		return os.ErrPermission
+	}
+	if err := fs.tree.checkInodes(); err != nil {
+		return err
+	}
+	parent.attach(fs.own(makeFolder(filename, parent, perm&chmodBits&^fs.tree.umask, fs.tree.clock.Now())))
+	return nil
+}
+
+func (fs *VirtualFileSystem) getResource(name string) (*resource, error) {
+	_, _, r, err := fs.lookup(name, true)
 	if err != nil {
 		return nil, err
 	}
-	if filename == "" {
-		return folder, nil
+	if r == nil {
+		return nil, os.ErrNotExist
 	}
-	forceDir := strings.HasSuffix(name, "/")
-	child, exists := folder.children[filename]
-	if !exists || (forceDir && !child.isDir) {
+	if strings.HasSuffix(name, "/") && !r.isDir {
+		return nil, errNotDirectory
+	}
+	return r, nil
+}
+
+// linkName returns the name of the link if the path ends in one.
+// Like in os, a file reached through a link is reported under the link's name.
+func (fs *VirtualFileSystem) linkName(name string) string {
+	if link, err := fs.getResourceNoFollow(name); err == nil && link.isSymlink {
+		return link.name
+	}
+	return ""
+}
+
+// getResourceNoFollow is like getResource, but if the final
+// element of the path is a symbolic link, the link itself is returned
+func (fs *VirtualFileSystem) getResourceNoFollow(name string) (*resource, error) {
+	_, _, r, err := fs.lookup(name, false)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
 		return nil, os.ErrNotExist
 	}
-	return child, nil
+	if strings.HasSuffix(name, "/") && !r.isDir {
+		return nil, errNotDirectory
+	}
+	return r, nil
 }
 
 func (fs *VirtualFileSystem) removePath(name string, recursive bool) error {
-	r, err := fs.getResource(name)
+	r, err := fs.getResourceNoFollow(name)
 	if err != nil {
 		return err
 	}
-	if r == fs.root {
+	if r == fs.tree.root {
 		return os.ErrPermission
 	}
 	if !recursive && r.isDir && len(r.children) > 0 {
 		return errNotEmpty
 	}
-	delete(r.parent.children, r.name)
+	if !fs.canAccess(r.parent, permWrite|permExec) || !fs.canUnlink(r.parent, r) {
+		return os.ErrPermission
+	}
+	if recursive && !fs.canRemoveContents(r) {
+		return os.ErrPermission
+	}
+	r.detach()
 	return nil
 }
@@ -115,7 +115,7 @@ func TestRename(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	} else if len(infos) != 3 {
-		t.Fatal("Expected /a/d/e to contain 3 children, got %d", len(infos))
+		t.Fatalf("Expected /a/d/e to contain 3 children, got %d", len(infos))
 	}
 
 	// Move file
@@ -187,6 +187,19 @@ func TestChtimes(t *testing.T) {
 	}
 }
 
+func TestStatRoot(t *testing.T) {
+	fs := NewVirtualFilesys()
+	fi, err := fs.Stat("/")
+	if err != nil {
+		t.Fatal(err)
+	} else if !fi.IsDir() {
+		t.Fatal("Expected root to be a directory")
+	}
+	if err := fs.Remove("/"); !fs.IsPermission(err) {
+		t.Fatal("Should not be able to remove root")
+	}
+}
+
 func TestCurrentDir(t *testing.T) {
 	fs := NewVirtualFilesys()
 	path := "/abra/kadabra/sim/salabim/€ß"
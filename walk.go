@@ -0,0 +1,47 @@
+package filesys
+
+import (
+	"io/fs"
+	"path/filepath"
+
+	"github.com/poppels/filesys/internal/walk"
+)
+
+// SkipDir and SkipAll are the values of the io/fs package, returned by
+// the function called by Walk and WalkDir to skip a directory or the rest
+// of the tree
+var (
+	SkipDir = fs.SkipDir
+	SkipAll = fs.SkipAll
+)
+
+// WalkOptions changes how WalkDirWith walks a tree
+type WalkOptions struct {
+	// FollowSymlinks reports links as the files and directories they
+	// point to, and walks into linked directories, except for links to
+	// directories that contain them or are being walked already, which
+	// would be cycles. Dangling links are reported as links.
+	FollowSymlinks bool
+	// Workers is the number of directories that are walked concurrently.
+	// With more than one, the function is called from several goroutines
+	// at once, and only the entries of each directory are in lexical order.
+	Workers int
+}
+
+// Walk walks the tree below root in the global FileSystem, in lexical
+// order, like filepath.Walk
+func Walk(root string, fn filepath.WalkFunc) error {
+	return walk.Walk(getSingleton(), root, false, walk.Func(fn))
+}
+
+// WalkDir walks the tree below root in the global FileSystem, in lexical
+// order, like filepath.WalkDir
+func WalkDir(root string, fn fs.WalkDirFunc) error {
+	return walk.WalkDir(getSingleton(), root, false, 1, fn)
+}
+
+// WalkDirWith is like WalkDir, with options to follow links
+// and walk concurrently
+func WalkDirWith(root string, opts WalkOptions, fn fs.WalkDirFunc) error {
+	return walk.WalkDir(getSingleton(), root, opts.FollowSymlinks, opts.Workers, fn)
+}